@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/engine"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// build an engine from the configuration and print every rule that matches the domain
+func explain(conf *config.GudgeonConfig, opts config.ExplainOptions) error {
+	var address *net.IP
+	if "" != opts.IP {
+		ip := net.ParseIP(opts.IP)
+		if ip == nil {
+			return fmt.Errorf("'%s' is not a valid IP address", opts.IP)
+		}
+		address = &ip
+	}
+
+	// nothing is recorded while explaining
+	disabled := false
+	conf.Metrics.Enabled = &disabled
+	conf.QueryLog.Enabled = &disabled
+
+	explainEngine, err := engine.NewEngine(conf)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		explainEngine.Shutdown()
+		util.ClearDirectory(conf.SessionRoot())
+	}()
+
+	explanation, err := explainEngine.Explain(opts.Domain, opts.Consumer, opts.Groups, address)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	fmt.Fprintf(out, "Domain:   %s\n", explanation.Domain)
+	if "" != explanation.Consumer {
+		fmt.Fprintf(out, "Consumer: %s\n", explanation.Consumer)
+	}
+	fmt.Fprintf(out, "Groups:   %s\n", strings.Join(explanation.Groups, ", "))
+	fmt.Fprintf(out, "Lists:    %d checked\n", len(explanation.Lists))
+	fmt.Fprintf(out, "Matches:\n")
+	if len(explanation.Matches) < 1 {
+		fmt.Fprintf(out, "  (none)\n")
+	}
+	for _, match := range explanation.Matches {
+		marker := " "
+		if match.Winner {
+			marker = "*"
+		}
+		matchType := match.Type
+		if match.Audit {
+			matchType = "audit"
+		}
+		fmt.Fprintf(out, "%s %-5s '%s' in list '%s' [tags: %s]\n", marker, matchType, match.Rule, match.List, strings.Join(match.Tags, ", "))
+	}
+	fmt.Fprintf(out, "Result:   %s\n", explanation.Reason)
+
+	return nil
+}
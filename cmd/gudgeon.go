@@ -194,6 +194,26 @@ func main() {
 		log.Infof("Configuration file: %s", filename)
 	}
 
+	// explain the rules that match a domain instead of starting
+	if "" != opts.ExplainOptions.Domain {
+		err = explain(conf, opts.ExplainOptions)
+		if err != nil {
+			log.Errorf("%s", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// pause or resume blocking on the running instance instead of starting
+	if "" != opts.PauseOptions.Duration || opts.PauseOptions.Resume {
+		err = pause(conf, opts.PauseOptions)
+		if err != nil {
+			log.Errorf("%s", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// create new Gudgeon instance
 	instance := NewGudgeon(&filename, conf)
 
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/engine"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// pause or resume blocking on the running instance through the web api
+func pause(conf *config.GudgeonConfig, opts config.PauseOptions) error {
+	if !conf.Web.Enabled {
+		return fmt.Errorf("the web api must be enabled to pause or resume blocking")
+	}
+	if "" != opts.Consumer && "" != opts.Group {
+		return fmt.Errorf("only one of a consumer or a group can be paused at a time")
+	}
+
+	scope, name := engine.PauseGlobal, ""
+	if "" != opts.Consumer {
+		scope, name = engine.PauseConsumer, opts.Consumer
+	} else if "" != opts.Group {
+		scope, name = engine.PauseGroup, opts.Group
+	}
+
+	// the instance listens on all interfaces when no address (or an unspecified address) is given
+	address := conf.Web.Address
+	if ip := net.ParseIP(address); "" == address || (ip != nil && ip.IsUnspecified()) {
+		address = "127.0.0.1"
+	}
+	endpoint := "http://" + net.JoinHostPort(address, strconv.Itoa(conf.Web.Port)) + "/api/pause"
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var (
+		request *http.Request
+		err     error
+	)
+	if opts.Resume {
+		query := url.Values{}
+		query.Set("scope", scope)
+		query.Set("name", name)
+		request, err = http.NewRequest(http.MethodDelete, endpoint+"?"+query.Encode(), nil)
+	} else {
+		if _, err = time.ParseDuration(opts.Duration); err != nil {
+			return fmt.Errorf("could not parse pause duration '%s': %s", opts.Duration, err)
+		}
+		var body []byte
+		if body, err = util.Json.Marshal(map[string]string{"scope": scope, "name": name, "duration": opts.Duration}); err != nil {
+			return err
+		}
+		request, err = http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err == nil {
+			request.Header.Set("Content-Type", "application/json")
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not reach the running instance at %s: %s", endpoint, err)
+	}
+	defer response.Body.Close()
+	content, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("the running instance refused the request: %s", string(content))
+	}
+
+	if opts.Resume {
+		resumed := struct {
+			Resumed bool `json:"resumed"`
+		}{}
+		_ = util.Json.Unmarshal(content, &resumed)
+		if resumed.Resumed {
+			log.Infof("Blocking resumed for %s", &engine.Pause{Scope: scope, Name: name})
+		} else {
+			log.Infof("Blocking was not paused for %s", &engine.Pause{Scope: scope, Name: name})
+		}
+		return nil
+	}
+
+	paused := &engine.Pause{}
+	if err := util.Json.Unmarshal(content, paused); err != nil {
+		return err
+	}
+	log.Infof("Blocking paused for %s until %s", paused, paused.Until.Format(time.RFC3339))
+	return nil
+}
@@ -3,10 +3,12 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/miekg/dns"
 	"gopkg.in/yaml.v2"
 
 	"github.com/chrisruffalo/gudgeon/util"
@@ -20,10 +22,28 @@ const (
 	ALLOW = ListType(1)
 	// the constant that means BLOCK after pasring "allow" or "block"
 	BLOCK = ListType(0)
+	// the constant that means the list is a manifest of other lists
+	MANIFEST = ListType(2)
+	// the constant that means the list rewrites domains to other names or addresses
+	REWRITE = ListType(3)
 
 	// the string that represents "allow", all other results are treated as "block"
 	ALLOWSTRING = ListString("allow")
 	BLOCKSTRING = ListString("block")
+	// the string that represents a list that is a manifest of other lists
+	MANIFESTSTRING = ListString("manifest")
+	// the string that represents a list of rewrites
+	REWRITESTRING = ListString("rewrite")
+
+	// block matches are enforced (the default)
+	ModeEnforce = "enforce"
+	// block matches are only recorded as "would block" and the query resolves normally
+	ModeAudit = "audit"
+
+	// rules in the list are compared against the name in the question (the default)
+	TargetDomain = "domain"
+	// rules in the list are addresses and networks that are compared against the addresses in the answer
+	TargetIP = "ip"
 
 	defaultString = "default"
 	systemString  = "system"
@@ -31,6 +51,12 @@ const (
 
 var remoteProtocols = []string{"http:", "https:"}
 
+// proxy schemes that are supported for downloads
+var proxyProtocols = []string{"http", "https", "socks5"}
+
+// the proxy value that explicitly disables a proxy
+const NoProxy = "none"
+
 type GudgeonTLS struct {
 	Enabled bool `yaml:"enabled"`
 }
@@ -114,6 +140,195 @@ type GudgeonNetwork struct {
 	UDP *bool `yaml:"udp"`
 	// endpoints: list of string endpoints that should have dns
 	Interfaces []*GudgeonInterface `yaml:"interfaces"`
+	// client_identity: use the client identity that forwarders add to queries with edns0 options
+	ClientIdentity *GudgeonClientIdentity `yaml:"client_identity"`
+	// client_rate_limit: the default limit for each client address, used when the consumer has no client limit
+	ClientRateLimit *GudgeonRateLimit `yaml:"client_rate_limit"`
+	// rebinding: the default dns rebinding protection, used when none of the groups of a query have their own
+	Rebinding *GudgeonRebinding `yaml:"rebinding"`
+}
+
+const (
+	// answers for public names with private addresses are answered with NXDOMAIN
+	RebindingBlock = "block"
+	// private addresses are removed from answers for public names
+	RebindingStrip = "strip"
+)
+
+// protection against dns rebinding: public names that resolve to private, loopback, or link-local addresses
+type GudgeonRebinding struct {
+	// enabled: check answers for private addresses (default: true)
+	Enabled *bool `yaml:"enabled"`
+	// action: "block" (default) or "strip" for answers with private addresses
+	Action string `yaml:"action"`
+	// allow: domains (and their subdomains) that may resolve to private addresses
+	Allow []string `yaml:"allow"`
+}
+
+// if answers should be checked for private addresses
+func (rebinding *GudgeonRebinding) Active() bool {
+	return rebinding != nil && rebinding.Enabled != nil && *rebinding.Enabled
+}
+
+// if private addresses are removed from the answer instead of blocking it
+func (rebinding *GudgeonRebinding) Strips() bool {
+	return rebinding != nil && RebindingStrip == rebinding.Action
+}
+
+// if the domain may resolve to private addresses. single label names (like "router") and localhost are not public
+// names and are always allowed.
+func (rebinding *GudgeonRebinding) Allows(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if !strings.Contains(domain, ".") || "localhost" == domain || strings.HasSuffix(domain, ".localhost") {
+		return true
+	}
+	if rebinding == nil {
+		return false
+	}
+	for _, allowed := range rebinding.Allow {
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// queries over the rate limit are answered with REFUSED
+	RateLimitRefuse = "refuse"
+	// queries over the rate limit are not answered
+	RateLimitDrop = "drop"
+)
+
+// a token bucket limit on how fast queries are answered
+type GudgeonRateLimit struct {
+	// rate: queries per second that are allowed over time
+	Rate float64 `yaml:"rate"`
+	// burst: queries that are allowed at once before the rate applies (default: the rate, at least 1)
+	Burst int `yaml:"burst"`
+	// action: "refuse" (default) or "drop" for queries over the limit
+	Action string `yaml:"action"`
+}
+
+// if queries over the limit are dropped instead of refused
+func (limit *GudgeonRateLimit) Drops() bool {
+	return limit != nil && RateLimitDrop == limit.Action
+}
+
+// options for reading the original client from queries sent through a forwarder (like dnsmasq)
+type GudgeonClientIdentity struct {
+	// enabled: read the client subnet (with a full length prefix), add-mac, and add-cpe-id edns0 options
+	Enabled bool `yaml:"enabled"`
+	// trusted: ips or networks of the forwarders that are trusted to add client identity (required when enabled)
+	Trusted []string `yaml:"trusted"`
+	// strip: remove the options that carried the client identity before forwarding the query (default: true)
+	Strip *bool `yaml:"strip"`
+
+	trustedNets []*net.IPNet
+}
+
+// if the options that carried the client identity are removed before the query is forwarded
+func (identity *GudgeonClientIdentity) StripOptions() bool {
+	return identity == nil || identity.Strip == nil || *identity.Strip
+}
+
+// if client identity options from the given address are used
+func (identity *GudgeonClientIdentity) Trusts(address net.IP) bool {
+	if identity == nil || !identity.Enabled || address == nil {
+		return false
+	}
+	for _, trusted := range identity.trustedNets {
+		if trusted.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// a shared secret used to sign zone transfers and notifies (TSIG, RFC 8945)
+type GudgeonTsigKey struct {
+	// name: the name of the key, the same name must be used on the other server
+	Name string `yaml:"name"`
+	// algorithm: "hmac-sha256" (default), "hmac-sha512", "hmac-sha1", or "hmac-md5"
+	Algorithm string `yaml:"algorithm"`
+	// secret: the base64 encoded secret, can reference environment variables like '${TSIG_SECRET}'
+	Secret string `yaml:"secret"`
+
+	algorithm string
+	secret    string
+}
+
+// the key name as a fully qualified domain name, the way it appears in signed messages
+func (key *GudgeonTsigKey) Fqdn() string {
+	return dns.Fqdn(strings.ToLower(key.Name))
+}
+
+// the name of the algorithm as it appears in signed messages
+func (key *GudgeonTsigKey) AlgorithmName() string {
+	return key.algorithm
+}
+
+// the base64 encoded secret with environment variables expanded
+func (key *GudgeonTsigKey) SecretValue() string {
+	return key.secret
+}
+
+// a zone loaded from a zone file that is transferred (AXFR/IXFR) to secondary servers
+type GudgeonTransfer struct {
+	// zone: the origin of the zone
+	Zone string `yaml:"zone"`
+	// allow: ips or networks of the secondary servers that may transfer the zone
+	Allow []string `yaml:"allow"`
+	// key: the name of the tsig key that transfer requests must be signed with
+	Key string `yaml:"key"`
+	// notify: addresses ("ip" or "ip:port") of the secondary servers that are sent a NOTIFY when the zone changes
+	Notify []string `yaml:"notify"`
+
+	allowNets     []*net.IPNet
+	notifyTargets []string
+}
+
+// if the address is allowed to transfer the zone, always true when no addresses are configured
+func (transfer *GudgeonTransfer) Allows(address net.IP) bool {
+	return allowedBy(transfer.allowNets, address)
+}
+
+// the "host:port" addresses that are notified when the zone changes
+func (transfer *GudgeonTransfer) NotifyTargets() []string {
+	return transfer.notifyTargets
+}
+
+// a zone loaded from a zone file that accepts dynamic updates (RFC 2136)
+type GudgeonUpdate struct {
+	// zone: the origin of the zone
+	Zone string `yaml:"zone"`
+	// allow: ips or networks of the clients that may update the zone
+	Allow []string `yaml:"allow"`
+	// key: the name of the tsig key that updates must be signed with
+	Key string `yaml:"key"`
+
+	allowNets []*net.IPNet
+}
+
+// if the address is allowed to update the zone, always true when no addresses are configured
+func (update *GudgeonUpdate) Allows(address net.IP) bool {
+	return allowedBy(update.allowNets, address)
+}
+
+// if the address is in one of the networks or there are no networks
+func allowedBy(nets []*net.IPNet, address net.IP) bool {
+	if len(nets) < 1 {
+		return true
+	}
+	if address == nil {
+		return false
+	}
+	for _, allowed := range nets {
+		if allowed.Contains(address) {
+			return true
+		}
+	}
+	return false
 }
 
 // provides more configuration options and details for sources beyond the simple source specification
@@ -142,6 +357,9 @@ type GudgeonResolver struct {
 	Hosts []string `yaml:"hosts"`
 	// sources (described via string)
 	Sources []string `yaml:"sources"`
+	// forward_special: send special use domains (like .local) and private reverse lookups to the sources that
+	// forward queries to other servers, by default only the hosts, zone file, and resolver sources are used
+	ForwardSpecial bool `yaml:"forward_special"`
 }
 
 // GudgeonList different types of lists for domains that gudgeon will evaluate (and if they explicitly allow or block the matched entries)
@@ -149,15 +367,48 @@ type GudgeonList struct {
 	// the name of the list
 	Name      string `yaml:"name"`
 	shortName string `yaml:"-"`
-	// the type of the list, requires "allow" or "block", defaults to "block"
+	// the type of the list, requires "allow", "block", "manifest", or "rewrite", defaults to "block"
 	Type       string   `yaml:"type"`
 	parsedType ListType `yaml:"-"`
+	// the canonical name of the manifest that this list was expanded from
+	manifest string `yaml:"-"`
+	// "enforce" or "audit", block matches in an audit list are only recorded and not enforced
+	Mode string `yaml:"mode"`
+	// "domain" or "ip", what the rules in the list are compared against
+	Target string `yaml:"target"`
 	// should items in the list be interpreted as **regex only**
 	Regex *bool `yaml:"regex"`
 	// the tags that relate to the list for tag filtering/processing
 	Tags *[]string `yaml:"tags"`
 	// the path to the list, remote paths will be downloaded if possible
 	Source string `yaml:"src"`
+	// additional http headers to send when downloading a remote list (values can reference environment variables like ${TOKEN})
+	Headers map[string]string `yaml:"headers"`
+	// basic authentication for downloading a remote list
+	Auth *GudgeonListAuth `yaml:"auth"`
+	// client certificate and trust options for downloading a remote list
+	TLS *GudgeonListTLS `yaml:"tls"`
+	// http, https, or socks5 proxy url used to download the list, overrides the default proxy ("none" disables the proxy)
+	Proxy string `yaml:"proxy"`
+}
+
+// basic authentication details for a remote list
+type GudgeonListAuth struct {
+	Username string `yaml:"username"`
+	// the password can reference environment variables like ${PASSWORD}
+	Password string `yaml:"password"`
+}
+
+// tls details for a remote list
+type GudgeonListTLS struct {
+	// path to the PEM encoded client certificate
+	Cert string `yaml:"cert"`
+	// path to the PEM encoded client key
+	Key string `yaml:"key"`
+	// path to a PEM encoded CA bundle used to verify the server instead of the system roots
+	CA string `yaml:"ca"`
+	// skip verification of the server certificate
+	Insecure bool `yaml:"insecure"`
 }
 
 // simple function to get source as name if name is missing
@@ -204,6 +455,31 @@ func (list *GudgeonList) ParsedType() ListType {
 	return list.parsedType
 }
 
+// a manifest list is not loaded into the rule store, it is expanded into the lists it contains
+func (list *GudgeonList) IsManifest() bool {
+	return list != nil && list.parsedType == MANIFEST
+}
+
+// an audit list records block matches without blocking the query
+func (list *GudgeonList) IsAudit() bool {
+	return list != nil && ModeAudit == list.Mode
+}
+
+// a rewrite list answers domains with other names or addresses instead of resolving them
+func (list *GudgeonList) IsRewrite() bool {
+	return list != nil && list.parsedType == REWRITE
+}
+
+// an ip list holds addresses and networks that are compared against the addresses in an answer
+func (list *GudgeonList) IsIP() bool {
+	return list != nil && TargetIP == list.Target
+}
+
+// the canonical name of the manifest the list was expanded from or "" if it was configured directly
+func (list *GudgeonList) Manifest() string {
+	return list.manifest
+}
+
 func (list *GudgeonList) SafeTags() []string {
 	if list.Tags == nil {
 		return []string{"default"}
@@ -225,6 +501,81 @@ type GudgeonGroup struct {
 	Lists []string `yaml:"lists"`
 	// tags: tags to use for tag-based matching
 	Tags *[]string `yaml:"tags"`
+	// mode: "enforce" or "audit", all of the lists in an audit group only record block matches
+	Mode string `yaml:"mode"`
+	// schedule: when the group applies, a group with no schedule always applies
+	Schedule *GudgeonSchedule `yaml:"schedule"`
+	// rebinding: dns rebinding protection for the group, overrides the network setting
+	Rebinding *GudgeonRebinding `yaml:"rebinding"`
+	// query_types: policies for query types, the first policy (of the first group) that has the type of the query applies
+	QueryTypes []*GudgeonQueryTypePolicy `yaml:"query_types"`
+	// safe_search: answer search engine names with the safe search endpoints of the search engines
+	SafeSearch *GudgeonSafeSearch `yaml:"safe_search"`
+	// rewrites: rewrite rules for the group in the same format as the lines of a rewrite list
+	Rewrites []string `yaml:"rewrites"`
+}
+
+const (
+	SafeSearchGoogle     = "google"
+	SafeSearchBing       = "bing"
+	SafeSearchDuckDuckGo = "duckduckgo"
+	SafeSearchYouTube    = "youtube"
+
+	// the youtube restriction levels
+	YouTubeStrict   = "strict"
+	YouTubeModerate = "moderate"
+)
+
+// all of the search engines with built in safe search rewrites
+var SafeSearchEngines = []string{SafeSearchGoogle, SafeSearchBing, SafeSearchDuckDuckGo, SafeSearchYouTube}
+
+// safe search enforcement for a group
+type GudgeonSafeSearch struct {
+	// enabled: rewrite search engine names (default: true)
+	Enabled *bool `yaml:"enabled"`
+	// engines: the search engines to rewrite (default: all of them)
+	Engines []string `yaml:"engines"`
+	// youtube: "strict" (default) or "moderate"
+	YouTube string `yaml:"youtube"`
+	// file: a file of additional rewrites, each line is a domain followed by the name or address to answer with
+	File string `yaml:"file"`
+}
+
+// if search engine names should be rewritten
+func (safeSearch *GudgeonSafeSearch) Active() bool {
+	return safeSearch != nil && safeSearch.Enabled != nil && *safeSearch.Enabled
+}
+
+const (
+	// queries of the type are answered with NXDOMAIN
+	QueryTypeBlock = "block"
+	// queries of the type are answered with REFUSED
+	QueryTypeRefuse = "refuse"
+	// queries of the type are answered with no records (NOERROR/NODATA)
+	QueryTypeEmpty = "empty"
+	// ANY queries are answered with a single HINFO record as described in RFC 8482
+	QueryTypeMinimal = "minimal"
+)
+
+// a policy for queries with one of the given types
+type GudgeonQueryTypePolicy struct {
+	// types: query type names like "TXT" or "ANY", or "TYPE" followed by the number of the type
+	Types []string `yaml:"types"`
+	// action: "block" (default), "refuse", "empty", or "minimal" (only for ANY)
+	Action string `yaml:"action"`
+
+	// the parsed query types
+	qTypes map[uint16]bool
+}
+
+// if the policy applies to queries of the given type
+func (policy *GudgeonQueryTypePolicy) Matches(qType uint16) bool {
+	return policy != nil && policy.qTypes[qType]
+}
+
+// an audit group records block matches from its lists without blocking the query
+func (group *GudgeonGroup) IsAudit() bool {
+	return group != nil && ModeAudit == group.Mode
 }
 
 func (list *GudgeonGroup) SafeTags() []string {
@@ -246,6 +597,21 @@ type GudgeonMatch struct {
 	IP    string             `yaml:"ip"`
 	Range *GudgeonMatchRange `yaml:"range"`
 	Net   string             `yaml:"net"`
+	// mac: hardware address of the client, found from the arp/neighbor table of the host or from a forwarder
+	MAC string `yaml:"mac"`
+	// cpe_id: the customer premises equipment id that a forwarder adds to the query
+	CpeID string `yaml:"cpe_id"`
+	// hostname: name (or pattern like "*.kids.lan") matched against the reverse lookup of the client address
+	Hostname string `yaml:"hostname"`
+	// all: the match only applies when every one of these matches also applies
+	All []*GudgeonMatch `yaml:"all"`
+	// not: the match never applies when any of these match
+	Not []*GudgeonMatch `yaml:"not"`
+}
+
+// a simple match only compares the client address, mac, or cpe id and has no hostname or composite parts
+func (match *GudgeonMatch) IsSimple() bool {
+	return match != nil && "" == match.Hostname && len(match.All) < 1 && len(match.Not) < 1
 }
 
 type GudgeonConsumer struct {
@@ -253,6 +619,18 @@ type GudgeonConsumer struct {
 	Block   bool            `yaml:"block"`
 	Groups  []string        `yaml:"groups"`
 	Matches []*GudgeonMatch `yaml:"matches"`
+	// groups that are only added to the consumer at certain times
+	Schedules []*GudgeonConsumerSchedule `yaml:"schedules"`
+	// limit on queries from all clients of the consumer together
+	RateLimit *GudgeonRateLimit `yaml:"rate_limit"`
+	// limit on queries from each client address of the consumer
+	ClientRateLimit *GudgeonRateLimit `yaml:"client_rate_limit"`
+}
+
+// options that apply to all downloads
+type GudgeonDownload struct {
+	// default http, https, or socks5 proxy url used for downloading lists, if empty the environment (HTTP_PROXY, HTTPS_PROXY, NO_PROXY) is used
+	Proxy string `yaml:"proxy"`
 }
 
 type GudgeonWeb struct {
@@ -270,11 +648,15 @@ type GudgeonConfig struct {
 	QueryLog  *GudgeonQueryLog   `yaml:"query_log"`
 	Network   *GudgeonNetwork    `yaml:"network"`
 	Web       *GudgeonWeb        `yaml:"web"`
+	Download  *GudgeonDownload   `yaml:"download"`
 	Sources   []*GudgeonSource   `yaml:"sources"`
 	Resolvers []*GudgeonResolver `yaml:"resolvers"`
 	Lists     []*GudgeonList     `yaml:"lists"`
 	Groups    []*GudgeonGroup    `yaml:"groups"`
 	Consumers []*GudgeonConsumer `yaml:"consumers"`
+	TsigKeys  []*GudgeonTsigKey  `yaml:"tsig_keys"`
+	Transfers []*GudgeonTransfer `yaml:"transfers"`
+	Updates   []*GudgeonUpdate   `yaml:"updates"`
 
 	// private values
 	sourceMap   map[string]*GudgeonSource
@@ -282,6 +664,7 @@ type GudgeonConfig struct {
 	listMap     map[string]*GudgeonList
 	groupMap    map[string]*GudgeonGroup
 	consumerMap map[string]*GudgeonConsumer
+	tsigKeyMap  map[string]*GudgeonTsigKey
 }
 
 func (config *GudgeonConfig) GetResolver(name string) *GudgeonResolver {
@@ -312,6 +695,44 @@ func (config *GudgeonConfig) GetConsumer(name string) *GudgeonConsumer {
 	return nil
 }
 
+func (config *GudgeonConfig) GetTsigKey(name string) *GudgeonTsigKey {
+	if value, found := config.tsigKeyMap[dns.Fqdn(strings.ToLower(name))]; found {
+		return value
+	}
+	return nil
+}
+
+// the transfer configuration for the zone or nil if the zone is not transferred
+func (config *GudgeonConfig) GetTransfer(zone string) *GudgeonTransfer {
+	zone = dns.Fqdn(strings.ToLower(zone))
+	for _, transfer := range config.Transfers {
+		if transfer != nil && transfer.Zone == zone {
+			return transfer
+		}
+	}
+	return nil
+}
+
+// the dynamic update configuration for the zone or nil if the zone can't be updated
+func (config *GudgeonConfig) GetUpdate(zone string) *GudgeonUpdate {
+	zone = dns.Fqdn(strings.ToLower(zone))
+	for _, update := range config.Updates {
+		if update != nil && update.Zone == zone {
+			return update
+		}
+	}
+	return nil
+}
+
+// the secrets of the tsig keys by key name, used to check and sign messages
+func (config *GudgeonConfig) TsigSecrets() map[string]string {
+	secrets := make(map[string]string, len(config.tsigKeyMap))
+	for name, key := range config.tsigKeyMap {
+		secrets[name] = key.secret
+	}
+	return secrets
+}
+
 type GudgeonRoot struct {
 	Config *GudgeonConfig `yaml:"gudgeon"`
 }
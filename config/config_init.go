@@ -1,13 +1,21 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"os"
 	"os/user"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/miekg/dns"
+
 	"github.com/chrisruffalo/gudgeon/util"
 )
 
@@ -30,6 +38,7 @@ func (config *GudgeonConfig) verifyAndInit() ([]string, []error) {
 	config.listMap = make(map[string]*GudgeonList, 0)
 	config.consumerMap = make(map[string]*GudgeonConsumer, 0)
 	config.groupMap = make(map[string]*GudgeonGroup, 0)
+	config.tsigKeyMap = make(map[string]*GudgeonTsigKey, 0)
 
 	// set home dir
 	if "" == config.Home {
@@ -82,6 +91,14 @@ func (config *GudgeonConfig) verifyAndInit() ([]string, []error) {
 	errors = append(errors, err...)
 	warnings = append(warnings, warn...)
 
+	// download options
+	if config.Download == nil {
+		config.Download = &GudgeonDownload{}
+	}
+	warn, err = config.Download.verifyAndInit()
+	errors = append(errors, err...)
+	warnings = append(warnings, warn...)
+
 	if config.Database == nil {
 		config.Database = &GudgeonDatabase{Flush: "1s"}
 	}
@@ -128,6 +145,11 @@ func (config *GudgeonConfig) verifyAndInit() ([]string, []error) {
 	errors = append(errors, err...)
 	warnings = append(warnings, warn...)
 
+	// zone transfers and updates and the keys that sign them
+	warn, err = config.verifyAndInitTransfers()
+	errors = append(errors, err...)
+	warnings = append(warnings, warn...)
+
 	return warnings, errors
 }
 
@@ -152,6 +174,31 @@ func (web *GudgeonWeb) verifyAndInit() ([]string, []error) {
 	return []string{}, []error{}
 }
 
+func (download *GudgeonDownload) verifyAndInit() ([]string, []error) {
+	errors := make([]error, 0)
+
+	if err := verifyProxy(download.Proxy); err != nil {
+		errors = append(errors, fmt.Errorf("Default download proxy: %s", err))
+	}
+
+	return []string{}, errors
+}
+
+// checks that a proxy is empty, explicitly disabled, or a url with a supported scheme
+func verifyProxy(proxy string) error {
+	if "" == proxy || NoProxy == strings.ToLower(proxy) {
+		return nil
+	}
+	parsed, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Errorf("could not parse proxy url '%s': %s", proxy, err)
+	}
+	if !util.StringIn(strings.ToLower(parsed.Scheme), proxyProtocols) || "" == parsed.Host {
+		return fmt.Errorf("proxy url '%s' must have a host and one of the schemes: %s", proxy, strings.Join(proxyProtocols, ", "))
+	}
+	return nil
+}
+
 func (network *GudgeonNetwork) verifyAndInit() ([]string, []error) {
 	// set default values for tcp and udp if nil
 	if network.TCP == nil {
@@ -171,7 +218,51 @@ func (network *GudgeonNetwork) verifyAndInit() ([]string, []error) {
 		}
 	}
 
-	return []string{}, []error{}
+	errors := make([]error, 0)
+	if err := network.ClientRateLimit.verifyAndInit(); err != nil {
+		errors = append(errors, fmt.Errorf("Network client rate limit: %s", err))
+	}
+	if err := network.Rebinding.verifyAndInit(); err != nil {
+		errors = append(errors, fmt.Errorf("Network rebinding: %s", err))
+	}
+
+	if identity := network.ClientIdentity; identity != nil {
+		if identity.Strip == nil {
+			identity.Strip = boolPointer(true)
+		}
+		var invalid []string
+		identity.trustedNets, invalid = parseNetworks(identity.Trusted)
+		for _, trusted := range invalid {
+			errors = append(errors, fmt.Errorf("Client identity: trusted forwarder '%s' is not an ip or network", trusted))
+		}
+		// any client could choose its own address (and get around rate limits) if every source was trusted
+		if identity.Enabled && len(identity.Trusted) < 1 {
+			errors = append(errors, fmt.Errorf("Client identity: enabled without any trusted forwarders"))
+		}
+	}
+
+	return []string{}, errors
+}
+
+// parse ips and networks into networks, single addresses are a network of one. the values that are neither are
+// returned separately.
+func parseNetworks(values []string) ([]*net.IPNet, []string) {
+	nets := make([]*net.IPNet, 0, len(values))
+	invalid := make([]string, 0)
+	for _, value := range values {
+		if ip := net.ParseIP(value); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		} else if _, parsed, err := net.ParseCIDR(value); err == nil {
+			nets = append(nets, parsed)
+		} else {
+			invalid = append(invalid, value)
+		}
+	}
+	return nets, invalid
 }
 
 func (database *GudgeonDatabase) verifyAndInit() ([]string, []error) {
@@ -302,8 +393,9 @@ func (ql *GudgeonQueryLog) verifyAndInit() ([]string, []error) {
 
 // verify all the groups at once and set the groupMap
 func (config *GudgeonConfig) verifyAndInitGroups() ([]string, []error) {
-	// collect warnings
+	// collect warnings and errors
 	warnings := make([]string, 0)
+	errors := make([]error, 0)
 
 	// add groups to group map
 	for _, group := range config.Groups {
@@ -316,6 +408,38 @@ func (config *GudgeonConfig) verifyAndInitGroups() ([]string, []error) {
 		}
 		group.Name = strings.ToLower(group.Name)
 
+		if mode, err := verifyMode(group.Mode); err != nil {
+			errors = append(errors, fmt.Errorf("Group '%s': %s", group.Name, err))
+		} else {
+			group.Mode = mode
+		}
+
+		if group.Schedule != nil {
+			if err := group.Schedule.verifyAndInit(); err != nil {
+				errors = append(errors, fmt.Errorf("Group '%s': schedule %s", group.Name, err))
+			}
+		}
+
+		if err := group.Rebinding.verifyAndInit(); err != nil {
+			errors = append(errors, fmt.Errorf("Group '%s': rebinding %s", group.Name, err))
+		}
+
+		if err := group.SafeSearch.verifyAndInit(); err != nil {
+			errors = append(errors, fmt.Errorf("Group '%s': safe search %s", group.Name, err))
+		}
+
+		for _, line := range group.Rewrites {
+			if _, _, err := util.ParseRewrite(line); err != nil {
+				errors = append(errors, fmt.Errorf("Group '%s': rewrite '%s' %s", group.Name, line, err))
+			}
+		}
+
+		for _, policy := range group.QueryTypes {
+			if err := policy.verifyAndInit(); err != nil {
+				errors = append(errors, fmt.Errorf("Group '%s': query types %s", group.Name, err))
+			}
+		}
+
 		if _, found := config.groupMap[group.Name]; found {
 			warnings = append(warnings, "More than one group was found with the name '%s', group names are case insensitive and must be unique.", group.Name)
 			continue
@@ -334,13 +458,26 @@ func (config *GudgeonConfig) verifyAndInitGroups() ([]string, []error) {
 		config.groupMap[defaultString] = defaultGroup
 	}
 
-	return warnings, []error{}
+	return warnings, errors
+}
+
+// checks that a mode is "enforce" or "audit" and returns the canonical mode, an empty mode is "enforce"
+func verifyMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if "" == mode {
+		return ModeEnforce, nil
+	}
+	if ModeEnforce != mode && ModeAudit != mode {
+		return mode, fmt.Errorf("mode '%s' must be '%s' or '%s'", mode, ModeEnforce, ModeAudit)
+	}
+	return mode, nil
 }
 
 // verify all consumers at once, add a default consumer if needed, and set the group map
 func (config *GudgeonConfig) verifyAndInitConsumers() ([]string, []error) {
-	// collect warnings
+	// collect warnings and errors
 	warnings := make([]string, 0)
+	errors := make([]error, 0)
 
 	for _, consumer := range config.Consumers {
 		if consumer == nil {
@@ -352,6 +489,29 @@ func (config *GudgeonConfig) verifyAndInitConsumers() ([]string, []error) {
 		}
 		consumer.Name = strings.ToLower(consumer.Name)
 
+		for _, match := range consumer.Matches {
+			errors = append(errors, verifyMatch(consumer.Name, match)...)
+		}
+
+		if err := consumer.RateLimit.verifyAndInit(); err != nil {
+			errors = append(errors, fmt.Errorf("Consumer '%s': rate limit %s", consumer.Name, err))
+		}
+		if err := consumer.ClientRateLimit.verifyAndInit(); err != nil {
+			errors = append(errors, fmt.Errorf("Consumer '%s': client rate limit %s", consumer.Name, err))
+		}
+
+		for _, schedule := range consumer.Schedules {
+			if schedule == nil {
+				continue
+			}
+			if len(schedule.Groups) < 1 {
+				warnings = append(warnings, fmt.Sprintf("Consumer '%s' has a schedule with no groups, the schedule will have no effect.", consumer.Name))
+			}
+			if err := schedule.verifyAndInit(); err != nil {
+				errors = append(errors, fmt.Errorf("Consumer '%s': schedule %s", consumer.Name, err))
+			}
+		}
+
 		if _, found := config.consumerMap[consumer.Name]; found {
 			warnings = append(warnings, "More than one consumer was found with the name '%s', consumer names are case insensitive and must be unique.", consumer.Name)
 			continue
@@ -368,7 +528,148 @@ func (config *GudgeonConfig) verifyAndInitConsumers() ([]string, []error) {
 		config.consumerMap[defaultString] = defaultConsumer
 	}
 
-	return warnings, []error{}
+	return warnings, errors
+}
+
+// enables the protection when it is configured, checks the action, and normalizes the allowed domains
+func (rebinding *GudgeonRebinding) verifyAndInit() error {
+	if rebinding == nil {
+		return nil
+	}
+	if rebinding.Enabled == nil {
+		rebinding.Enabled = boolPointer(true)
+	}
+	rebinding.Action = strings.ToLower(strings.TrimSpace(rebinding.Action))
+	if "" == rebinding.Action {
+		rebinding.Action = RebindingBlock
+	}
+	if RebindingBlock != rebinding.Action && RebindingStrip != rebinding.Action {
+		return fmt.Errorf("action '%s' must be '%s' or '%s'", rebinding.Action, RebindingBlock, RebindingStrip)
+	}
+	for idx, allowed := range rebinding.Allow {
+		rebinding.Allow[idx] = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(allowed), "."))
+	}
+	return nil
+}
+
+// enables safe search when it is configured and checks the engines and youtube restriction level
+func (safeSearch *GudgeonSafeSearch) verifyAndInit() error {
+	if safeSearch == nil {
+		return nil
+	}
+	if safeSearch.Enabled == nil {
+		safeSearch.Enabled = boolPointer(true)
+	}
+	if len(safeSearch.Engines) < 1 {
+		safeSearch.Engines = append([]string{}, SafeSearchEngines...)
+	}
+	for idx, engine := range safeSearch.Engines {
+		engine = strings.ToLower(strings.TrimSpace(engine))
+		if !util.StringIn(engine, SafeSearchEngines) {
+			return fmt.Errorf("engine '%s' must be one of %s", engine, strings.Join(SafeSearchEngines, ", "))
+		}
+		safeSearch.Engines[idx] = engine
+	}
+	safeSearch.YouTube = strings.ToLower(strings.TrimSpace(safeSearch.YouTube))
+	if "" == safeSearch.YouTube {
+		safeSearch.YouTube = YouTubeStrict
+	}
+	if YouTubeStrict != safeSearch.YouTube && YouTubeModerate != safeSearch.YouTube {
+		return fmt.Errorf("youtube '%s' must be '%s' or '%s'", safeSearch.YouTube, YouTubeStrict, YouTubeModerate)
+	}
+	return nil
+}
+
+// parses the query types and checks the action of the policy
+func (policy *GudgeonQueryTypePolicy) verifyAndInit() error {
+	if policy == nil {
+		return nil
+	}
+	policy.Action = strings.ToLower(strings.TrimSpace(policy.Action))
+	if "" == policy.Action {
+		policy.Action = QueryTypeBlock
+	}
+	if QueryTypeBlock != policy.Action && QueryTypeRefuse != policy.Action && QueryTypeEmpty != policy.Action && QueryTypeMinimal != policy.Action {
+		return fmt.Errorf("action '%s' must be '%s', '%s', '%s', or '%s'", policy.Action, QueryTypeBlock, QueryTypeRefuse, QueryTypeEmpty, QueryTypeMinimal)
+	}
+	if len(policy.Types) < 1 {
+		return fmt.Errorf("policy with action '%s' has no types", policy.Action)
+	}
+
+	policy.qTypes = make(map[uint16]bool, len(policy.Types))
+	for _, name := range policy.Types {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		qType, found := dns.StringToType[name]
+		if !found && strings.HasPrefix(name, "TYPE") {
+			if number, err := strconv.ParseUint(name[len("TYPE"):], 10, 16); err == nil {
+				qType, found = uint16(number), true
+			}
+		}
+		if !found {
+			return fmt.Errorf("type '%s' is not a query type", name)
+		}
+		if QueryTypeMinimal == policy.Action && dns.TypeANY != qType {
+			return fmt.Errorf("action '%s' only applies to ANY but has type '%s'", QueryTypeMinimal, name)
+		}
+		policy.qTypes[qType] = true
+	}
+	return nil
+}
+
+// checks the rate and action of a limit and sets the default burst and action
+func (limit *GudgeonRateLimit) verifyAndInit() error {
+	if limit == nil {
+		return nil
+	}
+	if limit.Rate <= 0 {
+		return fmt.Errorf("rate must be greater than zero")
+	}
+	if limit.Burst < 0 {
+		return fmt.Errorf("burst can't be negative")
+	}
+	if limit.Burst == 0 {
+		limit.Burst = int(math.Ceil(limit.Rate))
+	}
+	limit.Action = strings.ToLower(strings.TrimSpace(limit.Action))
+	if "" == limit.Action {
+		limit.Action = RateLimitRefuse
+	}
+	if RateLimitRefuse != limit.Action && RateLimitDrop != limit.Action {
+		return fmt.Errorf("action '%s' must be '%s' or '%s'", limit.Action, RateLimitRefuse, RateLimitDrop)
+	}
+	return nil
+}
+
+// verify a consumer match and the matches nested inside of it
+func verifyMatch(consumerName string, match *GudgeonMatch) []error {
+	errors := make([]error, 0)
+	if match == nil {
+		return errors
+	}
+
+	if "" != match.MAC {
+		if mac := util.NormalizeMAC(match.MAC); "" != mac {
+			match.MAC = mac
+		} else {
+			errors = append(errors, fmt.Errorf("Consumer '%s': mac '%s' is not a valid MAC address", consumerName, match.MAC))
+		}
+	}
+
+	if "" != match.Hostname {
+		match.Hostname = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(match.Hostname), "."))
+		if _, err := path.Match(match.Hostname, ""); err != nil {
+			errors = append(errors, fmt.Errorf("Consumer '%s': hostname '%s' is not a valid pattern", consumerName, match.Hostname))
+		}
+	}
+
+	for _, all := range match.All {
+		errors = append(errors, verifyMatch(consumerName, all)...)
+	}
+	for _, not := range match.Not {
+		errors = append(errors, verifyMatch(consumerName, not)...)
+	}
+
+	return errors
 }
 
 func (config *GudgeonConfig) verifyAndInitSources() ([]string, []error) {
@@ -460,8 +761,9 @@ func (config *GudgeonConfig) verifyAndInitResolvers() ([]string, []error) {
 }
 
 func (config *GudgeonConfig) verifyAndInitLists() ([]string, []error) {
-	// collect warnings
+	// collect warnings and errors
 	warnings := make([]string, 0)
+	errors := make([]error, 0)
 
 	for _, list := range config.Lists {
 		if list == nil {
@@ -479,10 +781,34 @@ func (config *GudgeonConfig) verifyAndInitLists() ([]string, []error) {
 		// verify/init individual list
 		list.VerifyAndInit()
 
+		// download options only make sense for remote lists
+		if !list.IsRemote() && (len(list.Headers) > 0 || list.Auth != nil || list.TLS != nil || "" != list.Proxy) {
+			warnings = append(warnings, fmt.Sprintf("The list '%s' is not remote, download options (headers, auth, tls, proxy) will not be used.", list.CanonicalName()))
+		}
+		if mode, err := verifyMode(list.Mode); err != nil {
+			errors = append(errors, fmt.Errorf("List '%s': %s", list.CanonicalName(), err))
+		} else {
+			list.Mode = mode
+		}
+		if err := verifyProxy(list.Proxy); err != nil {
+			errors = append(errors, fmt.Errorf("List '%s': %s", list.CanonicalName(), err))
+		}
+		if TargetDomain != list.Target && TargetIP != list.Target {
+			errors = append(errors, fmt.Errorf("List '%s': target '%s' must be '%s' or '%s'", list.CanonicalName(), list.Target, TargetDomain, TargetIP))
+		} else if list.IsIP() && (list.IsManifest() || list.IsRewrite() || *list.Regex) {
+			errors = append(errors, fmt.Errorf("List '%s': an ip list can't be a manifest, rewrite, or regex list", list.CanonicalName()))
+		}
+		if list.IsRewrite() && *list.Regex {
+			errors = append(errors, fmt.Errorf("List '%s': a rewrite list can't be a regex list", list.CanonicalName()))
+		}
+		if list.TLS != nil && (("" == list.TLS.Cert) != ("" == list.TLS.Key)) {
+			errors = append(errors, fmt.Errorf("List '%s': a client certificate requires both 'cert' and 'key'", list.CanonicalName()))
+		}
+
 		config.listMap[list.CanonicalName()] = list
 	}
 
-	return warnings, []error{}
+	return warnings, errors
 }
 
 func (list *GudgeonList) VerifyAndInit() {
@@ -499,13 +825,136 @@ func (list *GudgeonList) VerifyAndInit() {
 		list.Regex = boolPointer(false)
 	}
 
-	// canonical and pre-paresed values for allow/block
+	// canonical and pre-paresed values for allow/block/manifest
 	if strings.EqualFold(string(ALLOWSTRING), list.Type) {
+		list.Type = string(ALLOWSTRING)
 		list.parsedType = ALLOW
+	} else if strings.EqualFold(string(MANIFESTSTRING), list.Type) {
+		list.Type = string(MANIFESTSTRING)
+		list.parsedType = MANIFEST
+	} else if strings.EqualFold(string(REWRITESTRING), list.Type) {
+		list.Type = string(REWRITESTRING)
+		list.parsedType = REWRITE
 	} else {
 		list.Type = string(BLOCKSTRING)
 		list.parsedType = BLOCK
 	}
 
+	list.Target = strings.ToLower(strings.TrimSpace(list.Target))
+	if "" == list.Target {
+		list.Target = TargetDomain
+	}
+
 	list.Name = strings.ToLower(list.Name)
 }
+
+// the algorithms that tsig keys can use by configured name
+var tsigAlgorithms = map[string]string{
+	"hmac-md5":    dns.HmacMD5,
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+func (key *GudgeonTsigKey) verifyAndInit() error {
+	if "" == strings.TrimSpace(key.Name) {
+		return fmt.Errorf("a key must have a name")
+	}
+	if "" == key.Algorithm {
+		key.Algorithm = "hmac-sha256"
+	}
+	algorithm, found := tsigAlgorithms[strings.ToLower(strings.TrimSuffix(key.Algorithm, "."))]
+	if !found {
+		return fmt.Errorf("algorithm '%s' must be one of 'hmac-sha256', 'hmac-sha512', 'hmac-sha1', or 'hmac-md5'", key.Algorithm)
+	}
+	key.algorithm = algorithm
+	key.secret = os.ExpandEnv(key.Secret)
+	if decoded, err := base64.StdEncoding.DecodeString(key.secret); err != nil || len(decoded) < 1 {
+		return fmt.Errorf("secret must be base64 encoded")
+	}
+	return nil
+}
+
+func (config *GudgeonConfig) verifyAndInitTransfers() ([]string, []error) {
+	errors := make([]error, 0)
+
+	for _, key := range config.TsigKeys {
+		if key == nil {
+			continue
+		}
+		if err := key.verifyAndInit(); err != nil {
+			errors = append(errors, fmt.Errorf("TSIG key '%s': %s", key.Name, err))
+			continue
+		}
+		if _, found := config.tsigKeyMap[key.Fqdn()]; found {
+			errors = append(errors, fmt.Errorf("TSIG key '%s': key names are case insensitive and must be unique", key.Name))
+			continue
+		}
+		config.tsigKeyMap[key.Fqdn()] = key
+	}
+
+	for _, transfer := range config.Transfers {
+		if transfer == nil {
+			continue
+		}
+		if "" == strings.TrimSpace(transfer.Zone) {
+			errors = append(errors, fmt.Errorf("Transfer: a transfer must have a zone"))
+			continue
+		}
+		transfer.Zone = dns.Fqdn(strings.ToLower(strings.TrimSpace(transfer.Zone)))
+
+		// without an address or a key anybody could read the zone
+		var accessErrors []error
+		transfer.allowNets, accessErrors = config.verifyZoneAccess(transfer.Allow, transfer.Key)
+		for _, err := range accessErrors {
+			errors = append(errors, fmt.Errorf("Transfer '%s': %s", transfer.Zone, err))
+		}
+
+		transfer.notifyTargets = make([]string, 0, len(transfer.Notify))
+		for _, target := range transfer.Notify {
+			if ip := net.ParseIP(target); ip != nil {
+				transfer.notifyTargets = append(transfer.notifyTargets, net.JoinHostPort(ip.String(), "53"))
+			} else if host, port, err := net.SplitHostPort(target); err == nil && net.ParseIP(host) != nil && "" != port {
+				transfer.notifyTargets = append(transfer.notifyTargets, target)
+			} else {
+				errors = append(errors, fmt.Errorf("Transfer '%s': notify target '%s' must be an ip or ip:port", transfer.Zone, target))
+			}
+		}
+	}
+
+	for _, update := range config.Updates {
+		if update == nil {
+			continue
+		}
+		if "" == strings.TrimSpace(update.Zone) {
+			errors = append(errors, fmt.Errorf("Update: an update must have a zone"))
+			continue
+		}
+		update.Zone = dns.Fqdn(strings.ToLower(strings.TrimSpace(update.Zone)))
+
+		// without an address or a key anybody could change the zone
+		var accessErrors []error
+		update.allowNets, accessErrors = config.verifyZoneAccess(update.Allow, update.Key)
+		for _, err := range accessErrors {
+			errors = append(errors, fmt.Errorf("Update '%s': %s", update.Zone, err))
+		}
+	}
+
+	return []string{}, errors
+}
+
+// check that access to a zone is restricted to the allowed addresses, a tsig key, or both
+func (config *GudgeonConfig) verifyZoneAccess(allow []string, key string) ([]*net.IPNet, []error) {
+	errors := make([]error, 0)
+	if len(allow) < 1 && "" == key {
+		errors = append(errors, fmt.Errorf("access must be restricted with 'allow' or 'key'"))
+	}
+	if "" != key && config.GetTsigKey(key) == nil {
+		errors = append(errors, fmt.Errorf("key '%s' is not a configured tsig key", key))
+	}
+	nets, invalid := parseNetworks(allow)
+	for _, allowed := range invalid {
+		errors = append(errors, fmt.Errorf("allowed address '%s' is not an ip or network", allowed))
+	}
+	return nets, errors
+}
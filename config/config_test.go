@@ -1,7 +1,12 @@
 package config
 
 import (
+	"net"
+	"os"
+	"strings"
 	"testing"
+
+	"github.com/miekg/dns"
 )
 
 func TestLoad(t *testing.T) {
@@ -29,3 +34,201 @@ func TestLoad(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadBadProxy(t *testing.T) {
+	_, _, err := Load("testdata/badproxy.yml")
+	if err == nil {
+		t.Errorf("Expected errors loading configuration with bad proxy and tls settings")
+		return
+	}
+
+	for _, expected := range []string{"Default download proxy", "List 'feed': proxy url", "requires both 'cert' and 'key'"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing '%s' but got: %s", expected, err)
+		}
+	}
+}
+
+func TestLoadBadMode(t *testing.T) {
+	_, _, err := Load("testdata/badmode.yml")
+	if err == nil {
+		t.Errorf("Expected errors loading configuration with bad list and group modes")
+		return
+	}
+
+	for _, expected := range []string{"List 'trial': mode 'observe'", "Group 'watch': mode 'log'"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing '%s' but got: %s", expected, err)
+		}
+	}
+}
+
+func TestVerifyNestedMatches(t *testing.T) {
+	match := &GudgeonMatch{
+		Net: "10.0.0.0/8",
+		Not: []*GudgeonMatch{{MAC: "AA-BB-CC-00-11-22"}, {Hostname: "Printer.Lan."}},
+		All: []*GudgeonMatch{{MAC: "not a mac"}, {Hostname: "[kids"}},
+	}
+
+	errors := verifyMatch("kids", match)
+	if len(errors) != 2 {
+		t.Errorf("Expected 2 errors from nested matches but got %d: %v", len(errors), errors)
+	}
+	if "aa:bb:cc:00:11:22" != match.Not[0].MAC || "printer.lan" != match.Not[1].Hostname {
+		t.Errorf("Expected nested matches to be normalized but got '%s' and '%s'", match.Not[0].MAC, match.Not[1].Hostname)
+	}
+}
+
+func TestVerifyRateLimit(t *testing.T) {
+	limit := &GudgeonRateLimit{Rate: 2.5, Action: "DROP"}
+	if err := limit.verifyAndInit(); err != nil {
+		t.Errorf("Unexpected error verifying rate limit: %s", err)
+	}
+	if limit.Burst != 3 || !limit.Drops() {
+		t.Errorf("Expected burst of 3 that drops queries but got burst %d and action '%s'", limit.Burst, limit.Action)
+	}
+
+	for _, bad := range []*GudgeonRateLimit{{Rate: 0}, {Rate: 1, Burst: -1}, {Rate: 1, Action: "ignore"}} {
+		if err := bad.verifyAndInit(); err == nil {
+			t.Errorf("Expected error verifying rate limit %v", bad)
+		}
+	}
+}
+
+func TestVerifyRebinding(t *testing.T) {
+	rebinding := &GudgeonRebinding{Action: "STRIP", Allow: []string{" Corp.Example.com. "}}
+	if err := rebinding.verifyAndInit(); err != nil {
+		t.Errorf("Unexpected error verifying rebinding: %s", err)
+	}
+	if !rebinding.Active() || !rebinding.Strips() || !rebinding.Allows("git.corp.example.com.") || rebinding.Allows("example.com.") {
+		t.Errorf("Expected active rebinding protection that strips and allows corp.example.com but got %v", rebinding)
+	}
+
+	if err := (&GudgeonRebinding{Action: "ignore"}).verifyAndInit(); err == nil {
+		t.Errorf("Expected error verifying rebinding with unknown action")
+	}
+}
+
+func TestVerifyClientIdentity(t *testing.T) {
+	network := &GudgeonNetwork{ClientIdentity: &GudgeonClientIdentity{Enabled: true, Trusted: []string{"192.168.0.1", "10.10.0.0/16"}}}
+	if _, errs := network.verifyAndInit(); len(errs) > 0 {
+		t.Errorf("Unexpected errors verifying client identity: %v", errs)
+	}
+	if !network.ClientIdentity.Trusts(net.ParseIP("10.10.4.5")) || network.ClientIdentity.Trusts(net.ParseIP("192.168.0.2")) {
+		t.Errorf("Expected only the listed forwarders to be trusted")
+	}
+
+	// without any trusted forwarders nobody is trusted
+	untrusted := &GudgeonNetwork{ClientIdentity: &GudgeonClientIdentity{Enabled: true}}
+	if _, errs := untrusted.verifyAndInit(); len(errs) != 1 {
+		t.Errorf("Expected an error verifying client identity without trusted forwarders but got %v", errs)
+	}
+	if untrusted.ClientIdentity.Trusts(net.ParseIP("192.168.0.1")) {
+		t.Errorf("Expected no forwarder to be trusted when none are listed")
+	}
+}
+
+func TestVerifyQueryTypePolicy(t *testing.T) {
+	policy := &GudgeonQueryTypePolicy{Types: []string{"txt", "TYPE65"}}
+	if err := policy.verifyAndInit(); err != nil {
+		t.Errorf("Unexpected error verifying query type policy: %s", err)
+	}
+	if QueryTypeBlock != policy.Action || !policy.Matches(dns.TypeTXT) || !policy.Matches(65) || policy.Matches(dns.TypeA) {
+		t.Errorf("Expected a policy that blocks TXT and TYPE65 but got %v", policy)
+	}
+
+	for _, bad := range []*GudgeonQueryTypePolicy{{}, {Types: []string{"NOTATYPE"}}, {Types: []string{"TXT"}, Action: "minimal"}, {Types: []string{"ANY"}, Action: "ignore"}} {
+		if err := bad.verifyAndInit(); err == nil {
+			t.Errorf("Expected error verifying query type policy %v", bad)
+		}
+	}
+}
+
+func TestVerifySafeSearch(t *testing.T) {
+	safeSearch := &GudgeonSafeSearch{}
+	if err := safeSearch.verifyAndInit(); err != nil {
+		t.Errorf("Unexpected error verifying safe search: %s", err)
+	}
+	if !safeSearch.Active() || len(safeSearch.Engines) != len(SafeSearchEngines) || YouTubeStrict != safeSearch.YouTube {
+		t.Errorf("Expected active safe search for all engines with strict youtube but got %v", safeSearch)
+	}
+
+	for _, bad := range []*GudgeonSafeSearch{{Engines: []string{"altavista"}}, {YouTube: "lenient"}} {
+		if err := bad.verifyAndInit(); err == nil {
+			t.Errorf("Expected error verifying safe search %v", bad)
+		}
+	}
+}
+
+func TestRewriteList(t *testing.T) {
+	list := &GudgeonList{Name: "Office", Type: "Rewrite", Source: "office.list"}
+	list.VerifyAndInit()
+	if !list.IsRewrite() || string(REWRITESTRING) != list.Type || list.IsIP() {
+		t.Errorf("Expected a rewrite list but got type '%s'", list.Type)
+	}
+}
+
+func TestVerifyTransfers(t *testing.T) {
+	os.Setenv("GUDGEON_TEST_TSIG", "c2VjcmV0LXNlY3JldC1zZWNyZXQ=")
+	defer os.Unsetenv("GUDGEON_TEST_TSIG")
+
+	config := &GudgeonConfig{
+		tsigKeyMap: make(map[string]*GudgeonTsigKey),
+		TsigKeys:   []*GudgeonTsigKey{{Name: "Transfer-Key", Secret: "${GUDGEON_TEST_TSIG}"}},
+		Transfers: []*GudgeonTransfer{
+			{Zone: "Example.Corp", Allow: []string{"10.0.0.3", "10.0.1.0/24"}, Key: "transfer-key.", Notify: []string{"10.0.0.3", "10.0.0.4:5353"}},
+		},
+	}
+	if _, errs := config.verifyAndInitTransfers(); len(errs) > 0 {
+		t.Errorf("Unexpected errors verifying transfers: %v", errs)
+	}
+
+	key := config.GetTsigKey("transfer-key")
+	if key == nil || dns.HmacSHA256 != key.AlgorithmName() || "c2VjcmV0LXNlY3JldC1zZWNyZXQ=" != config.TsigSecrets()["transfer-key."] {
+		t.Errorf("Expected an hmac-sha256 key with the secret from the environment but got %v", key)
+	}
+
+	transfer := config.GetTransfer("example.corp.")
+	if transfer == nil {
+		t.Fatalf("Expected transfer for example.corp.")
+	}
+	if !transfer.Allows(net.ParseIP("10.0.1.20")) || transfer.Allows(net.ParseIP("10.0.2.20")) {
+		t.Errorf("Expected transfer allowed from 10.0.1.0/24 only")
+	}
+	if targets := transfer.NotifyTargets(); len(targets) != 2 || "10.0.0.3:53" != targets[0] || "10.0.0.4:5353" != targets[1] {
+		t.Errorf("Expected notify targets with default port but got %v", targets)
+	}
+
+	bad := &GudgeonConfig{
+		tsigKeyMap: make(map[string]*GudgeonTsigKey),
+		TsigKeys:   []*GudgeonTsigKey{{Name: "bad-secret", Secret: "not base64!"}, {Name: "bad-algorithm", Algorithm: "hmac-sha3", Secret: "c2VjcmV0"}},
+		Transfers: []*GudgeonTransfer{
+			{Zone: "open.corp"},
+			{Zone: "missing.corp", Key: "missing-key"},
+			{Zone: "bad.corp", Allow: []string{"not-an-ip"}, Notify: []string{"server.corp"}},
+		},
+	}
+	if _, errs := bad.verifyAndInitTransfers(); len(errs) != 6 {
+		t.Errorf("Expected 6 errors verifying transfers but got %d: %v", len(errs), errs)
+	}
+}
+
+func TestVerifyUpdates(t *testing.T) {
+	config := &GudgeonConfig{
+		tsigKeyMap: make(map[string]*GudgeonTsigKey),
+		TsigKeys:   []*GudgeonTsigKey{{Name: "update-key", Secret: "c2VjcmV0"}},
+		Updates: []*GudgeonUpdate{
+			{Zone: "Dyn.Example.Corp.", Allow: []string{"10.0.0.5"}, Key: "update-key"},
+			{Zone: "open.corp"},
+			{Zone: "bad.corp", Allow: []string{"dhcp.corp"}, Key: "missing-key"},
+		},
+	}
+	if _, errs := config.verifyAndInitTransfers(); len(errs) != 3 {
+		t.Errorf("Expected 3 errors verifying updates but got %d: %v", len(errs), errs)
+	}
+
+	update := config.GetUpdate("dyn.example.corp")
+	if update == nil || !update.Allows(net.ParseIP("10.0.0.5")) || update.Allows(net.ParseIP("10.0.0.6")) {
+		t.Errorf("Expected update of dyn.example.corp. allowed from 10.0.0.5 only but got %v", update)
+	}
+}
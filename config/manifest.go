@@ -0,0 +1,254 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// an entry in a json manifest
+type manifestEntry struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Mode   string   `json:"mode"`
+	Target string   `json:"target"`
+	Regex  *bool    `json:"regex"`
+	Tags   []string `json:"tags"`
+	// both "src" and "url" are accepted for the location of the list
+	Source string `json:"src"`
+	URL    string `json:"url"`
+}
+
+// a json manifest can also be an object with the entries under "lists"
+type manifestDocument struct {
+	Lists []*manifestEntry `json:"lists"`
+}
+
+// parse a manifest into the lists it describes. a manifest is either json (an array of entries or an object with
+// a "lists" array) or text with one list source per line followed by optional name=, type=, mode=, target=, regex=, and tags= values.
+// the returned lists have not been verified or initialized.
+func ParseManifest(reader io.Reader) ([]*GudgeonList, error) {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return parseJsonManifest(trimmed)
+	}
+	return parseTextManifest(content)
+}
+
+func parseJsonManifest(content []byte) ([]*GudgeonList, error) {
+	entries := make([]*manifestEntry, 0)
+	if content[0] == '[' {
+		if err := util.Json.Unmarshal(content, &entries); err != nil {
+			return nil, fmt.Errorf("parsing json manifest: %s", err)
+		}
+	} else {
+		document := &manifestDocument{}
+		if err := util.Json.Unmarshal(content, document); err != nil {
+			return nil, fmt.Errorf("parsing json manifest: %s", err)
+		}
+		entries = document.Lists
+	}
+
+	lists := make([]*GudgeonList, 0, len(entries))
+	for idx, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		source := entry.Source
+		if "" == source {
+			source = entry.URL
+		}
+		if "" == source {
+			return nil, fmt.Errorf("manifest entry %d has no source", idx+1)
+		}
+		list := &GudgeonList{
+			Name:   entry.Name,
+			Type:   entry.Type,
+			Mode:   entry.Mode,
+			Target: entry.Target,
+			Regex:  entry.Regex,
+			Source: source,
+		}
+		if entry.Tags != nil {
+			tags := entry.Tags
+			list.Tags = &tags
+		}
+		lists = append(lists, list)
+	}
+
+	return lists, nil
+}
+
+func parseTextManifest(content []byte) ([]*GudgeonList, error) {
+	lists := make([]*GudgeonList, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx > -1 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 1 {
+			continue
+		}
+
+		list := &GudgeonList{
+			Source: fields[0],
+		}
+		for _, field := range fields[1:] {
+			split := strings.SplitN(field, "=", 2)
+			if len(split) != 2 {
+				return nil, fmt.Errorf("manifest line %d: expected key=value but found '%s'", lineNumber, field)
+			}
+			key, value := strings.ToLower(split[0]), split[1]
+			switch key {
+			case "name":
+				list.Name = value
+			case "type":
+				list.Type = value
+			case "mode":
+				list.Mode = value
+			case "target":
+				list.Target = value
+			case "regex":
+				list.Regex = boolPointer(strings.EqualFold("true", value))
+			case "tags":
+				tags := make([]string, 0)
+				for _, tag := range strings.Split(value, ",") {
+					if tag = strings.TrimSpace(tag); "" != tag {
+						tags = append(tags, tag)
+					}
+				}
+				list.Tags = &tags
+			default:
+				return nil, fmt.Errorf("manifest line %d: unknown key '%s'", lineNumber, key)
+			}
+		}
+		lists = append(lists, list)
+	}
+
+	return lists, scanner.Err()
+}
+
+// if both sources are urls with the same scheme, host, and port
+func sameOrigin(source string, other string) bool {
+	parsed, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+	parsedOther, err := url.Parse(other)
+	if err != nil {
+		return false
+	}
+	port := func(u *url.URL) string {
+		if "" != u.Port() {
+			return u.Port()
+		}
+		if strings.EqualFold("https", u.Scheme) {
+			return "443"
+		}
+		return "80"
+	}
+	return strings.EqualFold(parsed.Scheme, parsedOther.Scheme) && strings.EqualFold(parsed.Hostname(), parsedOther.Hostname()) && port(parsed) == port(parsedOther)
+}
+
+// replace the lists previously expanded from the given manifest with the given lists. lists inherit the tags, mode,
+// and download options of the manifest when they don't set their own, credentials are only inherited by lists on the
+// same host as the manifest. lists that collide with an existing list name, local lists from a remote manifest, and
+// manifests are skipped with a warning.
+func (config *GudgeonConfig) ExpandManifest(manifest *GudgeonList, lists []*GudgeonList) []string {
+	warnings := make([]string, 0)
+	if manifest == nil || !manifest.IsManifest() {
+		return warnings
+	}
+	manifestName := manifest.CanonicalName()
+
+	// remove lists from any previous expansion of the manifest
+	kept := make([]*GudgeonList, 0, len(config.Lists))
+	for _, list := range config.Lists {
+		if list.manifest == manifestName {
+			delete(config.listMap, list.CanonicalName())
+			continue
+		}
+		kept = append(kept, list)
+	}
+	config.Lists = kept
+	if config.listMap == nil {
+		config.listMap = make(map[string]*GudgeonList, 0)
+	}
+
+	for _, list := range lists {
+		if list == nil || "" == list.Source {
+			continue
+		}
+		list.VerifyAndInit()
+		if list.IsManifest() {
+			warnings = append(warnings, fmt.Sprintf("Manifest '%s': nested manifest '%s' is not supported and will be ignored", manifestName, list.CanonicalName()))
+			continue
+		}
+		// a remote manifest can't name files on this host
+		if manifest.IsRemote() && !list.IsRemote() {
+			warnings = append(warnings, fmt.Sprintf("Manifest '%s': list '%s' is not a url and a remote manifest can only name remote lists, the entry will be ignored", manifestName, list.CanonicalName()))
+			continue
+		}
+		if _, found := config.listMap[list.CanonicalName()]; found {
+			warnings = append(warnings, fmt.Sprintf("Manifest '%s': a list named '%s' already exists, the entry will be ignored", manifestName, list.CanonicalName()))
+			continue
+		}
+		if "" == list.Mode {
+			list.Mode = manifest.Mode
+		}
+		mode, err := verifyMode(list.Mode)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("Manifest '%s': list '%s' %s, the entry will be ignored", manifestName, list.CanonicalName(), err))
+			continue
+		}
+		list.Mode = mode
+		if TargetDomain != list.Target && TargetIP != list.Target {
+			warnings = append(warnings, fmt.Sprintf("Manifest '%s': list '%s' target '%s' must be '%s' or '%s', the entry will be ignored", manifestName, list.CanonicalName(), list.Target, TargetDomain, TargetIP))
+			continue
+		}
+		if list.Tags == nil && manifest.Tags != nil {
+			tags := append([]string{}, *manifest.Tags...)
+			list.Tags = &tags
+		}
+		// remote lists use the same download options as the manifest they came from but credentials are only sent
+		// to the host that the manifest came from
+		if list.IsRemote() {
+			if manifest.IsRemote() && sameOrigin(manifest.Source, list.Source) {
+				if list.Headers == nil {
+					list.Headers = manifest.Headers
+				}
+				if list.Auth == nil {
+					list.Auth = manifest.Auth
+				}
+				if list.TLS == nil {
+					list.TLS = manifest.TLS
+				}
+			}
+			if "" == list.Proxy {
+				list.Proxy = manifest.Proxy
+			}
+		}
+		list.manifest = manifestName
+
+		config.Lists = append(config.Lists, list)
+		config.listMap[list.CanonicalName()] = list
+	}
+
+	return warnings
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTextManifest(t *testing.T) {
+	manifest := `
+# curated lists
+https://example.com/ads.txt name=ads tags=ads,tracking
+https://example.com/allow.txt    type=allow # trailing comment
+`
+	lists, err := ParseManifest(strings.NewReader(manifest))
+	if err != nil {
+		t.Errorf("Could not parse manifest: %s", err)
+		return
+	}
+	if len(lists) != 2 {
+		t.Errorf("Expected 2 lists but found %d", len(lists))
+		return
+	}
+	if lists[0].Name != "ads" || lists[0].Tags == nil || len(*lists[0].Tags) != 2 {
+		t.Errorf("Unexpected first list: %v", lists[0])
+	}
+	if lists[1].Source != "https://example.com/allow.txt" || lists[1].Type != "allow" {
+		t.Errorf("Unexpected second list: %v", lists[1])
+	}
+
+	if _, err := ParseManifest(strings.NewReader("https://example.com/ads.txt color=blue")); err == nil {
+		t.Errorf("Expected error for unknown manifest key")
+	}
+}
+
+func TestParseJsonManifest(t *testing.T) {
+	for _, manifest := range []string{
+		`[{"name": "ads", "url": "https://example.com/ads.txt", "tags": ["ads"]}, {"src": "https://example.com/allow.txt", "type": "allow"}]`,
+		`{"lists": [{"name": "ads", "src": "https://example.com/ads.txt", "tags": ["ads"]}, {"url": "https://example.com/allow.txt", "type": "allow"}]}`,
+	} {
+		lists, err := ParseManifest(strings.NewReader(manifest))
+		if err != nil {
+			t.Errorf("Could not parse manifest: %s", err)
+			continue
+		}
+		if len(lists) != 2 {
+			t.Errorf("Expected 2 lists but found %d", len(lists))
+			continue
+		}
+		if lists[0].Name != "ads" || lists[0].Source != "https://example.com/ads.txt" {
+			t.Errorf("Unexpected first list: %v", lists[0])
+		}
+		if lists[1].Source != "https://example.com/allow.txt" || lists[1].Type != "allow" {
+			t.Errorf("Unexpected second list: %v", lists[1])
+		}
+	}
+}
+
+func TestExpandManifest(t *testing.T) {
+	tags := []string{"curated"}
+	manifest := &GudgeonList{Name: "curated", Type: "manifest", Source: "https://example.com/manifest.txt", Tags: &tags, Proxy: "none"}
+	existing := &GudgeonList{Name: "existing", Source: "https://example.com/existing.txt"}
+	conf := &GudgeonConfig{Lists: []*GudgeonList{manifest, existing}}
+	if _, errors := conf.verifyAndInit(); len(errors) > 0 {
+		t.Errorf("Could not init config: %v", errors)
+		return
+	}
+
+	lists, _ := ParseManifest(strings.NewReader("https://example.com/ads.txt name=ads\nhttps://example.com/existing.txt name=existing"))
+	warnings := conf.ExpandManifest(manifest, lists)
+	if len(warnings) != 1 {
+		t.Errorf("Expected a warning for the duplicate list but got: %v", warnings)
+	}
+	ads := conf.GetList("ads")
+	if ads == nil {
+		t.Errorf("Expanded list was not found")
+		return
+	}
+	if ads.Manifest() != "curated" || ads.Proxy != "none" || len(ads.SafeTags()) != 1 || ads.SafeTags()[0] != "curated" {
+		t.Errorf("Expanded list did not inherit from manifest: %v", ads)
+	}
+
+	// expanding again replaces the previous lists
+	lists, _ = ParseManifest(strings.NewReader("https://example.com/other.txt name=other"))
+	conf.ExpandManifest(manifest, lists)
+	if conf.GetList("ads") != nil || conf.GetList("other") == nil || len(conf.Lists) != 3 {
+		t.Errorf("Manifest lists were not replaced on expansion: %v", conf.Lists)
+	}
+}
+
+func TestExpandManifestCredentials(t *testing.T) {
+	manifest := &GudgeonList{
+		Name:    "private",
+		Type:    "manifest",
+		Source:  "https://lists.example.com/manifest.txt",
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Auth:    &GudgeonListAuth{Username: "user", Password: "secret"},
+		TLS:     &GudgeonListTLS{},
+		Proxy:   "none",
+	}
+	conf := &GudgeonConfig{Lists: []*GudgeonList{manifest}}
+	if _, errors := conf.verifyAndInit(); len(errors) > 0 {
+		t.Errorf("Could not init config: %v", errors)
+		return
+	}
+
+	lists, _ := ParseManifest(strings.NewReader("https://lists.example.com/ads.txt name=same\nhttps://lists.example.com:8443/ads.txt name=port\nhttps://raw.example.net/ads.txt name=other\n/etc/passwd name=local"))
+	warnings := conf.ExpandManifest(manifest, lists)
+	if len(warnings) != 1 || conf.GetList("local") != nil {
+		t.Errorf("Expected the local list from a remote manifest to be ignored with a warning but got: %v", warnings)
+	}
+
+	same := conf.GetList("same")
+	if same == nil || same.Auth == nil || same.TLS == nil || same.Headers == nil {
+		t.Errorf("Expected list on the manifest host to inherit credentials: %v", same)
+	}
+	for _, name := range []string{"port", "other"} {
+		list := conf.GetList(name)
+		if list == nil {
+			t.Errorf("Expanded list '%s' was not found", name)
+			continue
+		}
+		if list.Auth != nil || list.TLS != nil || list.Headers != nil {
+			t.Errorf("Expected list '%s' on another host to have no credentials: %v", name, list)
+		}
+		if list.Proxy != "none" {
+			t.Errorf("Expected list '%s' to inherit the proxy but got '%s'", name, list.Proxy)
+		}
+	}
+}
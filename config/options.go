@@ -21,10 +21,30 @@ type DebugOptions struct {
 	Debug   bool `short:"d" long:"debug" description:"Force the console log to the debug level"`
 }
 
+type ExplainOptions struct {
+	Domain   string   `short:"e" long:"explain" description:"Show every list and rule that matches the given domain and exit."`
+	Consumer string   `long:"explain-consumer" description:"Explain the domain for the named consumer."`
+	Groups   []string `long:"explain-group" description:"Explain the domain for the named group, can be given more than once."`
+	IP       string   `long:"explain-ip" description:"Explain the domain for the consumer that matches the given IP."`
+}
+
+type PauseOptions struct {
+	Duration string `long:"pause" description:"Pause blocking on the running instance for the given duration (like 5m or 1h) and exit."`
+	Consumer string `long:"pause-consumer" description:"Pause or resume blocking only for the named consumer."`
+	Group    string `long:"pause-group" description:"Pause or resume blocking only for the named group."`
+	Resume   bool   `long:"resume" description:"Resume blocking on the running instance before the pause expires and exit."`
+}
+
 type GudgeonOptions struct {
 	// explicit app group
 	AppOptions AppOptions `group:"Application Options"`
 
+	// rule troubleshooting options
+	ExplainOptions ExplainOptions `group:"Explain Options"`
+
+	// pause/resume blocking on a running instance
+	PauseOptions PauseOptions `group:"Pause Options"`
+
 	// debug/performance/profiling options
 	DebugOptions DebugOptions `group:"Debugging/Profiling Options"`
 
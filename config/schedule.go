@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule: the days of the week and times of day when a group (or a consumer's scheduled groups) apply
+type GudgeonSchedule struct {
+	// days: names of days ("mon", "tuesday") or ranges of days ("mon-fri"), every day when empty
+	Days []string `yaml:"days"`
+	// times: ranges of time in 24-hour format ("21:00-07:00"), ranges that end before they start continue
+	// into the next day and belong to the day they started on. all day when empty.
+	Times []string `yaml:"times"`
+	// timezone: IANA name of the timezone ("America/New_York") the days and times are in, local time when empty
+	Timezone string `yaml:"timezone"`
+
+	// parsed values
+	days     map[time.Weekday]bool
+	ranges   []*scheduleRange
+	location *time.Location
+}
+
+// a consumer schedule adds groups to the consumer while the schedule is active
+type GudgeonConsumerSchedule struct {
+	// groups: groups added to the consumer while the schedule is active
+	Groups []string `yaml:"groups"`
+
+	GudgeonSchedule `yaml:",inline"`
+}
+
+// start and end minute of the day, the end is exclusive
+type scheduleRange struct {
+	start int
+	end   int
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun":       time.Sunday,
+	"sunday":    time.Sunday,
+	"mon":       time.Monday,
+	"monday":    time.Monday,
+	"tue":       time.Tuesday,
+	"tues":      time.Tuesday,
+	"tuesday":   time.Tuesday,
+	"wed":       time.Wednesday,
+	"wednesday": time.Wednesday,
+	"thu":       time.Thursday,
+	"thur":      time.Thursday,
+	"thurs":     time.Thursday,
+	"thursday":  time.Thursday,
+	"fri":       time.Friday,
+	"friday":    time.Friday,
+	"sat":       time.Saturday,
+	"saturday":  time.Saturday,
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	if day, found := weekdayNames[strings.ToLower(strings.TrimSpace(name))]; found {
+		return day, nil
+	}
+	return time.Sunday, fmt.Errorf("'%s' is not a day of the week", name)
+}
+
+// parse "hh:mm" into minutes since midnight, "24:00" is allowed as the end of the day
+func parseTimeOfDay(value string) (int, error) {
+	split := strings.Split(strings.TrimSpace(value), ":")
+	if len(split) != 2 {
+		return 0, fmt.Errorf("'%s' is not a time in the form hh:mm", value)
+	}
+	hours, err := strconv.Atoi(split[0])
+	if err != nil || hours < 0 || hours > 24 {
+		return 0, fmt.Errorf("'%s' is not a time in the form hh:mm", value)
+	}
+	minutes, err := strconv.Atoi(split[1])
+	if err != nil || minutes < 0 || minutes > 59 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("'%s' is not a time in the form hh:mm", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// parse the days, times, and timezone of the schedule so that it can be checked
+func (schedule *GudgeonSchedule) verifyAndInit() error {
+	schedule.days = make(map[time.Weekday]bool)
+	for _, day := range schedule.Days {
+		if split := strings.SplitN(day, "-", 2); len(split) == 2 {
+			start, err := parseWeekday(split[0])
+			if err != nil {
+				return err
+			}
+			end, err := parseWeekday(split[1])
+			if err != nil {
+				return err
+			}
+			// ranges can wrap around the end of the week ("fri-mon")
+			for current := start; ; current = (current + 1) % 7 {
+				schedule.days[current] = true
+				if current == end {
+					break
+				}
+			}
+			continue
+		}
+		weekday, err := parseWeekday(day)
+		if err != nil {
+			return err
+		}
+		schedule.days[weekday] = true
+	}
+
+	schedule.ranges = make([]*scheduleRange, 0, len(schedule.Times))
+	for _, times := range schedule.Times {
+		split := strings.SplitN(times, "-", 2)
+		if len(split) != 2 {
+			return fmt.Errorf("'%s' is not a time range in the form hh:mm-hh:mm", times)
+		}
+		start, err := parseTimeOfDay(split[0])
+		if err != nil {
+			return err
+		}
+		end, err := parseTimeOfDay(split[1])
+		if err != nil {
+			return err
+		}
+		if start == end {
+			return fmt.Errorf("time range '%s' is empty", times)
+		}
+		schedule.ranges = append(schedule.ranges, &scheduleRange{start: start, end: end})
+	}
+
+	schedule.location = time.Local
+	if "" != schedule.Timezone {
+		location, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			return fmt.Errorf("unknown timezone '%s': %s", schedule.Timezone, err)
+		}
+		schedule.location = location
+	}
+
+	return nil
+}
+
+func (schedule *GudgeonSchedule) onDay(day time.Weekday) bool {
+	return len(schedule.days) < 1 || schedule.days[day]
+}
+
+// if the schedule applies at the given time, a nil schedule always applies
+func (schedule *GudgeonSchedule) Active(at time.Time) bool {
+	if schedule == nil {
+		return true
+	}
+	// schedules that were never initialized are treated as always active
+	if schedule.location != nil {
+		at = at.In(schedule.location)
+	}
+	today := at.Weekday()
+	if len(schedule.ranges) < 1 {
+		return schedule.onDay(today)
+	}
+
+	minute := at.Hour()*60 + at.Minute()
+	yesterday := (today + 6) % 7
+	for _, r := range schedule.ranges {
+		if r.start < r.end {
+			if schedule.onDay(today) && minute >= r.start && minute < r.end {
+				return true
+			}
+		} else if (schedule.onDay(today) && minute >= r.start) || (schedule.onDay(yesterday) && minute < r.end) {
+			// overnight ranges run until the end time on the day after they start
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleActive(t *testing.T) {
+	// school nights: sunday through thursday from 21:00 until 07:00 the next morning
+	schedule := &GudgeonSchedule{
+		Days:     []string{"sun-thu"},
+		Times:    []string{"21:00-07:00"},
+		Timezone: "UTC",
+	}
+	if err := schedule.verifyAndInit(); err != nil {
+		t.Errorf("Could not initialize schedule: %s", err)
+		return
+	}
+
+	// january 1st, 2024 is a monday
+	data := []struct {
+		at       time.Time
+		expected bool
+	}{
+		{time.Date(2024, 1, 1, 20, 59, 0, 0, time.UTC), false},
+		{time.Date(2024, 1, 1, 21, 0, 0, 0, time.UTC), true},
+		{time.Date(2024, 1, 2, 6, 59, 0, 0, time.UTC), true},
+		{time.Date(2024, 1, 2, 7, 0, 0, 0, time.UTC), false},
+		// friday night is not a school night but the early morning belongs to thursday night
+		{time.Date(2024, 1, 5, 3, 0, 0, 0, time.UTC), true},
+		{time.Date(2024, 1, 5, 22, 0, 0, 0, time.UTC), false},
+		{time.Date(2024, 1, 6, 3, 0, 0, 0, time.UTC), false},
+		{time.Date(2024, 1, 7, 22, 0, 0, 0, time.UTC), true},
+		// times are compared in the timezone of the schedule
+		{time.Date(2024, 1, 1, 16, 0, 0, 0, time.FixedZone("EST", -5*60*60)), true},
+	}
+
+	for _, d := range data {
+		if active := schedule.Active(d.at); active != d.expected {
+			t.Errorf("Expected schedule active to be %t at %s but got %t", d.expected, d.at, active)
+		}
+	}
+
+	// a nil schedule always applies
+	var none *GudgeonSchedule
+	if !none.Active(time.Now()) {
+		t.Errorf("Expected a nil schedule to be active")
+	}
+}
+
+func TestScheduleErrors(t *testing.T) {
+	for _, schedule := range []*GudgeonSchedule{
+		{Days: []string{"someday"}},
+		{Times: []string{"21:00"}},
+		{Times: []string{"25:00-07:00"}},
+		{Times: []string{"07:00-07:00"}},
+		{Timezone: "Nowhere/Nothing"},
+	} {
+		if err := schedule.verifyAndInit(); err == nil {
+			t.Errorf("Expected an error for schedule %v", schedule)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/resolver"
+	"github.com/chrisruffalo/gudgeon/rule"
+)
+
+// the rule text recorded for a match on a cname target shows the element of the chain that matched
+func cnameRuleText(ruleText string, target string) string {
+	return ruleText + " (cname " + strings.TrimSuffix(target, ".") + ")"
+}
+
+// check the targets of the cnames in the answer against the lists of the groups so that a tracker cloaked behind a
+// first party name is found. the result of following the chain (when the answer only held the first cname) is used
+// to find matches further down the chain. a block is returned for the first blocked target, otherwise the first
+// target that would be blocked. nothing is matched when the question itself is allowed.
+func (engine *engine) cnameRuleMatchedForGroups(groups []string, request *dns.Msg, response *dns.Msg, chased *resolver.ResolutionResult) (rule.Match, *config.GudgeonList, string, bool) {
+	if len(groups) < 1 || request == nil || len(request.Question) < 1 || response == nil {
+		return rule.MatchNone, nil, "", false
+	}
+
+	targets := make([]string, 0)
+	for _, answer := range response.Answer {
+		if cname, ok := answer.(*dns.CNAME); ok && "" != cname.Target {
+			targets = append(targets, cname.Target)
+		}
+	}
+	if len(targets) < 1 {
+		return rule.MatchNone, nil, "", false
+	}
+
+	// an explicitly allowed name is not blocked by where it points
+	if match, _, _ := engine.domainRuleMatchedForGroups(groups, request.Question[0].Name); match == rule.MatchAllow {
+		return rule.MatchNone, nil, "", false
+	}
+
+	var (
+		wouldBlockList *config.GudgeonList
+		wouldBlockRule string
+	)
+	for _, target := range targets {
+		match, list, ruleText := engine.domainRuleMatchedForGroups(groups, target)
+		if match == rule.MatchBlock {
+			return match, list, cnameRuleText(ruleText, target), false
+		}
+		if match == rule.MatchWouldBlock && wouldBlockList == nil {
+			wouldBlockList = list
+			wouldBlockRule = cnameRuleText(ruleText, target)
+		}
+	}
+
+	// a match further down the chain already names the element that matched
+	if chased != nil && (chased.Match == rule.MatchBlock || (chased.Match == rule.MatchWouldBlock && wouldBlockList == nil)) {
+		return chased.Match, chased.MatchList, chased.MatchRule, chased.Paused
+	}
+
+	if wouldBlockList != nil {
+		return rule.MatchWouldBlock, wouldBlockList, wouldBlockRule, false
+	}
+	return rule.MatchNone, nil, "", false
+}
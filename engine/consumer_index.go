@@ -0,0 +1,306 @@
+package engine
+
+import (
+	"bytes"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+const (
+	// no consumer is assigned to a node in the index
+	noConsumer = -1
+
+	// how often the neighbor table is reloaded in the background for mac matches
+	neighborRefresh = 10 * time.Second
+)
+
+// a node in a binary prefix tree of addresses
+type consumerNode struct {
+	children [2]*consumerNode
+	// the index of the first declared consumer with a match that ends at this node
+	consumer int
+}
+
+// finds the first declared consumer with a match (ip, range, or net) that contains an address. every match is
+// parsed once when the index is built and stored as one or more prefixes so that a lookup only walks the bits of
+// the address. ipv4 and ipv6 addresses are kept in separate trees. mac matches are found by looking up the
+// mac address of the client in the neighbor table of the host.
+type consumerIndex struct {
+	v4 *consumerNode
+	v6 *consumerNode
+
+	// first declared consumer for each mac address and the first consumer with any mac match
+	macs      map[string]int
+	firstMac  int
+	macFor    func(ip net.IP) string
+	neighbors *util.NeighborTable
+
+	// first declared consumer for each cpe id
+	cpeIDs map[string]int
+
+	// matches with hostname or composite parts in the order they were declared and if any of them has a mac part
+	complex    []*compiledMatch
+	complexMAC bool
+
+	// the name of the client from a reverse lookup of the address, only used by hostname matches
+	hostnameFor func(ip net.IP) string
+}
+
+func newConsumerNode() *consumerNode {
+	return &consumerNode{consumer: noConsumer}
+}
+
+func newEmptyConsumerIndex() *consumerIndex {
+	return &consumerIndex{
+		v4:       newConsumerNode(),
+		v6:       newConsumerNode(),
+		macs:     make(map[string]int),
+		firstMac: noConsumer,
+		cpeIDs:   make(map[string]int),
+		complex:  make([]*compiledMatch, 0),
+	}
+}
+
+func newConsumerIndex(consumers []*consumer) *consumerIndex {
+	index := newEmptyConsumerIndex()
+
+	for idx, activeConsumer := range consumers {
+		if activeConsumer == nil || activeConsumer.configConsumer == nil {
+			continue
+		}
+		for _, match := range activeConsumer.configConsumer.Matches {
+			index.addMatch(match, idx)
+		}
+	}
+
+	// the neighbor table is only read when there are mac matches (which can be inside of complex matches)
+	if len(index.macs) > 0 || index.complexMAC {
+		index.neighbors = util.NewNeighborTable(neighborRefresh)
+		index.macFor = index.neighbors.MAC
+	}
+
+	return index
+}
+
+// stop reloading the neighbor table
+func (index *consumerIndex) close() {
+	if index != nil && index.neighbors != nil {
+		index.neighbors.Close()
+	}
+}
+
+// the tree and address bytes to use for an address
+func (index *consumerIndex) tree(ip net.IP) (*consumerNode, net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return index.v4, ip4
+	}
+	return index.v6, ip.To16()
+}
+
+func (index *consumerIndex) addMatch(match *config.GudgeonMatch, consumer int) {
+	if match == nil {
+		return
+	}
+
+	// matches that can't be stored in the tree are checked in order after the tree
+	if !match.IsSimple() {
+		compiled := compileMatch(match, consumer)
+		index.complexMAC = index.complexMAC || compiled.hasMAC
+		index.complex = append(index.complex, compiled)
+		return
+	}
+
+	if "" != match.IP {
+		if matchIP := net.ParseIP(match.IP); matchIP != nil {
+			root, address := index.tree(matchIP)
+			root.insert(address, len(address)*8, consumer)
+		}
+	}
+
+	if match.Range != nil && "" != match.Range.Start && "" != match.Range.End {
+		startIP := net.ParseIP(match.Range.Start)
+		endIP := net.ParseIP(match.Range.End)
+		if startIP != nil && endIP != nil {
+			index.addRange(startIP, endIP, consumer)
+		}
+	}
+
+	if "" != match.MAC {
+		if mac := util.NormalizeMAC(match.MAC); "" != mac {
+			if _, found := index.macs[mac]; !found {
+				index.macs[mac] = consumer
+			}
+			if index.firstMac == noConsumer {
+				index.firstMac = consumer
+			}
+		}
+	}
+
+	if "" != match.CpeID {
+		if _, found := index.cpeIDs[match.CpeID]; !found {
+			index.cpeIDs[match.CpeID] = consumer
+		}
+	}
+
+	if "" != match.Net {
+		if _, parsedNet, err := net.ParseCIDR(match.Net); err == nil && parsedNet != nil {
+			ones, _ := parsedNet.Mask.Size()
+			// networks are only compared against addresses of the same length
+			if len(parsedNet.IP) == net.IPv4len {
+				index.v4.insert(parsedNet.IP, ones, consumer)
+			} else {
+				index.v6.insert(parsedNet.IP, ones, consumer)
+			}
+		}
+	}
+}
+
+// ranges are split into the smallest set of prefixes that cover them. addresses are compared in their 16 byte
+// form so a range given in ipv6 form that covers part of the ipv4 mapped space also covers those ipv4 addresses.
+func (index *consumerIndex) addRange(startIP net.IP, endIP net.IP, consumer int) {
+	start, end := startIP.To16(), endIP.To16()
+	if bytes.Compare(start, end) > 0 {
+		return
+	}
+
+	// the part of the range in the ipv4 mapped space
+	v4Start, v4End := net.IPv4zero.To16(), net.IPv4bcast.To16()
+	if bytes.Compare(start, v4End) <= 0 && bytes.Compare(end, v4Start) >= 0 {
+		low, high := start, end
+		if bytes.Compare(low, v4Start) < 0 {
+			low = v4Start
+		}
+		if bytes.Compare(high, v4End) > 0 {
+			high = v4End
+		}
+		index.v4.insertRange(low.To4(), high.To4(), consumer)
+	}
+
+	// ranges in ipv4 form are only ipv4
+	if startIP.To4() != nil && endIP.To4() != nil {
+		return
+	}
+	index.v6.insertRange(start, end, consumer)
+}
+
+func (node *consumerNode) insertRange(start net.IP, end net.IP, consumer int) {
+	bits := len(start) * 8
+	current := new(big.Int).SetBytes(start)
+	last := new(big.Int).SetBytes(end)
+	one := big.NewInt(1)
+
+	for current.Cmp(last) <= 0 {
+		// the largest block that starts at the current address and does not go past the end of the range
+		size := int(current.TrailingZeroBits())
+		if current.Sign() == 0 {
+			size = bits
+		}
+		for size > 0 {
+			blockEnd := new(big.Int).Lsh(one, uint(size))
+			blockEnd.Add(blockEnd, current).Sub(blockEnd, one)
+			if blockEnd.Cmp(last) <= 0 {
+				break
+			}
+			size--
+		}
+
+		address := make([]byte, len(start))
+		value := current.Bytes()
+		copy(address[len(address)-len(value):], value)
+		node.insert(address, bits-size, consumer)
+
+		current.Add(current, new(big.Int).Lsh(one, uint(size)))
+	}
+}
+
+// add a prefix to the tree, when more than one consumer has the same prefix the first declared consumer is kept
+func (node *consumerNode) insert(address []byte, prefix int, consumer int) {
+	current := node
+	for bit := 0; bit < prefix; bit++ {
+		direction := (address[bit/8] >> uint(7-bit%8)) & 1
+		if current.children[direction] == nil {
+			current.children[direction] = newConsumerNode()
+		}
+		current = current.children[direction]
+	}
+	if current.consumer == noConsumer || consumer < current.consumer {
+		current.consumer = consumer
+	}
+}
+
+// the index of the first declared consumer that matches the address
+func (index *consumerIndex) find(ip net.IP) int {
+	return index.findClient(ip, "", "")
+}
+
+// the index of the first declared consumer that matches the address, mac, or cpe id. when no mac is given it is
+// looked up from the neighbor table.
+func (index *consumerIndex) findClient(ip net.IP, mac string, cpeID string) int {
+	if index == nil {
+		return noConsumer
+	}
+
+	client := &matchClient{
+		index:    index,
+		ip:       ip,
+		mac:      mac,
+		macFound: "" != mac,
+		cpeID:    cpeID,
+	}
+
+	found := index.findAddress(ip)
+
+	if "" != cpeID {
+		if cpeConsumer, ok := index.cpeIDs[cpeID]; ok && (found == noConsumer || cpeConsumer < found) {
+			found = cpeConsumer
+		}
+	}
+
+	// the mac address is only looked up when a mac match could come before the consumer already found
+	if len(index.macs) > 0 && (found == noConsumer || index.firstMac < found) {
+		if macConsumer, ok := index.macs[client.MAC()]; ok && (found == noConsumer || macConsumer < found) {
+			found = macConsumer
+		}
+	}
+
+	// complex matches are only checked when they were declared before the consumer already found
+	for _, match := range index.complex {
+		if found != noConsumer && match.consumer >= found {
+			break
+		}
+		if match.matches(client) {
+			found = match.consumer
+			break
+		}
+	}
+
+	return found
+}
+
+// the index of the first declared consumer with a prefix that contains the address
+func (index *consumerIndex) findAddress(ip net.IP) int {
+	if ip == nil {
+		return noConsumer
+	}
+	current, address := index.tree(ip)
+	if address == nil {
+		return noConsumer
+	}
+
+	found := noConsumer
+	for bit := 0; current != nil; bit++ {
+		if current.consumer != noConsumer && (found == noConsumer || current.consumer < found) {
+			found = current.consumer
+		}
+		if bit >= len(address)*8 {
+			break
+		}
+		current = current.children[(address[bit/8]>>uint(7-bit%8))&1]
+	}
+
+	return found
+}
@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"bytes"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+// the linear scan that the index replaces, used to check that the index finds the same consumer
+func linearConsumerMatch(consumers []*consumer, consumerIP net.IP) int {
+	for idx, activeConsumer := range consumers {
+		for _, match := range activeConsumer.configConsumer.Matches {
+			if "" != match.IP {
+				matchIP := net.ParseIP(match.IP)
+				if matchIP != nil && bytes.Compare(matchIP.To16(), consumerIP.To16()) == 0 {
+					return idx
+				}
+			}
+			if match.Range != nil && "" != match.Range.Start && "" != match.Range.End {
+				startIP := net.ParseIP(match.Range.Start)
+				endIP := net.ParseIP(match.Range.End)
+				if startIP != nil && endIP != nil && bytes.Compare(consumerIP.To16(), startIP.To16()) >= 0 && bytes.Compare(consumerIP.To16(), endIP.To16()) <= 0 {
+					return idx
+				}
+			}
+			if "" != match.Net {
+				_, parsedNet, err := net.ParseCIDR(match.Net)
+				if err == nil && parsedNet != nil && parsedNet.Contains(consumerIP) {
+					return idx
+				}
+			}
+		}
+	}
+	return noConsumer
+}
+
+func TestConsumerIndexPrecedence(t *testing.T) {
+	// overlapping matches where less specific matches are declared first
+	matches := [][]*config.GudgeonMatch{
+		{{Range: &config.GudgeonMatchRange{Start: "10.0.0.7", End: "10.0.3.200"}}},
+		{{Net: "10.0.0.0/16"}, {IP: "10.1.0.1"}},
+		{{IP: "10.0.1.1"}, {IP: "10.2.0.1"}},
+		{{Range: &config.GudgeonMatchRange{Start: "10.0.255.0", End: "10.2.0.0"}}},
+		{{Net: "0.0.0.0/0"}},
+		{{Range: &config.GudgeonMatchRange{Start: "2001:db8::ff", End: "2001:db8::1:3"}}, {Net: "2001:db8::/120"}},
+		{{Net: "2001:db8::/32"}},
+		{{Range: &config.GudgeonMatchRange{Start: "::", End: "::ffff:10.0.0.3"}}},
+	}
+	consumers := make([]*consumer, len(matches))
+	for idx, m := range matches {
+		consumers[idx] = &consumer{configConsumer: &config.GudgeonConsumer{Matches: m}}
+	}
+	index := newConsumerIndex(consumers)
+
+	addresses := []string{"10.0.0.1", "10.0.0.7", "10.0.1.1", "10.0.255.1", "10.1.0.1", "10.2.0.0", "10.2.0.1", "192.168.0.1", "2001:db8::1", "2001:db8::ff", "2001:db8::1:3", "2001:db8::1:4", "2001:db9::1", "::1"}
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		addresses = append(addresses, net.IPv4(10, byte(random.Intn(3)), byte(random.Intn(256)), byte(random.Intn(256))).String())
+		addresses = append(addresses, net.IP{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, byte(random.Intn(2)), byte(random.Intn(2)), byte(random.Intn(256))}.String())
+	}
+
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		if expected, found := linearConsumerMatch(consumers, ip), index.find(ip); expected != found {
+			t.Errorf("%s >> Expected consumer %d but index found %d", address, expected, found)
+		}
+	}
+}
+
+func TestConsumerIndexMac(t *testing.T) {
+	consumers := []*consumer{
+		{configConsumer: &config.GudgeonConsumer{Matches: []*config.GudgeonMatch{{IP: "192.168.0.10"}}}},
+		{configConsumer: &config.GudgeonConsumer{Matches: []*config.GudgeonMatch{{MAC: "AA:BB:CC:00:11:22"}}}},
+		{configConsumer: &config.GudgeonConsumer{Matches: []*config.GudgeonMatch{{Net: "192.168.0.0/24"}}}},
+	}
+	index := newConsumerIndex(consumers)
+
+	lookups := 0
+	index.macFor = func(ip net.IP) string {
+		lookups++
+		if ip.Equal(net.ParseIP("192.168.0.10")) || ip.Equal(net.ParseIP("192.168.0.20")) || ip.Equal(net.ParseIP("10.0.0.1")) {
+			return "aa:bb:cc:00:11:22"
+		}
+		return ""
+	}
+
+	data := []struct {
+		ip       string
+		expected int
+	}{
+		// the address match is declared before the mac match
+		{"192.168.0.10", 0},
+		// the mac match is declared before the net match
+		{"192.168.0.20", 1},
+		{"10.0.0.1", 1},
+		{"192.168.0.30", 2},
+		{"10.0.0.2", noConsumer},
+	}
+	for _, d := range data {
+		if found := index.find(net.ParseIP(d.ip)); found != d.expected {
+			t.Errorf("%s >> Expected consumer %d but found %d", d.ip, d.expected, found)
+		}
+	}
+
+	// no mac lookup is needed when a consumer declared before any mac match is found by address
+	if lookups != len(data)-1 {
+		t.Errorf("Expected %d mac lookups but got %d", len(data)-1, lookups)
+	}
+}
+
+func TestConsumerIndexComposite(t *testing.T) {
+	consumers := []*consumer{
+		// 10.0.0.0/8 but not 10.0.5.0/24
+		{configConsumer: &config.GudgeonConsumer{Matches: []*config.GudgeonMatch{{Net: "10.0.0.0/8", Not: []*config.GudgeonMatch{{Net: "10.0.5.0/24"}}}}}},
+		// kids devices by name unless they are in the office range
+		{configConsumer: &config.GudgeonConsumer{Matches: []*config.GudgeonMatch{{All: []*config.GudgeonMatch{{Hostname: "*.kids.lan"}, {Not: []*config.GudgeonMatch{{Range: &config.GudgeonMatchRange{Start: "192.168.1.100", End: "192.168.1.199"}}}}}}}}},
+		{configConsumer: &config.GudgeonConsumer{Matches: []*config.GudgeonMatch{{Net: "10.0.5.0/24"}, {Net: "192.168.1.0/24"}}}},
+		// everything that isn't the router
+		{configConsumer: &config.GudgeonConsumer{Matches: []*config.GudgeonMatch{{Not: []*config.GudgeonMatch{{IP: "192.168.0.1"}}}}}},
+	}
+	index := newConsumerIndex(consumers)
+	defer index.close()
+
+	// no mac is matched so the neighbor table isn't read
+	if index.neighbors != nil {
+		t.Errorf("Expected no neighbor table without a mac match")
+	}
+
+	lookups := 0
+	index.hostnameFor = func(ip net.IP) string {
+		lookups++
+		switch ip.String() {
+		case "192.168.1.20", "192.168.1.120":
+			return "tablet.kids.lan"
+		}
+		return ""
+	}
+
+	data := []struct {
+		ip       string
+		expected int
+	}{
+		{"10.0.4.1", 0},
+		{"10.0.5.1", 2},
+		{"192.168.1.20", 1},
+		{"192.168.1.120", 2},
+		{"192.168.1.21", 2},
+		{"172.16.0.1", 3},
+		{"192.168.0.1", noConsumer},
+	}
+	for _, d := range data {
+		if found := index.find(net.ParseIP(d.ip)); found != d.expected {
+			t.Errorf("%s >> Expected consumer %d but found %d", d.ip, d.expected, found)
+		}
+	}
+
+	// the hostname is only looked up for clients that aren't matched by a consumer declared before it
+	if lookups != 6 {
+		t.Errorf("Expected 6 hostname lookups but got %d", lookups)
+	}
+}
+
+func TestConsumerIndexCompositeMac(t *testing.T) {
+	// a mac inside of a composite match still needs the neighbor table
+	consumers := []*consumer{
+		{configConsumer: &config.GudgeonConsumer{Matches: []*config.GudgeonMatch{{Net: "10.0.0.0/8", Not: []*config.GudgeonMatch{{MAC: "aa:bb:cc:00:11:22"}}}}}},
+	}
+	index := newConsumerIndex(consumers)
+	defer index.close()
+
+	if index.neighbors == nil || index.macFor == nil {
+		t.Errorf("Expected a neighbor table for a mac inside of a composite match")
+	}
+
+	index.macFor = func(ip net.IP) string {
+		if ip.Equal(net.ParseIP("10.0.0.2")) {
+			return "aa:bb:cc:00:11:22"
+		}
+		return ""
+	}
+	if found := index.find(net.ParseIP("10.0.0.1")); found != 0 {
+		t.Errorf("Expected consumer 0 but found %d", found)
+	}
+	if found := index.find(net.ParseIP("10.0.0.2")); found != noConsumer {
+		t.Errorf("Expected no consumer for the excluded mac but found %d", found)
+	}
+}
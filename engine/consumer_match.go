@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+const (
+	// how long the name of a client from a reverse lookup is kept
+	hostnameCacheTime = 5 * time.Minute
+	// the cache is cleared when it holds more names than this
+	hostnameCacheSize = 4096
+)
+
+// a match with hostname or composite (all, not) parts that is checked against each client
+type compiledMatch struct {
+	consumer int
+
+	// the address, range, net, mac, and cpe id parts of the match
+	simple *consumerIndex
+
+	hostname string
+	all      []*compiledMatch
+	not      []*compiledMatch
+
+	// if the match or any of the matches inside of it has a mac part
+	hasMAC bool
+}
+
+// the client being matched, the mac and hostname are only looked up when a match needs them
+type matchClient struct {
+	index *consumerIndex
+
+	ip    net.IP
+	cpeID string
+
+	mac      string
+	macFound bool
+
+	hostname      string
+	hostnameFound bool
+}
+
+func compileMatch(match *config.GudgeonMatch, consumer int) *compiledMatch {
+	compiled := &compiledMatch{
+		consumer: consumer,
+		hostname: match.Hostname,
+		hasMAC:   "" != match.MAC,
+		all:      make([]*compiledMatch, 0, len(match.All)),
+		not:      make([]*compiledMatch, 0, len(match.Not)),
+	}
+
+	simple := &config.GudgeonMatch{
+		IP:    match.IP,
+		Range: match.Range,
+		Net:   match.Net,
+		MAC:   match.MAC,
+		CpeID: match.CpeID,
+	}
+	if "" != simple.IP || simple.Range != nil || "" != simple.Net || "" != simple.MAC || "" != simple.CpeID {
+		compiled.simple = newEmptyConsumerIndex()
+		compiled.simple.addMatch(simple, 0)
+	}
+
+	for _, all := range match.All {
+		if all != nil {
+			compiledAll := compileMatch(all, consumer)
+			compiled.hasMAC = compiled.hasMAC || compiledAll.hasMAC
+			compiled.all = append(compiled.all, compiledAll)
+		}
+	}
+	for _, not := range match.Not {
+		if not != nil {
+			compiledNot := compileMatch(not, consumer)
+			compiled.hasMAC = compiled.hasMAC || compiledNot.hasMAC
+			compiled.not = append(compiled.not, compiledNot)
+		}
+	}
+
+	return compiled
+}
+
+// a match applies when any of its simple or hostname parts apply (or it has none), every match in "all" applies,
+// and no match in "not" applies. a match with no parts at all never applies.
+func (match *compiledMatch) matches(client *matchClient) bool {
+	if match.simple == nil && "" == match.hostname && len(match.all) < 1 && len(match.not) < 1 {
+		return false
+	}
+
+	if match.simple != nil || "" != match.hostname {
+		found := false
+		if match.simple != nil {
+			mac := ""
+			if len(match.simple.macs) > 0 {
+				mac = client.MAC()
+			}
+			found = match.simple.findClient(client.ip, mac, client.cpeID) != noConsumer
+		}
+		if !found && "" != match.hostname {
+			if name := client.Hostname(); "" != name {
+				found, _ = path.Match(match.hostname, name)
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for _, all := range match.all {
+		if !all.matches(client) {
+			return false
+		}
+	}
+	for _, not := range match.not {
+		if not.matches(client) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (client *matchClient) MAC() string {
+	if !client.macFound {
+		client.macFound = true
+		if client.index.macFor != nil && client.ip != nil {
+			client.mac = client.index.macFor(client.ip)
+		}
+	}
+	return client.mac
+}
+
+func (client *matchClient) Hostname() string {
+	if !client.hostnameFound {
+		client.hostnameFound = true
+		if client.index.hostnameFor != nil && client.ip != nil {
+			client.hostname = client.index.hostnameFor(client.ip)
+		}
+	}
+	return client.hostname
+}
+
+type cachedHostname struct {
+	name    string
+	expires time.Time
+}
+
+// wrap a reverse lookup with a cache so that each client is only looked up every few minutes
+func cachedReverseLookup(reverse func(address string) string) func(ip net.IP) string {
+	var mux sync.Mutex
+	cache := make(map[string]*cachedHostname)
+
+	return func(ip net.IP) string {
+		address := ip.String()
+
+		mux.Lock()
+		cached, found := cache[address]
+		mux.Unlock()
+		if found && time.Now().Before(cached.expires) {
+			return cached.name
+		}
+
+		// names that are not found are cached too
+		name := strings.ToLower(strings.TrimSuffix(reverse(address), "."))
+
+		mux.Lock()
+		if len(cache) >= hostnameCacheSize {
+			cache = make(map[string]*cachedHostname)
+		}
+		cache[address] = &cachedHostname{name: name, expires: time.Now().Add(hostnameCacheTime)}
+		mux.Unlock()
+
+		return name
+	}
+}
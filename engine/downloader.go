@@ -2,8 +2,13 @@ package engine
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	paths "path"
 	"strings"
@@ -13,9 +18,63 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/util"
 )
 
-func downloadFile(engine Engine, path string, url string) error {
+// choose the proxy function for a list, the list proxy overrides the default proxy and if neither is set the environment is used
+func proxyFunction(list *config.GudgeonList, defaultProxy string) (func(*http.Request) (*url.URL, error), error) {
+	proxy := defaultProxy
+	if list != nil && "" != list.Proxy {
+		proxy = list.Proxy
+	}
+
+	if "" == proxy {
+		return http.ProxyFromEnvironment, nil
+	} else if strings.EqualFold(config.NoProxy, proxy) {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("parsing proxy url: %s", err)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+// build the tls configuration for a list with a client certificate and/or custom trust
+func tlsConfig(list *config.GudgeonList) (*tls.Config, error) {
+	if list == nil || list.TLS == nil {
+		return nil, nil
+	}
+
+	tlsConf := &tls.Config{
+		InsecureSkipVerify: list.TLS.Insecure,
+	}
+
+	if "" != list.TLS.Cert && "" != list.TLS.Key {
+		cert, err := tls.LoadX509KeyPair(list.TLS.Cert, list.TLS.Key)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %s", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+
+	if "" != list.TLS.CA {
+		pem, err := ioutil.ReadFile(list.TLS.CA)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca bundle: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca bundle '%s'", list.TLS.CA)
+		}
+		tlsConf.RootCAs = pool
+	}
+
+	return tlsConf, nil
+}
+
+func downloadFile(engine Engine, path string, url string, list *config.GudgeonList, defaultProxy string) error {
 	// don't do anything with empty url
 	if url == "" {
 		return nil
@@ -29,8 +88,17 @@ func downloadFile(engine Engine, path string, url string) error {
 		}
 	}
 
-	// set up (default) http client
-	client := &http.Client{}
+	// create transport with proxy and tls settings for the list
+	tr := &http.Transport{}
+	var err error
+	tr.Proxy, err = proxyFunction(list, defaultProxy)
+	if err != nil {
+		return err
+	}
+	tr.TLSClientConfig, err = tlsConfig(list)
+	if err != nil {
+		return err
+	}
 
 	// if the engine is available then use it to resolve hostnames
 	if engine != nil {
@@ -39,9 +107,6 @@ func downloadFile(engine Engine, path string, url string) error {
 			KeepAlive: 5 * time.Second,
 		}
 
-		// create transport
-		tr := &http.Transport{}
-
 		// update the dial context in the client which allows us to replace the dialed address
 		// with the one that we create here
 		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -56,21 +121,60 @@ func downloadFile(engine Engine, path string, url string) error {
 			// chain the dialer into the default context either using the new address or the original address if no resolution happened
 			return dialer.DialContext(ctx, network, addr)
 		}
+	}
 
-		// set transport on client
-		client.Transport = tr
+	// set up http client with transport
+	client := &http.Client{
+		Transport: tr,
 	}
 
 	// use the http client to make a grabber client
 	grabber := grab.Client{
 		HTTPClient: client,
 	}
-	req, err := grab.NewRequest(path, url)
+	// download to a temporary location next to the target so that a compressed
+	// download never replaces a good list with data that can't be read
+	downloadPath := path + ".download"
+	req, err := grab.NewRequest(downloadPath, url)
 	if err != nil {
 		return err
 	}
+
+	// add headers and authentication to request
+	if list != nil {
+		for header, value := range list.Headers {
+			req.HTTPRequest.Header.Set(header, os.ExpandEnv(value))
+		}
+		if list.Auth != nil {
+			req.HTTPRequest.SetBasicAuth(list.Auth.Username, os.ExpandEnv(list.Auth.Password))
+		}
+	}
 	resp := grabber.Do(req)
 	err = resp.Err()
+	if err != nil {
+		_ = os.Remove(downloadPath)
+		return err
+	}
+
+	// determine compression from the content type or encoding that the server reports and fall back to the url extension
+	compression := util.CompressionNone
+	if resp.HTTPResponse != nil {
+		compression = util.CompressionFromContentType(resp.HTTPResponse.Header.Get("Content-Type"))
+		if compression == util.CompressionNone {
+			compression = util.CompressionFromContentType(resp.HTTPResponse.Header.Get("Content-Encoding"))
+		}
+	}
+	if compression == util.CompressionNone {
+		compression = util.CompressionFromName(url)
+	}
+
+	// decompress (or just copy plain text) into the list file, the content of the file is also checked so this
+	// works even when neither the headers nor the url say anything about the compression
+	if compression != util.CompressionNone {
+		log.Debugf("Decompressing %s list from '%s'", compression, url)
+	}
+	err = util.DecompressFile(downloadPath, path, compression)
+	_ = os.Remove(downloadPath)
 	if err != nil {
 		return err
 	}
@@ -87,7 +191,13 @@ func Download(engine Engine, config *config.GudgeonConfig, list *config.GudgeonL
 
 	// notify of download and save to path
 	log.Infof("Downloading '%s'...", url)
-	err := downloadFile(engine, path, url)
+	// default proxy for all lists
+	defaultProxy := ""
+	if config.Download != nil {
+		defaultProxy = config.Download.Proxy
+	}
+
+	err := downloadFile(engine, path, url, list, defaultProxy)
 	if err != nil {
 		return err
 	}
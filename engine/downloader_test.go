@@ -2,7 +2,11 @@ package engine
 
 import (
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
+	"strings"
 	"testing"
 
 	"github.com/chrisruffalo/gudgeon/config"
@@ -82,3 +86,109 @@ func TestBadDownloadUrl(t *testing.T) {
 		t.Errorf("Got error during download: %s", err)
 	}
 }
+
+func TestDownloadCompressed(t *testing.T) {
+	// serve the same list with compression only given by the content type, by the extension, or not at all
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/list" {
+			w.Header().Set("Content-Type", "application/gzip")
+			http.ServeFile(w, r, "../util/testdata/compressed.list.gz")
+			return
+		}
+		http.ServeFile(w, r, "../util/testdata/"+path.Base(r.URL.Path))
+	}))
+	defer server.Close()
+
+	testConf := conf(t, "testdata/badurl.yml")
+	defer os.RemoveAll(testConf.Home)
+
+	for _, src := range []string{"/list", "/compressed.list.bz2", "/compressed.list.xz", "/compressed.list.zip", "/gzipped.list"} {
+		list := &config.GudgeonList{Name: "compressed" + src, Source: server.URL + src}
+		list.VerifyAndInit()
+
+		err := Download(nil, testConf, list)
+		if err != nil {
+			t.Errorf("Could not download '%s': %s", src, err)
+			continue
+		}
+
+		content, err := ioutil.ReadFile(testConf.PathToList(list))
+		if err != nil {
+			t.Errorf("Could not read downloaded list '%s': %s", src, err)
+			continue
+		}
+		if !strings.HasPrefix(string(content), "one.com\ntwo.com\n") {
+			t.Errorf("Downloaded list '%s' was not decompressed: %s", src, content)
+		}
+	}
+}
+
+func TestDownloadWithHeadersAndAuth(t *testing.T) {
+	_ = os.Setenv("GUDGEON_TEST_TOKEN", "secret-token")
+	defer os.Unsetenv("GUDGEON_TEST_TOKEN")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if r.Header.Get("X-Api-Token") != "secret-token" || !ok || user != "feed" || password != "secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("one.com\ntwo.com\n"))
+	}))
+	defer server.Close()
+
+	testConf := conf(t, "testdata/badurl.yml")
+	defer os.RemoveAll(testConf.Home)
+
+	list := &config.GudgeonList{
+		Name:    "authenticated",
+		Source:  server.URL + "/list",
+		Headers: map[string]string{"X-Api-Token": "${GUDGEON_TEST_TOKEN}"},
+		Auth:    &config.GudgeonListAuth{Username: "feed", Password: "$GUDGEON_TEST_TOKEN"},
+	}
+	list.VerifyAndInit()
+
+	if err := Download(nil, testConf, list); err != nil {
+		t.Errorf("Could not download authenticated list: %s", err)
+	}
+
+	// without credentials the download should fail
+	list.Headers = nil
+	list.Auth = nil
+	if err := Download(nil, testConf, list); err == nil {
+		t.Errorf("Expected error downloading without credentials")
+	}
+}
+
+func TestDownloadWithProxy(t *testing.T) {
+	// a plain http proxy receives the full url of the target in the request
+	proxied := make([]string, 0)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		_, _ = w.Write([]byte("one.com\ntwo.com\n"))
+	}))
+	defer proxy.Close()
+
+	testConf := conf(t, "testdata/badurl.yml")
+	defer os.RemoveAll(testConf.Home)
+
+	// use the default proxy
+	testConf.Download.Proxy = proxy.URL
+	list := &config.GudgeonList{Name: "proxied", Source: "http://lists.gudgeon.test/default.txt"}
+	list.VerifyAndInit()
+	if err := Download(nil, testConf, list); err != nil {
+		t.Errorf("Could not download list through default proxy: %s", err)
+	}
+
+	// override the default proxy on the list
+	testConf.Download.Proxy = "http://127.0.0.1:1"
+	list.Source = "http://lists.gudgeon.test/override.txt"
+	list.Proxy = proxy.URL
+	if err := Download(nil, testConf, list); err != nil {
+		t.Errorf("Could not download list through list proxy: %s", err)
+	}
+
+	if len(proxied) != 2 || proxied[0] != "http://lists.gudgeon.test/default.txt" || proxied[1] != "http://lists.gudgeon.test/override.txt" {
+		t.Errorf("Expected both lists to be requested through the proxy but got: %v", proxied)
+	}
+}
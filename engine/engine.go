@@ -1,7 +1,6 @@
 package engine
 
 import (
-	"bytes"
 	"database/sql"
 	"fmt"
 	"github.com/chrisruffalo/gudgeon/events"
@@ -20,7 +19,7 @@ import (
 	"github.com/chrisruffalo/gudgeon/util"
 )
 
-// incomplete list of not-implemented queries
+// incomplete list of not-implemented queries, zone transfers are answered by Transfer and not by resolution
 var notImplemented = map[uint16]bool{
 	dns.TypeNone: true,
 	dns.TypeNULL: true,
@@ -39,12 +38,22 @@ type group struct {
 	configGroup *config.GudgeonGroup
 
 	lists []*config.GudgeonList
+	// lists that are matched against the addresses in the answer
+	ipLists []*config.GudgeonList
+	// safe search rewrites, nil when the group does not enforce safe search
+	safeSearch *safeSearch
+	// rewrite rules from the group configuration and the rewrite lists of the group
+	rewrites     *rewrites
+	rewriteLists []*config.GudgeonList
 }
 
 // represents a short/name combination for a list
 type ListEntry struct {
 	Name  string `json:"name"`
 	Short string `json:"short"`
+	Type  string `json:"type"`
+	// local lists that can be changed through the engine
+	Editable bool `json:"editable"`
 }
 
 // represents a parsed "consumer" type that
@@ -62,8 +71,14 @@ type consumer struct {
 	// list of parsed resolvers that belong to this consumer
 	resolverNames []string
 
+	// the groups for the consumer depend on the time of the request
+	scheduled bool
+
 	// applicable lists
 	lists []*config.GudgeonList
+
+	// canonical names of lists that only audit block matches for this consumer
+	audited map[string]bool
 }
 
 // stores the internals of the engine abstraction
@@ -94,6 +109,18 @@ type engine struct {
 	// map for out-of-order consumer getting
 	consumerMap map[string]*consumer
 
+	// prefix tree for finding consumers by address
+	consumerIndex *consumerIndex
+
+	// token buckets for consumers and clients with rate limits
+	limiter *rateLimiter
+
+	// address rules for ip lists, by canonical list name
+	ipLists map[string]*rule.IPList
+
+	// rules for rewrite lists, by canonical list name
+	rewriteLists map[string]*rewrites
+
 	// default consumer
 	defaultConsumer *consumer
 
@@ -116,6 +143,9 @@ type engine struct {
 
 	// list of handles
 	handles []*events.Handle
+
+	// temporary pauses of blocking
+	pauses *pauses
 }
 
 func (engine *engine) Root() string {
@@ -128,6 +158,7 @@ func (engine *engine) ListPath(listType string) string {
 
 type Engine interface {
 	IsDomainRuleMatched(consumer *net.IP, domain string) (rule.Match, *config.GudgeonList, string)
+	Explain(domain string, consumerName string, groups []string, address *net.IP) (*Explanation, error)
 	Resolve(domainName string) (string, error)
 	Reverse(address string) string
 
@@ -138,12 +169,29 @@ type Engine interface {
 	HandleWithGroups(groups []string, rCon *resolver.RequestContext, request *dns.Msg) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult)
 	HandleWithResolvers(resolvers []string, rCon *resolver.RequestContext, request *dns.Msg) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult)
 
+	// zone transfers of local zones to secondary servers
+	Transfer(writer dns.ResponseWriter, request *dns.Msg)
+	// notifies from the primary servers of secondary sources
+	Notify(writer dns.ResponseWriter, request *dns.Msg)
+	// dynamic updates of local zones
+	Update(writer dns.ResponseWriter, request *dns.Msg)
+
 	// info, things by name
 	Consumers() *[]string
 	Groups() *[]string
 	Resolvers() *[]string
 	Lists() *[]*ListEntry
 
+	// runtime list changes
+	AddToList(listName string, domain string, user string, address string) (bool, error)
+	RemoveFromList(listName string, domain string, user string, address string) (bool, error)
+	ListChanges(limit int) []*ListChange
+
+	// temporarily stop blocking
+	Pause(scope string, name string, duration time.Duration) (*Pause, error)
+	Resume(scope string, name string) bool
+	Pauses() []*Pause
+
 	// stats
 	CacheSize() int64
 
@@ -159,42 +207,28 @@ type Engine interface {
 }
 
 func (engine *engine) getConsumerForIP(consumerIP *net.IP) *consumer {
+	return engine.getConsumerForClient(consumerIP, nil)
+}
+
+// find the consumer for the client address and any identity (mac, cpe id) that a forwarder added to the query
+func (engine *engine) getConsumerForClient(consumerIP *net.IP, identity *util.ClientIdentity) *consumer {
 	var foundConsumer *consumer
 
-	for _, activeConsumer := range engine.consumers {
-		for _, match := range activeConsumer.configConsumer.Matches {
-			// test ip match
-			if "" != match.IP {
-				matchIP := net.ParseIP(match.IP)
-				if matchIP != nil && bytes.Compare(matchIP.To16(), consumerIP.To16()) == 0 {
-					foundConsumer = activeConsumer
-					break
-				}
-			}
-			// test range match
-			if foundConsumer == nil && match.Range != nil && "" != match.Range.Start && "" != match.Range.End {
-				startIP := net.ParseIP(match.Range.Start)
-				endIP := net.ParseIP(match.Range.End)
-				if startIP != nil && endIP != nil && bytes.Compare(consumerIP.To16(), startIP.To16()) >= 0 && bytes.Compare(consumerIP.To16(), endIP.To16()) <= 0 {
-					foundConsumer = activeConsumer
-					break
-				}
-			}
-			// test net (subnet) match
-			if foundConsumer == nil && "" != match.Net {
-				_, parsedNet, err := net.ParseCIDR(match.Net)
-				if err == nil && parsedNet != nil && parsedNet.Contains(*consumerIP) {
-					foundConsumer = activeConsumer
-					break
-				}
-			}
-			if foundConsumer != nil {
-				break
-			}
-		}
-		if foundConsumer != nil {
-			break
-		}
+	var (
+		ip    net.IP
+		mac   string
+		cpeID string
+	)
+	if consumerIP != nil {
+		ip = *consumerIP
+	}
+	if identity != nil {
+		mac, cpeID = identity.MAC, identity.CpeID
+	}
+
+	// the index holds the parsed matches of every consumer and finds the first declared consumer that matches
+	if found := engine.consumerIndex.findClient(ip, mac, cpeID); found != noConsumer && found < len(engine.consumers) {
+		foundConsumer = engine.consumers[found]
 	}
 
 	// return default consumer
@@ -211,8 +245,13 @@ func (engine *engine) getConsumerGroups(consumerIP *net.IP) []string {
 }
 
 func (engine *engine) getGroups(consumer *consumer) []string {
-	// return found consumer data if something was found
-	if consumer != nil && len(consumer.groupNames) > 0 {
+	// groups for consumers with schedules depend on the time of the request
+	if consumer != nil && consumer.scheduled {
+		if groups := engine.groupsAt(consumer, time.Now()); len(groups) > 0 {
+			return groups
+		}
+	} else if consumer != nil && len(consumer.groupNames) > 0 {
+		// return found consumer data if something was found
 		return consumer.groupNames
 	}
 
@@ -220,6 +259,36 @@ func (engine *engine) getGroups(consumer *consumer) []string {
 	return []string{"default"}
 }
 
+// the groups that apply to the consumer at the given time, in the order the groups are configured. these are the
+// consumer's groups and the groups from any of the consumer's active schedules, leaving out groups whose own
+// schedule is not active.
+func (engine *engine) groupsAt(consumer *consumer, at time.Time) []string {
+	if consumer == nil || consumer.configConsumer == nil {
+		return []string{}
+	}
+
+	names := make([]string, 0, len(consumer.configConsumer.Groups))
+	names = append(names, consumer.configConsumer.Groups...)
+	for _, schedule := range consumer.configConsumer.Schedules {
+		if schedule != nil && schedule.Active(at) {
+			names = append(names, schedule.Groups...)
+		}
+	}
+
+	groups := make([]string, 0, len(names))
+	for _, configGroup := range engine.config.Groups {
+		if !util.StringIn(configGroup.Name, names) || util.StringIn(configGroup.Name, groups) {
+			continue
+		}
+		if _, found := engine.groups[configGroup.Name]; !found || !configGroup.Schedule.Active(at) {
+			continue
+		}
+		groups = append(groups, configGroup.Name)
+	}
+
+	return groups
+}
+
 func (engine *engine) getConsumerResolvers(consumerIP *net.IP) []string {
 	consumer := engine.getConsumerForIP(consumerIP)
 	return engine.getResolvers(consumer)
@@ -242,7 +311,20 @@ func (engine *engine) IsDomainRuleMatched(consumerIp *net.IP, domain string) (ru
 	return engine.domainRuleMatchedForConsumer(consumer, domain)
 }
 
-func (engine *engine) domainRuleMatchForLists(lists []*config.GudgeonList, domain string) (rule.Match, *config.GudgeonList, string) {
+// track which lists only audit block matches. a list is audited when the list is in audit mode or when every group
+// that it was assigned through is in audit mode.
+func addAuditedLists(audited map[string]bool, group *group) {
+	for _, list := range append(append([]*config.GudgeonList{}, group.lists...), group.ipLists...) {
+		isAudit := list.IsAudit() || group.configGroup.IsAudit()
+		if current, found := audited[list.CanonicalName()]; found {
+			audited[list.CanonicalName()] = current && isAudit
+		} else {
+			audited[list.CanonicalName()] = isAudit
+		}
+	}
+}
+
+func (engine *engine) domainRuleMatchForLists(lists []*config.GudgeonList, audited map[string]bool, domain string) (rule.Match, *config.GudgeonList, string) {
 	// drop ending . if present from domain
 	if strings.HasSuffix(domain, ".") {
 		domain = domain[:len(domain)-1]
@@ -258,15 +340,56 @@ func (engine *engine) domainRuleMatchForLists(lists []*config.GudgeonList, domai
 		return rule.MatchNone, nil, ""
 	}
 
+	match, list, ruleText := engine.store.FindMatch(lists, domain)
+
+	// a block from an audited list is only enforced if a list that is not audited also blocks the domain
+	if match == rule.MatchBlock && list != nil && audited[list.CanonicalName()] {
+		enforced := make([]*config.GudgeonList, 0, len(lists))
+		for _, l := range lists {
+			if !audited[l.CanonicalName()] {
+				enforced = append(enforced, l)
+			}
+		}
+		if len(enforced) > 0 {
+			if enforcedMatch, enforcedList, enforcedRule := engine.store.FindMatch(enforced, domain); enforcedMatch == rule.MatchBlock {
+				return enforcedMatch, enforcedList, enforcedRule
+			}
+		}
+		return rule.MatchWouldBlock, list, ruleText
+	}
+
 	// return match values
-	return engine.store.FindMatch(lists, domain)
+	return match, list, ruleText
+}
+
+// the lists that apply to the consumer and which of them are audited, consumers with schedules get the lists of
+// the groups that currently apply
+func (engine *engine) consumerLists(consumer *consumer) ([]*config.GudgeonList, map[string]bool) {
+	if consumer.scheduled {
+		return engine.groupLists(engine.getGroups(consumer))
+	}
+	return consumer.lists, consumer.audited
+}
+
+// select all lists from found groups
+func (engine *engine) groupLists(groups []string) ([]*config.GudgeonList, map[string]bool) {
+	lists := make([]*config.GudgeonList, 0)
+	audited := make(map[string]bool)
+	for _, g := range groups {
+		if group, found := engine.groups[g]; found {
+			lists = append(lists, group.lists...)
+			addAuditedLists(audited, group)
+		}
+	}
+	return lists, audited
 }
 
 func (engine *engine) domainRuleMatchedForConsumer(consumer *consumer, domain string) (rule.Match, *config.GudgeonList, string) {
 	if consumer == nil {
 		return rule.MatchNone, nil, ""
 	}
-	return engine.domainRuleMatchForLists(consumer.lists, domain)
+	lists, audited := engine.consumerLists(consumer)
+	return engine.domainRuleMatchForLists(lists, audited, domain)
 }
 
 func (engine *engine) domainRuleMatchedForGroups(groups []string, domain string) (rule.Match, *config.GudgeonList, string) {
@@ -274,25 +397,22 @@ func (engine *engine) domainRuleMatchedForGroups(groups []string, domain string)
 		return rule.MatchNone, nil, ""
 	}
 
-	// select all lists from found groups
-	lists := make([]*config.GudgeonList, 0)
-	for _, g := range groups {
-		if group, found := engine.groups[g]; found {
-			lists = append(lists, group.lists...)
-		}
-	}
-
-	return engine.domainRuleMatchForLists(lists, domain)
+	lists, audited := engine.groupLists(groups)
+	return engine.domainRuleMatchForLists(lists, audited, domain)
 }
 
-// handles recursive resolution of cnames
-func (engine *engine) handleCnameResolution(resolvers []string, rCon *resolver.RequestContext, originalRequest *dns.Msg, originalResponse *dns.Msg) *dns.Msg {
+// handles recursive resolution of cnames, the result of resolving the cname target is also returned so that rule
+// matches further down the chain can be found
+func (engine *engine) handleCnameResolution(resolvers []string, rCon *resolver.RequestContext, originalRequest *dns.Msg, originalResponse *dns.Msg) (*dns.Msg, *resolver.ResolutionResult) {
 	// scope provided finding response
-	var response *dns.Msg
+	var (
+		response    *dns.Msg
+		cnameResult *resolver.ResolutionResult
+	)
 
 	// guard
 	if originalResponse == nil || len(originalResponse.Answer) < 1 || originalRequest == nil || len(originalRequest.Question) < 1 {
-		return nil
+		return nil, nil
 	}
 
 	// if the (first) response is a CNAME then repeat the question but with the cname instead
@@ -303,10 +423,16 @@ func (engine *engine) handleCnameResolution(resolvers []string, rCon *resolver.R
 		cnameRequest.Question[0].Name = newName
 
 		var cnameResponse *dns.Msg
+		// an explicitly allowed name is answered with where it points even when the target is blocked
+		allowed := false
 		if len(rCon.Groups) > 0 {
-			cnameResponse, _, _ = engine.HandleWithGroups(rCon.Groups, rCon, cnameRequest)
+			match, _, _ := engine.domainRuleMatchedForGroups(rCon.Groups, originalRequest.Question[0].Name)
+			allowed = match == rule.MatchAllow
+		}
+		if len(rCon.Groups) > 0 && !allowed {
+			cnameResponse, _, cnameResult = engine.HandleWithGroups(rCon.Groups, rCon, cnameRequest)
 		} else {
-			cnameResponse, _, _ = engine.HandleWithResolvers(resolvers, rCon, cnameRequest)
+			cnameResponse, _, cnameResult = engine.HandleWithResolvers(resolvers, rCon, cnameRequest)
 		}
 		if cnameResponse != nil && !util.IsEmptyResponse(cnameResponse) {
 			// use response
@@ -320,7 +446,7 @@ func (engine *engine) handleCnameResolution(resolvers []string, rCon *resolver.R
 		}
 	}
 
-	return response
+	return response, cnameResult
 }
 
 func (engine *engine) invalidRequestHandler(request *dns.Msg) (bool, *dns.Msg) {
@@ -360,6 +486,14 @@ func (engine *engine) invalidRequestHandler(request *dns.Msg) (bool, *dns.Msg) {
 	return true, nil
 }
 
+// the response given for a blocked request
+func blockedResponse(request *dns.Msg) *dns.Msg {
+	response := new(dns.Msg)
+	response.SetReply(request)
+	response.Rcode = dns.RcodeNameError
+	return response
+}
+
 func (engine *engine) HandleWithResolvers(resolverNames []string, rCon *resolver.RequestContext, request *dns.Msg) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult) {
 	// scope provided finding response
 	var (
@@ -375,6 +509,10 @@ func (engine *engine) HandleWithResolvers(resolverNames []string, rCon *resolver
 		return response, rCon, result
 	}
 
+	// rule matches on the answer (cname targets and addresses), results are pooled so the values are always set
+	match, list, ruleText := rule.MatchNone, (*config.GudgeonList)(nil), ""
+	paused := false
+
 	// we are only doing resolution if there are resolvers to resolve against, otherwise
 	// we can skip this part and just return an NXDOMAIN
 	if len(resolverNames) > 0 {
@@ -383,13 +521,47 @@ func (engine *engine) HandleWithResolvers(resolverNames []string, rCon *resolver
 		if err != nil {
 			log.Errorf("Could not resolve <%s>: %s", request.Question[0].Name, err)
 		} else {
-			cnameResponse := engine.handleCnameResolution(resolverNames, rCon, request, response)
+			// the chain is checked before it is followed because following it replaces the cname records
+			cnameResponse, cnameResult := engine.handleCnameResolution(resolverNames, rCon, request, response)
+			if rCon != nil {
+				match, list, ruleText, paused = engine.cnameRuleMatchedForGroups(rCon.Groups, request, response, cnameResult)
+			}
 			if !util.IsEmptyResponse(cnameResponse) {
 				response = cnameResponse
 			}
 		}
 	}
 
+	if result == nil {
+		result = &resolver.ResolutionResult{}
+	}
+
+	// the addresses in the answer are checked against the ip lists of the groups
+	if rCon != nil && response != nil && match != rule.MatchBlock {
+		if ipMatch, ipList, ipRule := engine.responseRuleMatchedForGroups(rCon.Groups, response); ipMatch == rule.MatchBlock || match == rule.MatchNone {
+			match, list, ruleText, paused = ipMatch, ipList, ipRule, false
+		}
+	}
+	if rCon != nil && match == rule.MatchBlock && engine.pauses.find(rCon.Consumer, rCon.Groups) != nil {
+		match = rule.MatchWouldBlock
+		paused = true
+	}
+	result.Match = match
+	result.MatchList = list
+	result.MatchRule = ruleText
+	result.Paused = paused
+
+	// block the whole response when a cname target or an address in it is blocked
+	if match == rule.MatchBlock {
+		response = blockedResponse(request)
+	}
+
+	// answers from local sources may point anywhere but public answers may not point into the local network
+	result.Rebinding = false
+	if rCon != nil && match != rule.MatchBlock && !result.Local {
+		response, result.Rebinding = engine.protectRebinding(rCon.Groups, request, response)
+	}
+
 	// if no response is found at this point ensure it is created
 	if response == nil {
 		response = new(dns.Msg)
@@ -423,6 +595,25 @@ func (engine *engine) HandleWithResolvers(resolverNames []string, rCon *resolver
 	return response, rCon, result
 }
 
+// the resolvers of the groups, in the given order
+func (engine *engine) groupResolverNames(groups []string) []string {
+	// accumulate resolver names, up to a maximum of resolvers before having to append
+	resolverNames := make([]string, 0, len(engine.config.Resolvers))
+
+	// get the resolver names for the groups, in the given order
+	for _, groupName := range groups {
+		// get resolvers from group
+		group, found := engine.groups[groupName]
+		if !found {
+			continue
+		}
+
+		resolverNames = append(resolverNames, group.configGroup.Resolvers...)
+	}
+
+	return resolverNames
+}
+
 func (engine *engine) HandleWithGroups(groups []string, rCon *resolver.RequestContext, request *dns.Msg) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult) {
 	// create new result
 	result := &resolver.ResolutionResult{}
@@ -438,6 +629,35 @@ func (engine *engine) HandleWithGroups(groups []string, rCon *resolver.RequestCo
 	}
 	rCon.Groups = groups
 
+	// query type policies answer before the name is checked or resolved. the policy of a group in audit mode, or
+	// while a pause applies, is only recorded and the query is resolved.
+	policyRule, policyPaused := "", false
+	if policy, policyGroup := engine.queryTypePolicyFor(groups, request); policy != nil {
+		policyRule = queryTypeRuleText(request.Question[0].Qtype, policy.Action)
+		if !policyGroup.configGroup.IsAudit() {
+			policyPaused = engine.pauses.find(rCon.Consumer, groups) != nil
+			if !policyPaused {
+				result.Match = rule.MatchBlock
+				result.MatchRule = policyRule
+				result.QueryTypePolicy = true
+				return queryTypeResponse(policy, request), rCon, result
+			}
+		}
+	}
+
+	// rewrite rules answer before the name is checked against the lists
+	if found, rewriteList := engine.rewriteFor(groups, request.Question[0].Name); found != nil {
+		response, rewriteResult := engine.rewriteResponse(engine.groupResolverNames(groups), rCon, request, found.targets)
+		// a blocked target stays blocked
+		if rewriteResult.Match != rule.MatchBlock {
+			rewriteResult.Match = rule.MatchRewrite
+			rewriteResult.MatchList = rewriteList
+			rewriteResult.MatchRule = found.String()
+			rewriteResult.Paused = false
+		}
+		return response, rCon, rewriteResult
+	}
+
 	match, list, ruleText := engine.domainRuleMatchedForGroups(groups, request.Question[0].Name)
 	if match != rule.MatchNone {
 		result.Match = match
@@ -445,30 +665,50 @@ func (engine *engine) HandleWithGroups(groups []string, rCon *resolver.RequestCo
 		result.MatchRule = ruleText
 	}
 
+	// blocking is skipped while a pause applies to the consumer, any of the groups, or everything
+	paused := false
+	if match == rule.MatchBlock && engine.pauses.find(rCon.Consumer, groups) != nil {
+		match = rule.MatchWouldBlock
+		result.Match = match
+		paused = true
+	}
+
+	// a query type policy that was not enforced is recorded when no list matched the name
+	if match == rule.MatchNone && "" != policyRule {
+		match, ruleText, paused = rule.MatchWouldBlock, policyRule, policyPaused
+		result.Match = match
+		result.MatchRule = ruleText
+	}
+	result.Paused = paused
+
 	// handle blocking at the group level
 	if match == rule.MatchBlock {
-		// todo: do configured action here
-		response := new(dns.Msg)
-		response.SetReply(request)
-		response.Rcode = dns.RcodeNameError
-		return response, rCon, result
+		return blockedResponse(request), rCon, result
 	}
 
-	// accumulate resolver names, up to a maximum of resolvers before having to append
-	resolverNames := make([]string, 0, len(engine.config.Resolvers))
+	resolverNames := engine.groupResolverNames(groups)
 
-	// get the resolver names for the groups, in the given order
-	for _, groupName := range groups {
-		// get resolvers from group
-		group, found := engine.groups[groupName]
-		if !found {
-			continue
-		}
+	// search engine names are answered with the safe search endpoint instead
+	var (
+		response       *dns.Msg
+		resolvedResult *resolver.ResolutionResult
+	)
+	if target := engine.safeSearchTarget(groups, request.Question[0].Name); "" != target {
+		response, resolvedResult = engine.safeSearchResponse(resolverNames, rCon, request, target)
+	} else {
+		response, rCon, resolvedResult = engine.HandleWithResolvers(resolverNames, rCon, request)
+	}
 
-		resolverNames = append(resolverNames, group.configGroup.Resolvers...)
+	// keep the rule match (allow or would block) on the result from resolution so that it is recorded unless an
+	// address in the answer was blocked (or would have been if blocking was not paused)
+	if resolvedResult != nil && resolvedResult.Match != rule.MatchBlock && !resolvedResult.Paused && (match != rule.MatchNone || resolvedResult.Match == rule.MatchNone) {
+		resolvedResult.Match = match
+		resolvedResult.MatchList = list
+		resolvedResult.MatchRule = ruleText
+		resolvedResult.Paused = paused
 	}
 
-	return engine.HandleWithResolvers(resolverNames, rCon, request)
+	return response, rCon, resolvedResult
 }
 
 func (engine *engine) HandleWithConsumerName(consumerName string, rCon *resolver.RequestContext, request *dns.Msg) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult) {
@@ -496,6 +736,14 @@ func (engine *engine) HandleWithConsumer(consumer *consumer, rCon *resolver.Requ
 	// get groups for consumer
 	groups := engine.getGroups(consumer)
 
+	// keep the consumer name on the context so that pauses for the consumer apply
+	if rCon == nil {
+		rCon = &resolver.RequestContext{}
+	}
+	if consumer != nil && consumer.configConsumer != nil {
+		rCon.Consumer = consumer.configConsumer.Name
+	}
+
 	// return group response
 	response, rCon, result := engine.HandleWithGroups(groups, rCon, request)
 
@@ -578,10 +826,31 @@ func (engine *engine) Reverse(address string) string {
 	return ""
 }
 
+// the address and identity of the client that sent the request. only a trusted forwarder can identify the original
+// client with edns0 options, the options from any other source are ignored and the address it sent from is used.
+func (engine *engine) identifyClient(address *net.IP, request *dns.Msg) (*net.IP, *util.ClientIdentity) {
+	if engine.config.Network == nil || address == nil || !engine.config.Network.ClientIdentity.Trusts(*address) {
+		return address, nil
+	}
+	identity := util.ClientIdentityFromRequest(request, engine.config.Network.ClientIdentity.StripOptions())
+	if identity != nil && identity.IP != nil {
+		address = &identity.IP
+	}
+	return address, identity
+}
+
 // entry point for external handler
 func (engine *engine) Handle(address *net.IP, protocol string, request *dns.Msg) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult) {
+	// a trusted forwarder can identify the original client with edns0 options
+	address, identity := engine.identifyClient(address, request)
+
 	// get consumer
-	consumer := engine.getConsumerForIP(address)
+	consumer := engine.getConsumerForClient(address, identity)
+
+	// queries over a rate limit are refused or dropped without being resolved
+	if allowed, limit, limited := engine.limiter.allow(consumer, address, protocol, request); !allowed {
+		return engine.rateLimited(address, protocol, consumer, request, limit, limited)
+	}
 
 	// create context
 	rCon := resolver.DefaultRequestContext()
@@ -608,6 +877,42 @@ func (engine *engine) Handle(address *net.IP, protocol string, request *dns.Msg)
 	return response, rCon, result
 }
 
+// respond to a query that is over a rate limit. a dropped query has no response. limited queries are only queued
+// for recording when there is a count of limited queries to report so that a flood doesn't also flood the recorder.
+func (engine *engine) rateLimited(address *net.IP, protocol string, consumer *consumer, request *dns.Msg, limit *config.GudgeonRateLimit, limited int64) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult) {
+	rCon := &resolver.RequestContext{
+		Protocol: protocol,
+		Started:  time.Now(),
+	}
+	result := &resolver.ResolutionResult{
+		RateLimited:        true,
+		RateLimitedQueries: limited,
+	}
+	if consumer != nil && consumer.configConsumer != nil {
+		rCon.Consumer = consumer.configConsumer.Name
+		result.Consumer = consumer.configConsumer.Name
+	}
+
+	var response *dns.Msg
+	if !limit.Drops() {
+		response = new(dns.Msg)
+		response.SetReply(request)
+		response.Rcode = dns.RcodeRefused
+	}
+
+	if engine.recorder != nil && limited > 0 {
+		finishedTime := time.Now()
+		engine.recorder.queue(address, request, response, rCon, result, &finishedTime)
+	}
+
+	return response, rCon, result
+}
+
+// record the limited queries that were left in a bucket after a flood stopped with the first of those queries
+func (engine *engine) reportRateLimited(query *limitedQuery, limit *config.GudgeonRateLimit, limited int64) {
+	engine.rateLimited(query.address, query.protocol, query.consumer, query.request, limit, limited)
+}
+
 func (engine *engine) CacheSize() int64 {
 	if engine.resolvers != nil && engine.resolvers.Cache() != nil {
 		return int64(engine.resolvers.Cache().Size())
@@ -637,6 +942,10 @@ func (engine *engine) Close() {
 	// close rule store
 	log.Debugf("Closing database store...")
 	engine.store.Close()
+	// stop reloading the neighbor table
+	engine.consumerIndex.close()
+	// stop reporting rate limited queries
+	engine.limiter.close()
 	// clear references
 	engine.db = nil
 	engine.qlog = nil
@@ -645,6 +954,9 @@ func (engine *engine) Close() {
 }
 
 func (engine *engine) Shutdown() {
+	// stop reporting rate limited queries before the recorder is gone
+	engine.limiter.close()
+
 	// shutting down the recorder shuts down
 	// other elements in turn
 	if nil != engine.recorder {
@@ -700,7 +1012,10 @@ func (engine *engine) Lists() *[]*ListEntry {
 	if engine.listEntries == nil {
 		entries := make([]*ListEntry, 0, len(engine.config.Lists))
 		for _, l := range engine.config.Lists {
-			entries = append(entries, &ListEntry{Name: l.CanonicalName(), Short: l.ShortName()})
+			if l.IsManifest() {
+				continue
+			}
+			entries = append(entries, &ListEntry{Name: l.CanonicalName(), Short: l.ShortName(), Type: l.Type, Editable: editableList(engine.config, l)})
 		}
 		engine.listEntries = &entries
 	}
@@ -29,7 +29,13 @@ func assignedLists(listNames []string, listTags []string, lists []*config.Gudgeo
 
 	// check names
 	for _, list := range lists {
-		if util.StringIn(list.Name, listNames) {
+		// manifests don't hold rules, the lists they expand to are assigned instead
+		if list.IsManifest() {
+			continue
+		}
+
+		// lists expanded from a manifest are also assigned by the name of the manifest
+		if util.StringIn(list.Name, listNames) || ("" != list.Manifest() && util.StringIn(list.Manifest(), listNames)) {
 			should = append(should, list)
 			continue
 		}
@@ -95,6 +101,7 @@ func newEngineWithComponents(conf *config.GudgeonConfig, db *sql.DB, recorder *r
 		metrics:  metrics,
 		qlog:     queryLog,
 		handles:  make([]*events.Handle, 0),
+		pauses:   newPauses(),
 	}
 
 	err := engine.bootstrap()
@@ -187,6 +194,9 @@ func (engine *engine) bootstrap() error {
 	// configure resolvers
 	engine.resolvers = resolver.NewResolverMap(conf, conf.Resolvers)
 
+	// expand manifests into lists before lists are assigned to groups
+	expandManifests(engine, conf)
+
 	// use length of working groups to make list of active groups
 	groups := make([]*group, len(conf.Groups))
 	groupMap := make(map[string]*group)
@@ -197,8 +207,10 @@ func (engine *engine) bootstrap() error {
 		engineGroup := &group{
 			engine:      engine,
 			configGroup: configGroup,
-			lists:       assignedLists(configGroup.Lists, configGroup.SafeTags(), conf.Lists),
 		}
+		engineGroup.lists, engineGroup.ipLists = splitIPLists(assignedLists(configGroup.Lists, configGroup.SafeTags(), conf.Lists))
+		engineGroup.lists, engineGroup.rewriteLists = splitRewriteLists(engineGroup.lists)
+		engineGroup.rewrites = groupRewrites(configGroup)
 
 		// add created engine group to list of groups
 		groups[idx] = engineGroup
@@ -214,6 +226,9 @@ func (engine *engine) bootstrap() error {
 		}
 	}
 
+	// safe search rewrites for groups
+	engine.loadSafeSearch(groups)
+
 	// attach groups to consumers
 	consumers := make([]*consumer, len(conf.Consumers))
 	consumerMap := make(map[string]*consumer)
@@ -225,6 +240,8 @@ func (engine *engine) bootstrap() error {
 			resolverNames:  make([]string, 0),
 			configConsumer: configConsumer,
 			lists:          make([]*config.GudgeonList, 0),
+			audited:        make(map[string]bool),
+			scheduled:      len(configConsumer.Schedules) > 0,
 		}
 
 		// set as default consumer
@@ -237,6 +254,14 @@ func (engine *engine) bootstrap() error {
 			if util.StringIn(group.configGroup.Name, configConsumer.Groups) {
 				consumer.groupNames = append(consumer.groupNames, group.configGroup.Name)
 
+				// groups with a schedule are checked for each request
+				if group.configGroup.Schedule != nil {
+					consumer.scheduled = true
+				}
+
+				// lists are audited for the consumer if every group that they come from audits them
+				addAuditedLists(consumer.audited, group)
+
 				// add resolvers from group too
 				if len(group.configGroup.Resolvers) > 0 {
 					consumer.resolverNames = append(consumer.resolverNames, group.configGroup.Resolvers...)
@@ -270,8 +295,8 @@ func (engine *engine) bootstrap() error {
 		// get list path
 		path := conf.PathToList(list)
 
-		// skip non-remote lists
-		if !list.IsRemote() {
+		// skip non-remote lists and manifests (which have already been downloaded)
+		if !list.IsRemote() || list.IsManifest() {
 			continue
 		}
 
@@ -295,11 +320,16 @@ func (engine *engine) bootstrap() error {
 	totalCount := uint64(0)
 	var listCounts []uint64
 	engine.store, listCounts = rule.CreateStore(engine.Root(), conf)
+	engine.loadIPLists(conf, listCounts)
+	engine.loadRewriteLists(conf, listCounts)
 
 	// use/set metrics if they are enabled
 	if engine.metrics != nil {
 		metrics := engine.metrics
 		for idx, list := range conf.Lists {
+			if list.IsManifest() {
+				continue
+			}
 			log.Debugf("List '%s' loaded %d rules", list.CanonicalName(), listCounts[idx])
 			rulesCounter := metrics.Get("rules-list-" + list.ShortName())
 			rulesCounter.Clear()
@@ -365,10 +395,16 @@ func (engine *engine) bootstrap() error {
 	// ensure handler is closed later
 	engine.handles = append(engine.handles, listChangeHandle)
 
+	// notify secondary servers when transferred zones change
+	engine.watchZoneChanges()
+
 	// set consumers as active on engine
 	engine.groups = groupMap
 	engine.consumers = consumers
 	engine.consumerMap = consumerMap
+	engine.consumerIndex = newConsumerIndex(consumers)
+	engine.consumerIndex.hostnameFor = cachedReverseLookup(engine.Reverse)
+	engine.limiter = newRateLimiter(engine.config, consumers, engine.reportRateLimited)
 
 	// try and free memory
 	debug.FreeOSMemory()
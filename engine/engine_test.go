@@ -1,9 +1,16 @@
 package engine
 
 import (
+	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
+	"path"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/miekg/dns"
 
 	"github.com/chrisruffalo/gudgeon/rule"
 	"github.com/chrisruffalo/gudgeon/testutil"
@@ -133,3 +140,747 @@ func TestReverseLookup(t *testing.T) {
 
 	engine.Shutdown()
 }
+
+func TestManifestLists(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/manifest.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	// manifest is expanded into both lists
+	if config.GetList("manifest-ads") == nil || config.GetList("manifest-allow") == nil {
+		t.Errorf("Manifest was not expanded into lists")
+	}
+	if len(*testEngine.Lists()) != 2 {
+		t.Errorf("Expected 2 lists but found %d", len(*testEngine.Lists()))
+	}
+
+	// lists are assigned to the group by the name of the manifest
+	if matched, _, _ := testEngine.IsDomainRuleMatched(parseIP("192.168.0.1"), "ads.example.com"); matched != rule.MatchBlock {
+		t.Errorf("Domain 'ads.example.com' should be blocked but it is not")
+	}
+	if matched, _, _ := testEngine.IsDomainRuleMatched(parseIP("192.168.0.1"), "allowed.example.com"); matched == rule.MatchBlock {
+		t.Errorf("Domain 'allowed.example.com' should be allowed but it is blocked")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/explain.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	// default consumer sees both the block and the allow rule and the allow rule wins
+	explanation, err := testEngine.Explain("allowed.example.com.", "", nil, parseIP("192.168.0.1"))
+	if err != nil {
+		t.Errorf("Could not explain domain: %s", err)
+		return
+	}
+	if len(explanation.Matches) != 2 || explanation.Match != rule.MatchAllow || explanation.Blocked {
+		t.Errorf("Unexpected explanation: %v", explanation)
+	}
+	for _, match := range explanation.Matches {
+		if match.Winner != (match.List == "exceptions") {
+			t.Errorf("Unexpected winner state for list '%s'", match.List)
+		}
+	}
+
+	// the consumer matched by ip only has the block list
+	explanation, err = testEngine.Explain("allowed.example.com", "", nil, parseIP("192.168.0.5"))
+	if err != nil {
+		t.Errorf("Could not explain domain: %s", err)
+		return
+	}
+	if explanation.Consumer != "kids" || len(explanation.Matches) != 1 || !explanation.Blocked {
+		t.Errorf("Unexpected explanation for consumer: %v", explanation)
+	}
+
+	// explain by group
+	explanation, err = testEngine.Explain("ads.example.com", "", []string{"strict"}, nil)
+	if err != nil || !explanation.Blocked || !explanation.Matches[0].Winner {
+		t.Errorf("Unexpected explanation for group: %v (%v)", explanation, err)
+	}
+
+	// unknown groups and consumers are errors
+	if _, err := testEngine.Explain("ads.example.com", "", []string{"missing"}, nil); err == nil {
+		t.Errorf("Expected error for missing group")
+	}
+	if _, err := testEngine.Explain("ads.example.com", "missing", nil, nil); err == nil {
+		t.Errorf("Expected error for missing consumer")
+	}
+}
+
+func TestAuditMode(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/audit.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	data := []struct {
+		ip       string
+		domain   string
+		expected rule.Match
+		list     string
+	}{
+		// only the audited list matches
+		{"192.168.0.1", "ads.example.com", rule.MatchWouldBlock, "trial"},
+		// the audited list matches first but an enforced list also blocks
+		{"192.168.0.1", "allowed.example.com", rule.MatchBlock, "enforced"},
+		{"192.168.0.1", "other.example.com", rule.MatchNone, ""},
+		// the list is audited through the group
+		{"192.168.0.9", "allowed.example.com", rule.MatchWouldBlock, "enforced"},
+		{"192.168.0.9", "ads.example.com", rule.MatchNone, ""},
+	}
+
+	for _, d := range data {
+		match, list, _ := testEngine.IsDomainRuleMatched(parseIP(d.ip), d.domain)
+		if match != d.expected {
+			t.Errorf("%s >> Expected match %d for '%s' but got %d", d.ip, d.expected, d.domain, match)
+		}
+		if "" != d.list && (list == nil || list.CanonicalName() != d.list) {
+			t.Errorf("%s >> Expected match for '%s' in list '%s' but got %v", d.ip, d.domain, d.list, list)
+		}
+	}
+}
+
+func TestPause(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/pause.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	request := new(dns.Msg)
+	request.SetQuestion("ads.example.com.", dns.TypeA)
+
+	checkConsumer := func(step string, consumer string, expected rule.Match, paused bool) {
+		_, _, result := testEngine.HandleWithConsumerName(consumer, nil, request)
+		if result == nil || result.Match != expected || result.Paused != paused {
+			t.Errorf("%s >> Expected match %d (paused: %t) for consumer '%s' but got %v", step, expected, paused, consumer, result)
+		}
+	}
+
+	checkConsumer("before pause", "kid", rule.MatchBlock, false)
+
+	if _, err := testEngine.Pause(PauseConsumer, "kid", time.Minute); err != nil {
+		t.Errorf("Could not pause consumer: %s", err)
+	}
+	checkConsumer("consumer pause", "kid", rule.MatchWouldBlock, true)
+	checkConsumer("consumer pause", "default", rule.MatchBlock, false)
+	if len(testEngine.Pauses()) != 1 {
+		t.Errorf("Expected one active pause but got %d", len(testEngine.Pauses()))
+	}
+	if !testEngine.Resume(PauseConsumer, "kid") {
+		t.Errorf("Expected consumer pause to be resumed")
+	}
+	checkConsumer("consumer resumed", "kid", rule.MatchBlock, false)
+
+	if _, err := testEngine.Pause(PauseGroup, "kids", time.Minute); err != nil {
+		t.Errorf("Could not pause group: %s", err)
+	}
+	checkConsumer("group pause", "kid", rule.MatchWouldBlock, true)
+	checkConsumer("group pause", "default", rule.MatchBlock, false)
+	testEngine.Resume(PauseGroup, "kids")
+
+	// unknown targets and scopes are rejected
+	if _, err := testEngine.Pause(PauseConsumer, "nobody", time.Minute); err == nil {
+		t.Errorf("Expected an error pausing an unknown consumer")
+	}
+	if _, err := testEngine.Pause("everything", "", time.Minute); err == nil {
+		t.Errorf("Expected an error pausing an unknown scope")
+	}
+
+	// global pauses expire on their own
+	if _, err := testEngine.Pause(PauseGlobal, "", 100*time.Millisecond); err != nil {
+		t.Errorf("Could not pause globally: %s", err)
+	}
+	checkConsumer("global pause", "default", rule.MatchWouldBlock, true)
+	time.Sleep(200 * time.Millisecond)
+	if len(testEngine.Pauses()) != 0 {
+		t.Errorf("Expected global pause to expire")
+	}
+	checkConsumer("global pause expired", "default", rule.MatchBlock, false)
+}
+
+func TestSchedules(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/schedule.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	internal := testEngine.(*engine)
+	kids := internal.consumerMap["kids"]
+
+	// january 1st, 2024 is a monday
+	data := []struct {
+		at       time.Time
+		expected []string
+	}{
+		{time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), []string{"default"}},
+		{time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC), []string{"default", "social-block"}},
+		{time.Date(2024, 1, 6, 22, 0, 0, 0, time.UTC), []string{"default", "weekend"}},
+		{time.Date(2024, 1, 7, 22, 0, 0, 0, time.UTC), []string{"default", "social-block", "weekend"}},
+	}
+
+	for _, d := range data {
+		groups := internal.groupsAt(kids, d.at)
+		if len(groups) != len(d.expected) {
+			t.Errorf("Expected groups %v at %s but got %v", d.expected, d.at, groups)
+			continue
+		}
+		for idx := range groups {
+			if groups[idx] != d.expected[idx] {
+				t.Errorf("Expected groups %v at %s but got %v", d.expected, d.at, groups)
+				break
+			}
+		}
+	}
+
+	// the lists for the consumer follow the groups that currently apply
+	lists, _ := internal.groupLists(internal.groupsAt(kids, time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC)))
+	if match, _, _ := internal.domainRuleMatchForLists(lists, nil, "ads.example.com"); match != rule.MatchBlock {
+		t.Errorf("Expected domain to be blocked during the schedule but got %d", match)
+	}
+	lists, _ = internal.groupLists(internal.groupsAt(kids, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)))
+	if match, _, _ := internal.domainRuleMatchForLists(lists, nil, "ads.example.com"); match != rule.MatchNone {
+		t.Errorf("Expected domain to not be blocked outside of the schedule but got %d", match)
+	}
+}
+
+func TestClientIdentity(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/identity.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+	internal := testEngine.(*engine)
+
+	identity := config.Network.ClientIdentity
+	for address, expected := range map[string]bool{"192.168.0.1": true, "10.10.4.5": true, "192.168.0.2": false} {
+		if trusted := identity.Trusts(net.ParseIP(address)); trusted != expected {
+			t.Errorf("Expected forwarder %s trusted to be %t", address, expected)
+		}
+	}
+
+	data := []struct {
+		option   dns.EDNS0
+		expected string
+	}{
+		{&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 32, Address: net.ParseIP("192.168.0.25").To4()}, "laptop"},
+		{&dns.EDNS0_LOCAL{Code: util.EdnsMacOption, Data: []byte{0xaa, 0xbb, 0xcc, 0x00, 0x11, 0x22}}, "tablet"},
+		{&dns.EDNS0_LOCAL{Code: util.EdnsCpeIdOption, Data: []byte("upstairs")}, "laptop"},
+		{&dns.EDNS0_LOCAL{Code: util.EdnsCpeIdOption, Data: []byte("downstairs")}, "default"},
+	}
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion("example.com.", dns.TypeA)
+		request.SetEdns0(4096, false)
+		request.IsEdns0().Option = append(request.IsEdns0().Option, d.option)
+
+		clientIdentity := util.ClientIdentityFromRequest(request, true)
+		address := parseIP("192.168.0.1")
+		if clientIdentity != nil && clientIdentity.IP != nil {
+			address = &clientIdentity.IP
+		}
+		consumer := internal.getConsumerForClient(address, clientIdentity)
+		if consumer == nil || consumer.configConsumer.Name != d.expected {
+			t.Errorf("Expected consumer '%s' for option %v but got %v", d.expected, d.option, consumer)
+		}
+
+		// a client that isn't a trusted forwarder can't use the options to change its address or consumer
+		untrusted := parseIP("192.168.0.2")
+		address, clientIdentity = internal.identifyClient(untrusted, request)
+		if clientIdentity != nil || address == nil || !address.Equal(*untrusted) {
+			t.Errorf("Expected untrusted client to keep its own address but got %v (%v)", address, clientIdentity)
+		}
+		if consumer := internal.getConsumerForClient(address, clientIdentity); consumer == nil || consumer.configConsumer.Name != "default" {
+			t.Errorf("Expected default consumer for untrusted client with option %v but got %v", d.option, consumer)
+		}
+	}
+}
+
+func TestListEditing(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/edit.yml")
+	defer os.RemoveAll(config.Home)
+
+	// edit a copy of the list
+	listPath := path.Join(config.Home, "editable.list")
+	if err := ioutil.WriteFile(listPath, []byte("# allowed domains\nallowed.example.com\n"), 0644); err != nil {
+		t.Errorf("Could not create list: %s", err)
+		return
+	}
+	config.GetList("editable").Source = listPath
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	if changed, err := testEngine.AddToList("editable", "New.Example.com.", "admin", "192.168.0.1"); err != nil || !changed {
+		t.Errorf("Expected domain to be added: %v", err)
+	}
+	if changed, err := testEngine.AddToList("editable", "new.example.com", "admin", "192.168.0.1"); err != nil || changed {
+		t.Errorf("Expected domain to already be in list: %v", err)
+	}
+	if changed, err := testEngine.RemoveFromList("editable", "allowed.example.com", "", "192.168.0.2"); err != nil || !changed {
+		t.Errorf("Expected domain to be removed: %v", err)
+	}
+
+	content, _ := ioutil.ReadFile(listPath)
+	if string(content) != "# allowed domains\nnew.example.com\n" {
+		t.Errorf("Unexpected list content after edits:\n%s", string(content))
+	}
+
+	// invalid edits
+	if _, err := testEngine.AddToList("missing", "new.example.com", "", ""); err == nil {
+		t.Errorf("Expected error adding to missing list")
+	}
+	if _, err := testEngine.AddToList("patterns", "new.example.com", "", ""); err == nil {
+		t.Errorf("Expected error adding to regex list")
+	}
+	if _, err := testEngine.AddToList("editable", "not a domain", "", ""); err == nil {
+		t.Errorf("Expected error adding invalid domain")
+	}
+
+	// changes are recorded newest first
+	changes := testEngine.ListChanges(10)
+	if len(changes) != 2 {
+		t.Errorf("Expected 2 list changes but found %d", len(changes))
+		return
+	}
+	if changes[0].Action != "remove" || changes[0].Domain != "allowed.example.com" || changes[0].Address != "192.168.0.2" {
+		t.Errorf("Unexpected latest change: %v", changes[0])
+	}
+	if changes[1].Action != "add" || changes[1].Domain != "new.example.com" || changes[1].User != "admin" {
+		t.Errorf("Unexpected first change: %v", changes[1])
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/rate_limit.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	request := new(dns.Msg)
+	request.SetQuestion("ads.example.com.", dns.TypeA)
+
+	checkClient := func(step string, address string, limited bool, rcode int) {
+		ip := net.ParseIP(address)
+		response, _, result := testEngine.Handle(&ip, "udp", request)
+		if result == nil || result.RateLimited != limited {
+			t.Errorf("%s >> Expected rate limited %t for %s but got %v", step, limited, address, result)
+			return
+		}
+		if rcode < 0 {
+			if response != nil {
+				t.Errorf("%s >> Expected query from %s to be dropped but got a response", step, address)
+			}
+		} else if response == nil || response.Rcode != rcode {
+			t.Errorf("%s >> Expected rcode %s for %s but got %v", step, dns.RcodeToString[rcode], address, response)
+		}
+	}
+
+	// the client limit of the consumer drops queries
+	checkClient("client burst", "192.168.0.1", false, dns.RcodeNameError)
+	checkClient("client burst", "192.168.0.1", false, dns.RcodeNameError)
+	checkClient("client limited", "192.168.0.1", true, -1)
+
+	// the shared consumer limit refuses queries even when the client has tokens left
+	checkClient("consumer burst", "192.168.0.2", false, dns.RcodeNameError)
+	checkClient("consumer limited", "192.168.0.2", true, dns.RcodeRefused)
+
+	// the network client limit applies to consumers without their own
+	checkClient("network burst", "10.0.0.1", false, dns.RcodeNameError)
+	checkClient("network limited", "10.0.0.1", true, dns.RcodeRefused)
+	checkClient("other client", "10.0.0.2", false, dns.RcodeNameError)
+}
+
+func TestIPLists(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/ip_lists.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	data := []struct {
+		domain   string
+		qtype    uint16
+		expected rule.Match
+		list     string
+		rcode    int
+	}{
+		{"bad.example.com.", dns.TypeA, rule.MatchBlock, "block-ips", dns.RcodeNameError},
+		{"bad6.example.com.", dns.TypeAAAA, rule.MatchBlock, "block-ips", dns.RcodeNameError},
+		// the address is in the blocked range but is also allowed
+		{"allowed.example.com.", dns.TypeA, rule.MatchNone, "", dns.RcodeSuccess},
+		{"good.example.com.", dns.TypeA, rule.MatchNone, "", dns.RcodeSuccess},
+		// the audited list only records the match
+		{"trial.example.com.", dns.TypeA, rule.MatchWouldBlock, "trial-ips", dns.RcodeSuccess},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(d.domain, d.qtype)
+		response, _, result := testEngine.HandleWithConsumerName("default", nil, request)
+		if response == nil || response.Rcode != d.rcode {
+			t.Errorf("Expected rcode %s for '%s' but got %v", dns.RcodeToString[d.rcode], d.domain, response)
+		}
+		if result == nil || result.Match != d.expected {
+			t.Errorf("Expected match %d for '%s' but got %v", d.expected, d.domain, result)
+			continue
+		}
+		if "" != d.list && (result.MatchList == nil || result.MatchList.CanonicalName() != d.list) {
+			t.Errorf("Expected match for '%s' in list '%s' but got %v", d.domain, d.list, result.MatchList)
+		}
+	}
+}
+
+func TestCnameCloaking(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/cname.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	data := []struct {
+		domain   string
+		expected rule.Match
+		rule     string
+		rcode    int
+		address  string
+	}{
+		{"metrics.example.com.", rule.MatchBlock, "tracker.example.net (cname tracker.example.net)", dns.RcodeNameError, ""},
+		// the tracker is found at the end of the chain
+		{"shop.example.com.", rule.MatchBlock, "tracker.example.net (cname tracker.example.net)", dns.RcodeNameError, ""},
+		// allowed names are not blocked by where they point
+		{"allowed.example.com.", rule.MatchAllow, "allowed.example.com", dns.RcodeSuccess, "203.0.113.5"},
+		{"www.example.com.", rule.MatchNone, "", dns.RcodeSuccess, "198.51.100.4"},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(d.domain, dns.TypeA)
+		response, _, result := testEngine.HandleWithConsumerName("default", nil, request)
+		if response == nil || response.Rcode != d.rcode {
+			t.Errorf("Expected rcode %s for '%s' but got %v", dns.RcodeToString[d.rcode], d.domain, response)
+		}
+		if result == nil || result.Match != d.expected || result.MatchRule != d.rule {
+			t.Errorf("Expected match %d with rule '%s' for '%s' but got %v", d.expected, d.rule, d.domain, result)
+		}
+		if "" != d.address {
+			found := false
+			if response != nil {
+				for _, answer := range response.Answer {
+					if a, ok := answer.(*dns.A); ok && d.address == a.A.String() {
+						found = true
+					}
+				}
+			}
+			if !found {
+				t.Errorf("Expected address %s in the answer for '%s' but got %v", d.address, d.domain, response)
+			}
+		}
+	}
+}
+
+func TestRebinding(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/rebinding.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	// answers from a local source are exempt
+	request := new(dns.Msg)
+	request.SetQuestion("nas.example.com.", dns.TypeA)
+	response, _, result := testEngine.HandleWithConsumerName("default", nil, request)
+	if response == nil || response.Rcode != dns.RcodeSuccess || len(response.Answer) != 1 || result == nil || result.Rebinding {
+		t.Errorf("Expected local answer for 'nas.example.com' to be exempt but got %v", response)
+	}
+
+	data := []struct {
+		groups   []string
+		domain   string
+		answers  []string
+		rebind   bool
+		rcode    int
+		expected int
+	}{
+		{[]string{"default"}, "public.example.net.", []string{"203.0.113.5"}, false, dns.RcodeSuccess, 1},
+		{[]string{"default"}, "evil.example.net.", []string{"192.168.1.1"}, true, dns.RcodeNameError, 0},
+		{[]string{"default"}, "evil.example.net.", []string{"127.0.0.1", "203.0.113.5"}, true, dns.RcodeNameError, 0},
+		{[]string{"default"}, "evil6.example.net.", []string{"fe80::1"}, true, dns.RcodeNameError, 0},
+		// allowed domains, their subdomains, and single label names may have private addresses
+		{[]string{"default"}, "corp.example.com.", []string{"10.0.0.1"}, false, dns.RcodeSuccess, 1},
+		{[]string{"default"}, "git.corp.example.com.", []string{"10.0.0.1"}, false, dns.RcodeSuccess, 1},
+		{[]string{"default"}, "router.", []string{"192.168.1.1"}, false, dns.RcodeSuccess, 1},
+		// the first group with a setting overrides the network setting
+		{[]string{"strip", "default"}, "evil.example.net.", []string{"10.1.1.1", "203.0.113.5"}, true, dns.RcodeSuccess, 1},
+		{[]string{"off", "default"}, "evil.example.net.", []string{"10.1.1.1"}, false, dns.RcodeSuccess, 1},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(d.domain, dns.TypeA)
+		answer := new(dns.Msg)
+		answer.SetReply(request)
+		for _, address := range d.answers {
+			rrType := "A"
+			if strings.Contains(address, ":") {
+				rrType = "AAAA"
+			}
+			rr, _ := dns.NewRR(fmt.Sprintf("%s 60 IN %s %s", d.domain, rrType, address))
+			answer.Answer = append(answer.Answer, rr)
+		}
+
+		response, rebind := testEngine.(*engine).protectRebinding(d.groups, request, answer)
+		if rebind != d.rebind || response == nil || response.Rcode != d.rcode || len(response.Answer) != d.expected {
+			t.Errorf("Expected rebinding %t with %d answers and rcode %s for %s %v in groups %v but got %t and %v", d.rebind, d.expected, dns.RcodeToString[d.rcode], d.domain, d.answers, d.groups, rebind, response)
+		}
+	}
+}
+
+func TestQueryTypePolicies(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/query_types.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	data := []struct {
+		groups   []string
+		qType    uint16
+		rcode    int
+		answers  int
+		expected rule.Match
+		rule     string
+	}{
+		{[]string{"guest"}, dns.TypeA, dns.RcodeSuccess, 1, rule.MatchNone, ""},
+		{[]string{"guest"}, dns.TypeTXT, dns.RcodeRefused, 0, rule.MatchBlock, "query type TXT (refuse)"},
+		{[]string{"guest"}, dns.TypeAAAA, dns.RcodeSuccess, 0, rule.MatchBlock, "query type AAAA (empty)"},
+		{[]string{"guest"}, dns.TypeANY, dns.RcodeSuccess, 1, rule.MatchBlock, "query type ANY (minimal)"},
+		{[]string{"guest"}, 65, dns.RcodeNameError, 0, rule.MatchBlock, "query type TYPE65 (block)"},
+		// groups without policies are not affected
+		{[]string{"default"}, dns.TypeAAAA, dns.RcodeSuccess, 1, rule.MatchNone, ""},
+		{[]string{"default", "guest"}, dns.TypeTXT, dns.RcodeRefused, 0, rule.MatchBlock, "query type TXT (refuse)"},
+		// an audited group only records the policy and the query is resolved
+		{[]string{"trial"}, dns.TypeAAAA, dns.RcodeSuccess, 1, rule.MatchWouldBlock, "query type AAAA (block)"},
+		{[]string{"trial"}, dns.TypeA, dns.RcodeSuccess, 1, rule.MatchNone, ""},
+		// an enforced policy wins over an audited one from a group listed first
+		{[]string{"trial", "guest"}, dns.TypeAAAA, dns.RcodeSuccess, 0, rule.MatchBlock, "query type AAAA (empty)"},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion("www.example.com.", d.qType)
+		response, _, result := testEngine.HandleWithGroups(d.groups, nil, request)
+		qType := dns.Type(d.qType).String()
+		if response == nil || response.Rcode != d.rcode || len(response.Answer) != d.answers {
+			t.Errorf("Expected rcode %s with %d answers for %s in groups %v but got %v", dns.RcodeToString[d.rcode], d.answers, qType, d.groups, response)
+		}
+		if result == nil || result.Match != d.expected || result.MatchRule != d.rule {
+			t.Errorf("Expected match %d with rule '%s' for %s in groups %v but got %v", d.expected, d.rule, qType, d.groups, result)
+		}
+	}
+
+	// the minimal answer to an any query is a single hinfo record
+	request := new(dns.Msg)
+	request.SetQuestion("www.example.com.", dns.TypeANY)
+	response, _, _ := testEngine.HandleWithGroups([]string{"guest"}, nil, request)
+	if hinfo, ok := response.Answer[0].(*dns.HINFO); !ok || hinfo.Cpu != "RFC8482" {
+		t.Errorf("Expected an RFC 8482 HINFO answer but got %v", response.Answer)
+	}
+
+	// while the group is paused the policy is only recorded and the query is resolved
+	if _, err := testEngine.Pause(PauseGroup, "guest", time.Minute); err != nil {
+		t.Errorf("Could not pause group: %s", err)
+	}
+	request = new(dns.Msg)
+	request.SetQuestion("www.example.com.", dns.TypeTXT)
+	response, _, result := testEngine.HandleWithGroups([]string{"guest"}, nil, request)
+	if response == nil || response.Rcode == dns.RcodeRefused {
+		t.Errorf("Expected TXT query to be resolved while the group is paused but got %v", response)
+	}
+	if result == nil || result.Match != rule.MatchWouldBlock || !result.Paused || result.MatchRule != "query type TXT (refuse)" || result.QueryTypePolicy {
+		t.Errorf("Expected paused query type policy to be recorded as would block but got %v", result)
+	}
+}
+
+func TestSafeSearch(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/safe_search.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	data := []struct {
+		groups  []string
+		domain  string
+		cname   string
+		address string
+	}{
+		{[]string{"school"}, "www.google.com.", "forcesafesearch.google.com.", "216.239.38.120"},
+		{[]string{"school"}, "google.co.uk.", "forcesafesearch.google.com.", "216.239.38.120"},
+		{[]string{"school"}, "m.youtube.com.", "restrict.youtube.com.", "216.239.38.119"},
+		// the file takes precedence over the built in rewrites
+		{[]string{"school"}, "www.bing.com.", "safe.example.com.", "198.51.100.7"},
+		{[]string{"school"}, "search.example.com.", "", "192.0.2.50"},
+		{[]string{"youtube"}, "www.youtube.com.", "restrictmoderate.youtube.com.", "216.239.38.120"},
+		{[]string{"youtube"}, "www.google.com.", "", "142.250.1.1"},
+		{[]string{"default"}, "www.google.com.", "", "142.250.1.1"},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(d.domain, dns.TypeA)
+		response, _, result := testEngine.HandleWithGroups(d.groups, nil, request)
+		if response == nil || response.Rcode != dns.RcodeSuccess {
+			t.Errorf("Expected an answer for '%s' in groups %v but got %v", d.domain, d.groups, response)
+			continue
+		}
+
+		cname, address := "", ""
+		for _, answer := range response.Answer {
+			switch record := answer.(type) {
+			case *dns.CNAME:
+				cname = record.Target
+			case *dns.A:
+				address = record.A.String()
+			}
+		}
+		if cname != d.cname || address != d.address {
+			t.Errorf("Expected cname '%s' and address %s for '%s' in groups %v but got %v", d.cname, d.address, d.domain, d.groups, response.Answer)
+		}
+		if rewritten := d.cname != "" || d.address == "192.0.2.50"; result == nil || result.SafeSearch != rewritten {
+			t.Errorf("Expected safe search %t for '%s' in groups %v but got %v", rewritten, d.domain, d.groups, result)
+		}
+	}
+}
+
+func TestIsGoogleSearch(t *testing.T) {
+	for _, domain := range []string{"google.com", "www.google.com", "google.de", "www.google.co.uk", "google.com.au"} {
+		if !isGoogleSearch(domain) {
+			t.Errorf("Expected '%s' to be google search", domain)
+		}
+	}
+	for _, domain := range []string{"mail.google.com", "google.blogspot.com", "notgoogle.com", "google.example.org"} {
+		if isGoogleSearch(domain) {
+			t.Errorf("Expected '%s' not to be google search", domain)
+		}
+	}
+}
+
+func TestRewrites(t *testing.T) {
+	config := testutil.TestConf(t, "testdata/rewrites.yml")
+	defer os.RemoveAll(config.Home)
+
+	testEngine, err := NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not create a new engine: %s", err)
+		return
+	}
+	defer testEngine.Shutdown()
+
+	data := []struct {
+		groups  []string
+		domain  string
+		qType   uint16
+		answers []string
+		match   rule.Match
+		rule    string
+	}{
+		{[]string{"office"}, "printer.corp.", dns.TypeA, []string{"10.0.3.4"}, rule.MatchRewrite, "printer.corp -> 10.0.3.4 fd00::34"},
+		{[]string{"office"}, "printer.corp.", dns.TypeAAAA, []string{"fd00::34"}, rule.MatchRewrite, "printer.corp -> 10.0.3.4 fd00::34"},
+		{[]string{"office"}, "nas.internal.example.", dns.TypeA, []string{"gateway.internal.", "10.0.0.1"}, rule.MatchRewrite, "*.internal.example -> gateway.internal"},
+		{[]string{"office"}, "exact.internal.example.", dns.TypeA, []string{"10.0.5.5"}, rule.MatchRewrite, "exact.internal.example -> 10.0.5.5"},
+		// the wildcard does not match the parent domain
+		{[]string{"office"}, "internal.example.", dns.TypeA, []string{}, rule.MatchNone, ""},
+		// rules in the group configuration come first and rewrites only apply to their groups
+		{[]string{"lab", "office"}, "printer.corp.", dns.TypeA, []string{"10.9.9.9"}, rule.MatchRewrite, "printer.corp -> 10.9.9.9"},
+		{[]string{"default"}, "printer.corp.", dns.TypeA, []string{}, rule.MatchNone, ""},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion(d.domain, d.qType)
+		response, _, result := testEngine.HandleWithGroups(d.groups, nil, request)
+		if response == nil {
+			t.Errorf("Expected a response for '%s' in groups %v", d.domain, d.groups)
+			continue
+		}
+
+		answers := make([]string, 0)
+		for _, answer := range response.Answer {
+			switch record := answer.(type) {
+			case *dns.CNAME:
+				answers = append(answers, record.Target)
+			case *dns.A:
+				answers = append(answers, record.A.String())
+			case *dns.AAAA:
+				answers = append(answers, record.AAAA.String())
+			}
+		}
+		if strings.Join(answers, " ") != strings.Join(d.answers, " ") {
+			t.Errorf("Expected answers %v for '%s' in groups %v but got %v", d.answers, d.domain, d.groups, answers)
+		}
+		if result == nil || result.Match != d.match || result.MatchRule != d.rule {
+			t.Errorf("Expected match %d with rule '%s' for '%s' in groups %v but got %v", d.match, d.rule, d.domain, d.groups, result)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/rule"
+)
+
+// a rule that matched the domain being explained
+type ExplainMatch struct {
+	List      string   `json:"list"`
+	ShortName string   `json:"short"`
+	Type      string   `json:"type"`
+	Tags      []string `json:"tags"`
+	Rule      string   `json:"rule"`
+	// true when a block match from the list is only audited
+	Audit bool `json:"audit"`
+	// true for the rule that decides the outcome of the query
+	Winner bool `json:"winner"`
+}
+
+// details of every rule that matches a domain for a consumer or group and which rule decides the outcome
+type Explanation struct {
+	Domain   string          `json:"domain"`
+	Consumer string          `json:"consumer"`
+	Groups   []string        `json:"groups"`
+	Lists    []string        `json:"lists"`
+	Matches  []*ExplainMatch `json:"matches"`
+	Match    rule.Match      `json:"match"`
+	Blocked  bool            `json:"blocked"`
+	Reason   string          `json:"reason"`
+}
+
+// explain the rule matches for the domain, the consumer name is used first and then the groups and finally the address
+func (engine *engine) Explain(domain string, consumerName string, groups []string, address *net.IP) (*Explanation, error) {
+	// drop ending . if present from domain
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if "" == domain {
+		return nil, fmt.Errorf("a domain is required")
+	}
+
+	explanation := &Explanation{
+		Domain:  domain,
+		Lists:   make([]string, 0),
+		Matches: make([]*ExplainMatch, 0),
+	}
+
+	var lists []*config.GudgeonList
+	audited := make(map[string]bool)
+	if "" != consumerName || len(groups) < 1 {
+		var consumer *consumer
+		if "" != consumerName {
+			found := false
+			if consumer, found = engine.consumerMap[consumerName]; !found {
+				return nil, fmt.Errorf("no consumer named '%s'", consumerName)
+			}
+		} else if address != nil {
+			consumer = engine.getConsumerForIP(address)
+		} else {
+			consumer = engine.defaultConsumer
+		}
+		if consumer != nil {
+			explanation.Consumer = consumer.configConsumer.Name
+			lists, audited = engine.consumerLists(consumer)
+			if consumer.configConsumer.Block {
+				explanation.Blocked = true
+				explanation.Reason = fmt.Sprintf("all queries from consumer '%s' are refused", consumer.configConsumer.Name)
+			}
+		}
+		explanation.Groups = engine.getGroups(consumer)
+	} else {
+		for _, g := range groups {
+			group, found := engine.groups[g]
+			if !found {
+				return nil, fmt.Errorf("no group named '%s'", g)
+			}
+			lists = append(lists, group.lists...)
+			addAuditedLists(audited, group)
+		}
+		explanation.Groups = groups
+	}
+
+	for _, list := range lists {
+		explanation.Lists = append(explanation.Lists, list.CanonicalName())
+	}
+
+	// rewrite rules answer before the lists are checked
+	if found, rewriteList := engine.rewriteFor(explanation.Groups, domain); found != nil && "" == explanation.Reason {
+		explanation.Match = rule.MatchRewrite
+		if rewriteList != nil {
+			explanation.Reason = fmt.Sprintf("rewritten by rule '%s' in list '%s'", found, rewriteList.CanonicalName())
+		} else {
+			explanation.Reason = fmt.Sprintf("rewritten by rule '%s' in the group configuration", found)
+		}
+		return explanation, nil
+	}
+
+	// sometimes (in testing, downloading) the store mechanism is nil/unloaded
+	if engine.store == nil || len(lists) < 1 {
+		if "" == explanation.Reason {
+			explanation.Reason = "no lists apply"
+		}
+		return explanation, nil
+	}
+
+	// the winner is whatever the engine would use to answer the query
+	var (
+		winningList *config.GudgeonList
+		winningRule string
+	)
+	explanation.Match, winningList, winningRule = engine.domainRuleMatchForLists(lists, audited, domain)
+
+	for _, found := range engine.store.FindAllMatches(lists, domain) {
+		if found.List == nil {
+			continue
+		}
+		explanation.Matches = append(explanation.Matches, &ExplainMatch{
+			List:      found.List.CanonicalName(),
+			ShortName: found.List.ShortName(),
+			Type:      found.List.Type,
+			Tags:      found.List.SafeTags(),
+			Rule:      found.Rule,
+			Audit:     found.Match == rule.MatchBlock && audited[found.List.CanonicalName()],
+			Winner:    winningList != nil && found.List.CanonicalName() == winningList.CanonicalName() && found.Rule == winningRule,
+		})
+	}
+
+	if "" != explanation.Reason {
+		return explanation, nil
+	}
+
+	listName := ""
+	if winningList != nil {
+		listName = winningList.CanonicalName()
+	}
+	switch explanation.Match {
+	case rule.MatchAllow:
+		explanation.Reason = fmt.Sprintf("allowed by rule '%s' in list '%s', allow rules take precedence over block rules", winningRule, listName)
+	case rule.MatchBlock:
+		explanation.Blocked = true
+		explanation.Reason = fmt.Sprintf("blocked by rule '%s' in list '%s', no allow rule matched", winningRule, listName)
+	case rule.MatchWouldBlock:
+		explanation.Reason = fmt.Sprintf("would be blocked by rule '%s' in list '%s' but the list is in audit mode", winningRule, listName)
+	default:
+		explanation.Reason = "no rules match"
+	}
+
+	return explanation, nil
+}
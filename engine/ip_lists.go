@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/rule"
+)
+
+// split assigned lists into the lists that match the question name and the ip lists that match the answer
+func splitIPLists(lists []*config.GudgeonList) ([]*config.GudgeonList, []*config.GudgeonList) {
+	domainLists := make([]*config.GudgeonList, 0, len(lists))
+	ipLists := make([]*config.GudgeonList, 0)
+	for _, list := range lists {
+		if list.IsIP() {
+			ipLists = append(ipLists, list)
+		} else {
+			domainLists = append(domainLists, list)
+		}
+	}
+	return domainLists, ipLists
+}
+
+// load the ip lists from the configuration and reload them when their files change, the counts are set at the
+// same index as the list in the configuration
+func (engine *engine) loadIPLists(conf *config.GudgeonConfig, listCounts []uint64) {
+	engine.ipLists = make(map[string]*rule.IPList)
+
+	for idx, list := range conf.Lists {
+		if !list.IsIP() {
+			continue
+		}
+
+		ipList := rule.NewIPList()
+		count := ipList.Load(conf.PathToList(list))
+		engine.ipLists[list.CanonicalName()] = ipList
+		if idx < len(listCounts) {
+			listCounts[idx] = count
+		}
+
+		// reload the list when its file changes
+		path := conf.PathToList(list)
+		handle := rule.WatchList(conf, list, func() uint64 {
+			return ipList.Load(path)
+		})
+		if handle != nil {
+			engine.handles = append(engine.handles, handle)
+		}
+	}
+}
+
+// the addresses from the a and aaaa records in the answer
+func answerAddresses(response *dns.Msg) []net.IP {
+	addresses := make([]net.IP, 0, len(response.Answer))
+	for _, answer := range response.Answer {
+		switch record := answer.(type) {
+		case *dns.A:
+			addresses = append(addresses, record.A)
+		case *dns.AAAA:
+			addresses = append(addresses, record.AAAA)
+		}
+	}
+	return addresses
+}
+
+// check the addresses in the answer against the ip lists of the groups. an address is blocked when it is on a block
+// list and not on an allow list. a block from an audited list is only returned (as a would block) when no
+// enforced list blocks an address.
+func (engine *engine) responseRuleMatchedForGroups(groups []string, response *dns.Msg) (rule.Match, *config.GudgeonList, string) {
+	if len(groups) < 1 || response == nil || len(response.Answer) < 1 || len(engine.ipLists) < 1 {
+		return rule.MatchNone, nil, ""
+	}
+
+	lists := make([]*config.GudgeonList, 0)
+	audited := make(map[string]bool)
+	for _, g := range groups {
+		if group, found := engine.groups[g]; found {
+			lists = append(lists, group.ipLists...)
+			addAuditedLists(audited, group)
+		}
+	}
+	if len(lists) < 1 {
+		return rule.MatchNone, nil, ""
+	}
+
+	var (
+		wouldBlockList *config.GudgeonList
+		wouldBlockRule string
+	)
+
+	for _, address := range answerAddresses(response) {
+		allowed := false
+		for _, list := range lists {
+			if list.ParsedType() == config.ALLOW && "" != engine.ipLists[list.CanonicalName()].Find(address) {
+				allowed = true
+				break
+			}
+		}
+		if allowed {
+			continue
+		}
+
+		for _, list := range lists {
+			if list.ParsedType() != config.BLOCK {
+				continue
+			}
+			found := engine.ipLists[list.CanonicalName()].Find(address)
+			if "" == found {
+				continue
+			}
+
+			// the rule shows the address from the answer when the rule is a network
+			ruleText := found
+			if found != address.String() {
+				ruleText = found + " (" + address.String() + ")"
+			}
+
+			if !audited[list.CanonicalName()] {
+				return rule.MatchBlock, list, ruleText
+			}
+			if wouldBlockList == nil {
+				wouldBlockList = list
+				wouldBlockRule = ruleText
+			}
+		}
+	}
+
+	if wouldBlockList != nil {
+		return rule.MatchWouldBlock, wouldBlockList, wouldBlockRule
+	}
+	return rule.MatchNone, nil, ""
+}
@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/rule"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+const (
+	listChangeAdd    = "add"
+	listChangeRemove = "remove"
+
+	// the file (in the data directory) where list changes are recorded
+	listChangesFile = "list-changes.log"
+)
+
+// edits to list files (and the change log) are serialized across all engines
+var listEditMutex sync.Mutex
+
+// a record of a change to a list made through the engine
+type ListChange struct {
+	Time    time.Time `json:"time"`
+	List    string    `json:"list"`
+	Domain  string    `json:"domain"`
+	Action  string    `json:"action"`
+	User    string    `json:"user"`
+	Address string    `json:"address"`
+}
+
+// a list can be edited if it is a plain, local file
+func editableList(conf *config.GudgeonConfig, list *config.GudgeonList) bool {
+	if list == nil || list.IsRemote() || list.IsManifest() || list.IsIP() || list.IsRewrite() || (list.Regex != nil && *list.Regex) {
+		return false
+	}
+	return util.CompressionFromName(conf.PathToList(list)) == util.CompressionNone
+}
+
+// normalize and validate a domain so that it can be written to a list as a rule
+func normalizeListDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if "" == domain {
+		return "", fmt.Errorf("a domain is required")
+	}
+	if _, ok := dns.IsDomainName(domain); !ok || strings.ContainsAny(domain, " \t#*/") {
+		return "", fmt.Errorf("'%s' is not a valid domain", domain)
+	}
+	return domain, nil
+}
+
+// add the domain to the named local list, returns false if the domain was already in the list
+func (engine *engine) AddToList(listName string, domain string, user string, address string) (bool, error) {
+	return engine.editList(listName, domain, listChangeAdd, user, address)
+}
+
+// remove the domain from the named local list, returns false if the domain was not in the list
+func (engine *engine) RemoveFromList(listName string, domain string, user string, address string) (bool, error) {
+	return engine.editList(listName, domain, listChangeRemove, user, address)
+}
+
+func (engine *engine) editList(listName string, domain string, action string, user string, address string) (bool, error) {
+	list := engine.config.GetList(strings.ToLower(listName))
+	if list == nil {
+		return false, fmt.Errorf("no list named '%s'", listName)
+	}
+	if !editableList(engine.config, list) {
+		return false, fmt.Errorf("list '%s' is not a local, uncompressed, non-regex list and can't be edited", list.CanonicalName())
+	}
+	domain, err := normalizeListDomain(domain)
+	if err != nil {
+		return false, err
+	}
+
+	listEditMutex.Lock()
+	defer listEditMutex.Unlock()
+
+	listPath := engine.config.PathToList(list)
+	lines, err := readListLines(listPath)
+	if err != nil {
+		return false, err
+	}
+
+	// find the lines that already hold the domain as a rule
+	found := make([]int, 0)
+	for idx, line := range lines {
+		if strings.EqualFold(rule.ParseLine(line), domain) {
+			found = append(found, idx)
+		}
+	}
+
+	if listChangeAdd == action {
+		if len(found) > 0 {
+			return false, nil
+		}
+		lines = append(lines, domain)
+	} else {
+		if len(found) < 1 {
+			return false, nil
+		}
+		kept := make([]string, 0, len(lines))
+		for idx, line := range lines {
+			if len(found) > 0 && found[0] == idx {
+				found = found[1:]
+				continue
+			}
+			kept = append(kept, line)
+		}
+		lines = kept
+	}
+
+	// the file watcher on the list reloads the store after the file is replaced
+	if err := writeListLines(listPath, lines); err != nil {
+		return false, err
+	}
+
+	change := &ListChange{
+		Time:    time.Now(),
+		List:    list.CanonicalName(),
+		Domain:  domain,
+		Action:  action,
+		User:    user,
+		Address: address,
+	}
+	log.Infof("List '%s' changed: %s '%s' (user: '%s', address: '%s')", change.List, change.Action, change.Domain, change.User, change.Address)
+	if err := engine.recordListChange(change); err != nil {
+		log.Errorf("Could not record list change: %s", err)
+	}
+
+	return true, nil
+}
+
+func readListLines(listPath string) ([]string, error) {
+	lines := make([]string, 0)
+	file, err := os.Open(listPath)
+	if os.IsNotExist(err) {
+		return lines, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// write lines to a temporary file next to the list and then move it over the list so the change is atomic
+func writeListLines(listPath string, lines []string) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(listPath); err == nil {
+		mode = info.Mode()
+	}
+
+	tmp, err := ioutil.TempFile(path.Dir(listPath), "."+path.Base(listPath)+".")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	writer := bufio.NewWriter(tmp)
+	for _, line := range lines {
+		_, _ = writer.WriteString(line)
+		_, _ = writer.WriteString("\n")
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, mode)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, listPath)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func (engine *engine) recordListChange(change *ListChange) error {
+	if err := os.MkdirAll(engine.config.DataRoot(), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path.Join(engine.config.DataRoot(), listChangesFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	bytes, err := util.Json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(bytes, '\n'))
+	return err
+}
+
+// the most recent list changes, newest first
+func (engine *engine) ListChanges(limit int) []*ListChange {
+	changes := make([]*ListChange, 0)
+
+	listEditMutex.Lock()
+	lines, err := readListLines(path.Join(engine.config.DataRoot(), listChangesFile))
+	listEditMutex.Unlock()
+	if err != nil {
+		log.Errorf("Could not read list changes: %s", err)
+		return changes
+	}
+
+	for idx := len(lines) - 1; idx >= 0 && (limit < 1 || len(changes) < limit); idx-- {
+		change := &ListChange{}
+		if err := util.Json.Unmarshal([]byte(lines[idx]), change); err != nil {
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	return changes
+}
@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// expand each manifest in the configuration into the lists that it contains, remote manifests are downloaded
+// again each time so that a new engine (on reload) picks up changes to the manifest
+func expandManifests(engine Engine, conf *config.GudgeonConfig) {
+	// collect manifests first because expansion modifies the configured lists
+	manifests := make([]*config.GudgeonList, 0)
+	for _, list := range conf.Lists {
+		if list.IsManifest() {
+			manifests = append(manifests, list)
+		}
+	}
+
+	for _, manifest := range manifests {
+		path := conf.PathToList(manifest)
+
+		if manifest.IsRemote() {
+			if err := Download(engine, conf, manifest); err != nil {
+				// fall back to the copy from the last successful download
+				if _, statErr := os.Stat(path); statErr != nil {
+					log.Errorf("Could not download manifest '%s': %s", manifest.CanonicalName(), err)
+					continue
+				}
+				log.Warnf("Could not download manifest '%s', using cached copy: %s", manifest.CanonicalName(), err)
+			}
+		}
+
+		reader, err := util.OpenDecompressed(path)
+		if err != nil {
+			log.Errorf("Could not open manifest '%s': %s", manifest.CanonicalName(), err)
+			continue
+		}
+		lists, err := config.ParseManifest(reader)
+		_ = reader.Close()
+		if err != nil {
+			log.Errorf("Could not parse manifest '%s': %s", manifest.CanonicalName(), err)
+			continue
+		}
+
+		for _, warn := range conf.ExpandManifest(manifest, lists) {
+			log.Warn(warn)
+		}
+		log.Infof("Manifest '%s' expanded to %d lists", manifest.CanonicalName(), len(lists))
+	}
+}
@@ -38,6 +38,27 @@ const (
 	BlocksPerSecond        = "session-blocks-ps"
 	QueryTime              = "query-time"
 	QueryTimeAvg           = "query-time-avg"
+	// queries that matched a block rule in an audited list or group
+	WouldBlockQueries         = "would-block-session-queries"
+	WouldBlockLifetimeQueries = "would-block-lifetime-queries"
+	// queries that matched a block rule while blocking was paused
+	PausedQueries         = "paused-session-queries"
+	PausedLifetimeQueries = "paused-lifetime-queries"
+	// queries that were refused or dropped because they were over a rate limit
+	RateLimitedQueries         = "rate-limited-session-queries"
+	RateLimitedLifetimeQueries = "rate-limited-lifetime-queries"
+	// queries with private addresses in the answer for a public name
+	RebindingQueries         = "rebinding-session-queries"
+	RebindingLifetimeQueries = "rebinding-lifetime-queries"
+	// queries answered by a query type policy of a group
+	QueryTypeQueries         = "query-type-session-queries"
+	QueryTypeLifetimeQueries = "query-type-lifetime-queries"
+	// queries answered with the safe search endpoint of a search engine
+	SafeSearchQueries         = "safe-search-session-queries"
+	SafeSearchLifetimeQueries = "safe-search-lifetime-queries"
+	// queries answered by a rewrite rule
+	RewriteQueries         = "rewrite-session-queries"
+	RewriteLifetimeQueries = "rewrite-lifetime-queries"
 	// cache entries
 	CurrentCacheEntries = "cache-entries"
 	// runtime metrics
@@ -322,6 +343,53 @@ func (metrics *metrics) record(info *InfoRecord) {
 			metrics.Get("rules-lifetime-matched-" + info.Result.MatchList.ShortName()).Inc(1)
 		}
 	}
+
+	// add queries that would have been blocked but blocking was paused
+	if info.Result != nil && info.Result.Paused {
+		metrics.Get(PausedQueries).Inc(1)
+		metrics.Get(PausedLifetimeQueries).Inc(1)
+	}
+
+	// a rate limited record stands in for all of the queries limited since the last one was recorded
+	if info.Result != nil && info.Result.RateLimited {
+		metrics.Get(RateLimitedQueries).Inc(info.Result.RateLimitedQueries)
+		metrics.Get(RateLimitedLifetimeQueries).Inc(info.Result.RateLimitedQueries)
+	}
+
+	// add queries that had private addresses stripped or were blocked to prevent dns rebinding
+	if info.Result != nil && info.Result.Rebinding {
+		metrics.Get(RebindingQueries).Inc(1)
+		metrics.Get(RebindingLifetimeQueries).Inc(1)
+	}
+
+	// add queries answered by a query type policy
+	if info.Result != nil && info.Result.QueryTypePolicy {
+		metrics.Get(QueryTypeQueries).Inc(1)
+		metrics.Get(QueryTypeLifetimeQueries).Inc(1)
+	}
+
+	// add queries answered with a safe search endpoint
+	if info.Result != nil && info.Result.SafeSearch {
+		metrics.Get(SafeSearchQueries).Inc(1)
+		metrics.Get(SafeSearchLifetimeQueries).Inc(1)
+	}
+
+	// add queries answered by a rewrite rule
+	if info.Result != nil && info.Result.Match == rule.MatchRewrite {
+		metrics.Get(RewriteQueries).Inc(1)
+		metrics.Get(RewriteLifetimeQueries).Inc(1)
+	}
+
+	// add queries that would have been blocked by audited lists
+	if info.Result != nil && info.Result.Match == rule.MatchWouldBlock && !info.Result.Paused {
+		metrics.Get(WouldBlockQueries).Inc(1)
+		metrics.Get(WouldBlockLifetimeQueries).Inc(1)
+
+		if info.Result.MatchList != nil {
+			metrics.Get("rules-session-would-block-" + info.Result.MatchList.ShortName()).Inc(1)
+			metrics.Get("rules-lifetime-would-block-" + info.Result.MatchList.ShortName()).Inc(1)
+		}
+	}
 }
 
 func (metrics *metrics) insert(tx *sql.Tx, currentTime time.Time) {
@@ -0,0 +1,7 @@
+-- add paused (blocking was paused for the query) to buffer
+ALTER TABLE buffer ADD COLUMN Paused BOOLEAN DEFAULT false;
+UPDATE buffer SET Paused = false WHERE Paused = null;
+
+-- add paused to qlog
+ALTER TABLE qlog ADD COLUMN Paused BOOLEAN DEFAULT false;
+UPDATE qlog SET Paused = false WHERE Paused = null;
@@ -0,0 +1,7 @@
+-- add rate limited (the query was over a rate limit and was refused or dropped) to buffer
+ALTER TABLE buffer ADD COLUMN RateLimited BOOLEAN DEFAULT false;
+UPDATE buffer SET RateLimited = false WHERE RateLimited = null;
+
+-- add rate limited to qlog
+ALTER TABLE qlog ADD COLUMN RateLimited BOOLEAN DEFAULT false;
+UPDATE qlog SET RateLimited = false WHERE RateLimited = null;
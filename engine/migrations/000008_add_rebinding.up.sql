@@ -0,0 +1,7 @@
+-- add rebinding (private addresses were stripped from the answer or the answer was blocked) to buffer
+ALTER TABLE buffer ADD COLUMN Rebinding BOOLEAN DEFAULT false;
+UPDATE buffer SET Rebinding = false WHERE Rebinding = null;
+
+-- add rebinding to qlog
+ALTER TABLE qlog ADD COLUMN Rebinding BOOLEAN DEFAULT false;
+UPDATE qlog SET Rebinding = false WHERE Rebinding = null;
@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+const (
+	// pause blocking for all queries
+	PauseGlobal = "global"
+	// pause blocking for a named consumer
+	PauseConsumer = "consumer"
+	// pause blocking for a named group
+	PauseGroup = "group"
+)
+
+// a temporary override that stops block rules from being enforced
+type Pause struct {
+	Scope   string    `json:"scope"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Until   time.Time `json:"until"`
+}
+
+// the active pauses, these are kept when the engine is reloaded
+type pauses struct {
+	mux    sync.RWMutex
+	active map[string]*Pause
+}
+
+func newPauses() *pauses {
+	return &pauses{
+		active: make(map[string]*Pause),
+	}
+}
+
+func pauseKey(scope string, name string) string {
+	return scope + ":" + name
+}
+
+func (pauses *pauses) add(scope string, name string, duration time.Duration) *Pause {
+	now := time.Now()
+	pause := &Pause{
+		Scope:   scope,
+		Name:    name,
+		Created: now,
+		Until:   now.Add(duration),
+	}
+
+	pauses.mux.Lock()
+	pauses.active[pauseKey(scope, name)] = pause
+	pauses.mux.Unlock()
+
+	// remove the pause when it expires unless it has been replaced in the meantime
+	time.AfterFunc(duration, func() {
+		pauses.mux.Lock()
+		defer pauses.mux.Unlock()
+		if current, found := pauses.active[pauseKey(scope, name)]; found && current == pause {
+			delete(pauses.active, pauseKey(scope, name))
+			log.Infof("Blocking pause expired for %s", pause)
+		}
+	})
+
+	return pause
+}
+
+func (pauses *pauses) remove(scope string, name string) bool {
+	pauses.mux.Lock()
+	defer pauses.mux.Unlock()
+	if _, found := pauses.active[pauseKey(scope, name)]; found {
+		delete(pauses.active, pauseKey(scope, name))
+		return true
+	}
+	return false
+}
+
+// the active pauses ordered by when they expire
+func (pauses *pauses) list() []*Pause {
+	now := time.Now()
+	list := make([]*Pause, 0)
+
+	pauses.mux.RLock()
+	for _, pause := range pauses.active {
+		if pause.Until.After(now) {
+			list = append(list, pause)
+		}
+	}
+	pauses.mux.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Until.Before(list[j].Until)
+	})
+	return list
+}
+
+// find an unexpired pause that applies to the consumer or any of the groups
+func (pauses *pauses) find(consumer string, groups []string) *Pause {
+	if pauses == nil {
+		return nil
+	}
+	now := time.Now()
+
+	pauses.mux.RLock()
+	defer pauses.mux.RUnlock()
+	if len(pauses.active) < 1 {
+		return nil
+	}
+	for _, pause := range pauses.active {
+		if !pause.Until.After(now) {
+			continue
+		}
+		if PauseGlobal == pause.Scope || (PauseConsumer == pause.Scope && "" != consumer && pause.Name == consumer) || (PauseGroup == pause.Scope && util.StringIn(pause.Name, groups)) {
+			return pause
+		}
+	}
+	return nil
+}
+
+func (pause *Pause) String() string {
+	if PauseGlobal == pause.Scope {
+		return PauseGlobal
+	}
+	return fmt.Sprintf("%s '%s'", pause.Scope, pause.Name)
+}
+
+// pause blocking for everything, a consumer, or a group for the given duration
+func (engine *engine) Pause(scope string, name string, duration time.Duration) (*Pause, error) {
+	scope = strings.ToLower(scope)
+	if "" == scope {
+		scope = PauseGlobal
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("pause duration must be greater than zero")
+	}
+
+	switch scope {
+	case PauseGlobal:
+		name = ""
+	case PauseConsumer:
+		if _, found := engine.consumerMap[name]; !found {
+			return nil, fmt.Errorf("no consumer named '%s'", name)
+		}
+	case PauseGroup:
+		if _, found := engine.groups[name]; !found {
+			return nil, fmt.Errorf("no group named '%s'", name)
+		}
+	default:
+		return nil, fmt.Errorf("pause scope must be one of '%s', '%s', or '%s'", PauseGlobal, PauseConsumer, PauseGroup)
+	}
+
+	pause := engine.pauses.add(scope, name, duration)
+	log.Infof("Blocking paused for %s until %s", pause, pause.Until.Format(time.RFC3339))
+	return pause, nil
+}
+
+// end a pause before it expires
+func (engine *engine) Resume(scope string, name string) bool {
+	scope = strings.ToLower(scope)
+	if "" == scope || PauseGlobal == scope {
+		scope = PauseGlobal
+		name = ""
+	}
+	if engine.pauses.remove(scope, name) {
+		log.Infof("Blocking resumed for %s", &Pause{Scope: scope, Name: name})
+		return true
+	}
+	return false
+}
+
+// the pauses that are currently active
+func (engine *engine) Pauses() []*Pause {
+	return engine.pauses.list()
+}
@@ -20,7 +20,7 @@ import (
 // lit of valid sort names (lower case for ease of use with util.StringIn)
 var validSorts = []string{"address", "connectiontype", "requestdomain", "requesttype", "blocked", "blockedlist", "blockedrule", "created"}
 
-const bufferFlushStmt = "INSERT INTO qlog (Address, Consumer, ClientName, RequestDomain, RequestType, ResponseText, Rcode, Cached, Blocked, Match, MatchList, MatchRule, ServiceTime, Created, EndTime) SELECT Address, Consumer, ClientName, RequestDomain, RequestType, ResponseText, Rcode, Cached, Blocked, Match, MatchList, MatchRule, ServiceTime, Created, EndTime FROM buffer WHERE true"
+const bufferFlushStmt = "INSERT INTO qlog (Address, Consumer, ClientName, RequestDomain, RequestType, ResponseText, Rcode, Cached, Blocked, Paused, RateLimited, Rebinding, Match, MatchList, MatchRule, ServiceTime, Created, EndTime) SELECT Address, Consumer, ClientName, RequestDomain, RequestType, ResponseText, Rcode, Cached, Blocked, Paused, RateLimited, Rebinding, Match, MatchList, MatchRule, ServiceTime, Created, EndTime FROM buffer WHERE true"
 
 // allows a dependency injection-way of defining a reverse lookup function, takes a string address (should be an IP) and returns a string that contains the domain name result
 type ReverseLookupFunction = func(address string) string
@@ -37,6 +37,9 @@ type QueryLogQuery struct {
 	RequestType    string
 	ResponseText   string
 	Blocked        *bool
+	Paused         *bool
+	RateLimited    *bool
+	Rebinding      *bool
 	Cached         *bool
 	// aspects of the match
 	Match     *rule.Match
@@ -214,6 +217,29 @@ func (qlog *qlog) log(info *InfoRecord) {
 					fields["matchType"] = "ALLOWED"
 				}
 
+				if result.Match == rule.MatchWouldBlock {
+					fields["match"] = result.Match
+					fields["matchType"] = "WOULDBLOCK"
+				}
+
+				if result.Match == rule.MatchRewrite {
+					fields["match"] = result.Match
+					fields["matchType"] = "REWRITE"
+					fields["matchRule"] = result.MatchRule
+				}
+
+				if result.Paused {
+					fields["paused"] = "true"
+				}
+
+				if result.Rebinding {
+					fields["rebinding"] = "true"
+				}
+
+				if result.SafeSearch {
+					fields["safeSearch"] = "true"
+				}
+
 				if result.Cached {
 					fields["resolver"] = result.Resolver
 					fields["cached"] = "true"
@@ -233,7 +259,10 @@ func (qlog *qlog) log(info *InfoRecord) {
 				fields["answer"] = "<< NONE >>"
 			}
 
-			if response == nil {
+			if result != nil && result.RateLimited {
+				fields["rateLimited"] = result.RateLimitedQueries
+				qlog.fileLogger.WithFields(fields).Warn("RATE LIMITED")
+			} else if response == nil {
 				qlog.fileLogger.WithFields(fields).Warn("NIL RESPONSE")
 			} else {
 				qlog.fileLogger.WithFields(fields).Info(info.Rcode)
@@ -244,6 +273,10 @@ func (qlog *qlog) log(info *InfoRecord) {
 			delete(fields, "matchType")
 			delete(fields, "matchList")
 			delete(fields, "matchRule")
+			delete(fields, "paused")
+			delete(fields, "rateLimited")
+			delete(fields, "rebinding")
+			delete(fields, "safeSearch")
 			delete(fields, "resolver")
 			delete(fields, "cached")
 			delete(fields, "source")
@@ -284,7 +317,28 @@ func (qlog *qlog) log(info *InfoRecord) {
 			builder.WriteString(info.RequestType)
 			builder.WriteString("]->")
 
-			if result != nil && response != nil && response.Rcode != dns.RcodeNameError {
+			if result != nil && result.RateLimited {
+				// the count of queries limited since the last one was logged
+				builder.WriteString(fmt.Sprintf("RATE LIMITED (%d)", result.RateLimitedQueries))
+			} else if result != nil && response != nil && response.Rcode != dns.RcodeNameError {
+				// audited block matches are logged but resolution continues
+				if result.Match == rule.MatchWouldBlock {
+					if result.Paused {
+						builder.WriteString("PAUSED ")
+					}
+					builder.WriteString("WOULD BLOCK")
+					if result.MatchList != nil {
+						builder.WriteString("[")
+						builder.WriteString(result.MatchList.CanonicalName())
+						if result.MatchRule != "" {
+							builder.WriteString("|")
+							builder.WriteString(result.MatchRule)
+						}
+						builder.WriteString("]")
+					}
+					builder.WriteString("->")
+				}
+
 				if result.Blocked {
 					builder.WriteString("BLOCKED")
 				} else if result.Match == rule.MatchBlock {
@@ -297,6 +351,11 @@ func (qlog *qlog) log(info *InfoRecord) {
 							builder.WriteString(result.MatchRule)
 						}
 						builder.WriteString("]")
+					} else if result.MatchRule != "" {
+						// query type policies have a rule but no list
+						builder.WriteString("[")
+						builder.WriteString(result.MatchRule)
+						builder.WriteString("]")
 					}
 				} else {
 					if result.Cached {
@@ -315,6 +374,27 @@ func (qlog *qlog) log(info *InfoRecord) {
 
 					builder.WriteString("->")
 
+					// the answer is from a rewrite rule
+					if result.Match == rule.MatchRewrite {
+						builder.WriteString("REWRITE[")
+						if result.MatchList != nil {
+							builder.WriteString(result.MatchList.CanonicalName())
+							builder.WriteString("|")
+						}
+						builder.WriteString(result.MatchRule)
+						builder.WriteString("]->")
+					}
+
+					// the answer is from the safe search endpoint of a search engine
+					if result.SafeSearch {
+						builder.WriteString("SAFE SEARCH->")
+					}
+
+					// private addresses were removed from the answer
+					if result.Rebinding {
+						builder.WriteString("REBINDING STRIPPED->")
+					}
+
 					if len(answerValues) > 0 {
 						if len(answerValues) > 0 {
 							builder.WriteString(answerValues[0])
@@ -337,6 +417,8 @@ func (qlog *qlog) log(info *InfoRecord) {
 						}
 					}
 				}
+			} else if result != nil && result.Rebinding {
+				builder.WriteString("REBINDING BLOCKED")
 			} else if response != nil {
 				builder.WriteString(fmt.Sprintf("RESPONSE[%s]", dns.RcodeToString[response.Rcode]))
 			} else {
@@ -362,7 +444,7 @@ func (qlog *qlog) QueryFunc(query *QueryLogQuery, accumulator QueryAccumulator)
 	}
 
 	// select entries from qlog
-	selectStmt := "SELECT Address, ClientName, Consumer, RequestDomain, RequestType, ResponseText, Rcode, Blocked, Match, MatchList, MatchRule, Cached, ServiceTime, Created, EndTime FROM qlog"
+	selectStmt := "SELECT Address, ClientName, Consumer, RequestDomain, RequestType, ResponseText, Rcode, Blocked, Paused, RateLimited, Rebinding, Match, MatchList, MatchRule, Cached, ServiceTime, Created, EndTime FROM qlog"
 	countStmt := "SELECT COUNT(*) FROM qlog"
 
 	// so we can dynamically build the where clause
@@ -401,6 +483,21 @@ func (qlog *qlog) QueryFunc(query *QueryLogQuery, accumulator QueryAccumulator)
 		whereValues = append(whereValues, query.Blocked)
 	}
 
+	if query.Paused != nil {
+		whereClauses = append(whereClauses, "Paused = ?")
+		whereValues = append(whereValues, query.Paused)
+	}
+
+	if query.RateLimited != nil {
+		whereClauses = append(whereClauses, "RateLimited = ?")
+		whereValues = append(whereValues, query.RateLimited)
+	}
+
+	if query.Rebinding != nil {
+		whereClauses = append(whereClauses, "Rebinding = ?")
+		whereValues = append(whereValues, query.Rebinding)
+	}
+
 	if query.Match != nil {
 		whereClauses = append(whereClauses, "Match = ?")
 		whereValues = append(whereValues, query.Match)
@@ -501,7 +598,7 @@ func (qlog *qlog) QueryFunc(query *QueryLogQuery, accumulator QueryAccumulator)
 	// scan each row and get results
 	info := &InfoRecord{}
 	for rows.Next() {
-		err = rows.Scan(&info.Address, &info.ClientName, &info.Consumer, &info.RequestDomain, &info.RequestType, &info.ResponseText, &info.Rcode, &info.Blocked, &info.Match, &info.MatchList, &info.MatchRule, &info.Cached, &info.ServiceMilliseconds, &info.Created, &info.Finished)
+		err = rows.Scan(&info.Address, &info.ClientName, &info.Consumer, &info.RequestDomain, &info.RequestType, &info.ResponseText, &info.Rcode, &info.Blocked, &info.Paused, &info.RateLimited, &info.Rebinding, &info.Match, &info.MatchList, &info.MatchRule, &info.Cached, &info.ServiceMilliseconds, &info.Created, &info.Finished)
 		if err != nil {
 			log.Errorf("Scanning qlog results: %s", err)
 			continue
@@ -532,6 +629,9 @@ func (qlog *qlog) Query(query *QueryLogQuery) ([]*InfoRecord, uint64) {
 				MatchRule:           info.MatchRule,
 				MatchList:           info.MatchList,
 				Blocked:             info.Blocked,
+				Paused:              info.Paused,
+				RateLimited:         info.RateLimited,
+				Rebinding:           info.Rebinding,
 				RequestContext:      info.RequestContext,
 				Address:             info.Address,
 				Cached:              info.Cached,
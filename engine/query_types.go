@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+// the ttl of the hinfo record in a minimal answer to an ANY query
+const minimalAnyTTL = 3600
+
+// the rule text recorded for a query answered by a query type policy
+func queryTypeRuleText(qType uint16, action string) string {
+	return "query type " + dns.Type(qType).String() + " (" + action + ")"
+}
+
+// the first policy, in group order, that applies to the type of the question and the group that it belongs to. a
+// policy from a group that is enforced wins over one from a group in audit mode so that auditing a group doesn't turn
+// off the policies of the other groups.
+func (engine *engine) queryTypePolicyFor(groups []string, request *dns.Msg) (*config.GudgeonQueryTypePolicy, *group) {
+	if request == nil || len(request.Question) < 1 {
+		return nil, nil
+	}
+	qType := request.Question[0].Qtype
+
+	var (
+		auditedPolicy *config.GudgeonQueryTypePolicy
+		auditedGroup  *group
+	)
+	for _, g := range groups {
+		group, found := engine.groups[g]
+		if !found {
+			continue
+		}
+		for _, policy := range group.configGroup.QueryTypes {
+			if !policy.Matches(qType) {
+				continue
+			}
+			if !group.configGroup.IsAudit() {
+				return policy, group
+			}
+			if auditedPolicy == nil {
+				auditedPolicy, auditedGroup = policy, group
+			}
+			break
+		}
+	}
+	return auditedPolicy, auditedGroup
+}
+
+// the response to a question that a query type policy applies to
+func queryTypeResponse(policy *config.GudgeonQueryTypePolicy, request *dns.Msg) *dns.Msg {
+	response := new(dns.Msg)
+	response.SetReply(request)
+
+	switch policy.Action {
+	case config.QueryTypeRefuse:
+		response.Rcode = dns.RcodeRefused
+	case config.QueryTypeEmpty:
+		response.Rcode = dns.RcodeSuccess
+	case config.QueryTypeMinimal:
+		// rfc 8482 section 4.2: answer with a single synthesized hinfo record
+		question := request.Question[0]
+		response.Answer = []dns.RR{&dns.HINFO{
+			Hdr: dns.RR_Header{Name: question.Name, Rrtype: dns.TypeHINFO, Class: question.Qclass, Ttl: minimalAnyTTL},
+			Cpu: "RFC8482",
+			Os:  "",
+		}}
+	default:
+		response.Rcode = dns.RcodeNameError
+	}
+
+	return response
+}
@@ -0,0 +1,337 @@
+package engine
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+const (
+	// limited queries from a client are recorded at most this often, the record carries the count of limited queries
+	rateLimitReportInterval = time.Second
+	// how often idle client buckets are removed
+	rateLimitPruneInterval = time.Minute
+)
+
+// the first limited query of a bucket that was not reported, kept so that the count of limited queries that is left
+// when a flood stops can still be reported
+type limitedQuery struct {
+	address  *net.IP
+	protocol string
+	consumer *consumer
+	request  *dns.Msg
+}
+
+// a token bucket that refills at the rate of the limit up to the burst size
+type tokenBucket struct {
+	mux    sync.Mutex
+	limit  *config.GudgeonRateLimit
+	tokens float64
+	last   time.Time
+
+	// limited queries since the last report
+	limited      int64
+	lastReported time.Time
+	pending      *limitedQuery
+}
+
+func newTokenBucket(limit *config.GudgeonRateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   now,
+	}
+}
+
+// take a token from the bucket, returns false when the bucket is empty
+func (bucket *tokenBucket) take(now time.Time) bool {
+	bucket.mux.Lock()
+	defer bucket.mux.Unlock()
+
+	bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.limit.Rate
+	if bucket.tokens > float64(bucket.limit.Burst) {
+		bucket.tokens = float64(bucket.limit.Burst)
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		bucket.limited++
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// returns the number of limited queries since the last report when it is time to report them again, otherwise 0
+// and the first query that was not reported is kept so that the count can be reported later
+func (bucket *tokenBucket) report(now time.Time, query func() *limitedQuery) int64 {
+	bucket.mux.Lock()
+	defer bucket.mux.Unlock()
+
+	if now.Sub(bucket.lastReported) < rateLimitReportInterval {
+		if bucket.pending == nil {
+			bucket.pending = query()
+		}
+		return 0
+	}
+	limited := bucket.limited
+	bucket.limited = 0
+	bucket.lastReported = now
+	bucket.pending = nil
+	return limited
+}
+
+// returns the limited queries that were not reported, and the first of them, once it is time to report them again
+func (bucket *tokenBucket) residual(now time.Time) (int64, *limitedQuery) {
+	bucket.mux.Lock()
+	defer bucket.mux.Unlock()
+
+	if bucket.limited < 1 || bucket.pending == nil || now.Sub(bucket.lastReported) < rateLimitReportInterval {
+		return 0, nil
+	}
+	limited, pending := bucket.limited, bucket.pending
+	bucket.limited = 0
+	bucket.lastReported = now
+	bucket.pending = nil
+	return limited, pending
+}
+
+// keep the tokens and unreported queries of the bucket from before a reload, within the (new) limit of this bucket
+func (bucket *tokenBucket) adopt(previous *tokenBucket) {
+	previous.mux.Lock()
+	defer previous.mux.Unlock()
+	bucket.mux.Lock()
+	defer bucket.mux.Unlock()
+
+	bucket.tokens = previous.tokens
+	if bucket.tokens > float64(bucket.limit.Burst) {
+		bucket.tokens = float64(bucket.limit.Burst)
+	}
+	bucket.last = previous.last
+	bucket.limited = previous.limited
+	bucket.lastReported = previous.lastReported
+	bucket.pending = previous.pending
+}
+
+// a bucket is idle when it would have refilled completely
+func (bucket *tokenBucket) idle(now time.Time) bool {
+	bucket.mux.Lock()
+	defer bucket.mux.Unlock()
+	return bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.limit.Rate >= float64(bucket.limit.Burst)
+}
+
+// the rate limits for each consumer and for the clients of each consumer
+type rateLimiter struct {
+	// limit for clients of consumers that have no client limit of their own
+	defaultClientLimit *config.GudgeonRateLimit
+
+	// shared buckets for consumers, by consumer name
+	consumers map[string]*tokenBucket
+
+	// buckets for each client address of a consumer
+	clientMux  sync.Mutex
+	clients    map[string]*tokenBucket
+	lastPruned time.Time
+
+	// reports the limited queries that are left in a bucket after a flood stops
+	reportResidual func(query *limitedQuery, limit *config.GudgeonRateLimit, limited int64)
+	closeChan      chan bool
+	closeOnce      sync.Once
+	maintaining    sync.WaitGroup
+}
+
+func newRateLimiter(conf *config.GudgeonConfig, consumers []*consumer, reportResidual func(query *limitedQuery, limit *config.GudgeonRateLimit, limited int64)) *rateLimiter {
+	limiter := &rateLimiter{
+		consumers:      make(map[string]*tokenBucket),
+		clients:        make(map[string]*tokenBucket),
+		lastPruned:     time.Now(),
+		reportResidual: reportResidual,
+		closeChan:      make(chan bool),
+	}
+	if conf.Network != nil {
+		limiter.defaultClientLimit = conf.Network.ClientRateLimit
+	}
+
+	now := time.Now()
+	limited := limiter.defaultClientLimit != nil
+	for _, consumer := range consumers {
+		if consumer == nil || consumer.configConsumer == nil {
+			continue
+		}
+		if consumer.configConsumer.RateLimit != nil {
+			limiter.consumers[consumer.configConsumer.Name] = newTokenBucket(consumer.configConsumer.RateLimit, now)
+		}
+		limited = limited || consumer.configConsumer.RateLimit != nil || consumer.configConsumer.ClientRateLimit != nil
+	}
+
+	if limited && reportResidual != nil {
+		limiter.maintaining.Add(1)
+		go limiter.maintain()
+	}
+
+	return limiter
+}
+
+// report the limited queries that are left in buckets on the report interval until the limiter is closed
+func (limiter *rateLimiter) maintain() {
+	defer limiter.maintaining.Done()
+	ticker := time.NewTicker(rateLimitReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-limiter.closeChan:
+			return
+		case now := <-ticker.C:
+			limiter.flush(now)
+		}
+	}
+}
+
+// report the limited queries that were not reported, from every bucket where it is time to report them
+func (limiter *rateLimiter) flush(now time.Time) {
+	buckets := make([]*tokenBucket, 0, len(limiter.consumers))
+	for _, bucket := range limiter.consumers {
+		buckets = append(buckets, bucket)
+	}
+	limiter.clientMux.Lock()
+	for _, bucket := range limiter.clients {
+		buckets = append(buckets, bucket)
+	}
+	limiter.clientMux.Unlock()
+
+	for _, bucket := range buckets {
+		if limited, query := bucket.residual(now); limited > 0 {
+			limiter.reportResidual(query, bucket.limit, limited)
+		}
+	}
+}
+
+// keep the buckets of the limiter from before a reload so that a reload doesn't refill them. buckets are only
+// kept for limits that still apply, with the new limits.
+func (limiter *rateLimiter) carry(previous *rateLimiter, consumers []*consumer) {
+	if limiter == nil || previous == nil {
+		return
+	}
+
+	for name, bucket := range limiter.consumers {
+		if old, found := previous.consumers[name]; found {
+			bucket.adopt(old)
+		}
+	}
+
+	byName := make(map[string]*consumer, len(consumers))
+	for _, consumer := range consumers {
+		if consumer != nil && consumer.configConsumer != nil {
+			byName[consumer.configConsumer.Name] = consumer
+		}
+	}
+
+	previous.clientMux.Lock()
+	defer previous.clientMux.Unlock()
+	limiter.clientMux.Lock()
+	defer limiter.clientMux.Unlock()
+	for key, old := range previous.clients {
+		consumer, found := byName[key[:strings.Index(key, "|")]]
+		if !found {
+			continue
+		}
+		limit := consumer.configConsumer.ClientRateLimit
+		if limit == nil {
+			limit = limiter.defaultClientLimit
+		}
+		if limit == nil {
+			continue
+		}
+		bucket := newTokenBucket(limit, old.last)
+		bucket.adopt(old)
+		limiter.clients[key] = bucket
+	}
+}
+
+// stop reporting limited queries, returns once a report that is being made is done
+func (limiter *rateLimiter) close() {
+	if limiter == nil {
+		return
+	}
+	limiter.closeOnce.Do(func() {
+		close(limiter.closeChan)
+	})
+	limiter.maintaining.Wait()
+}
+
+// if any limit applies to the consumer
+func (limiter *rateLimiter) limits(consumer *consumer) bool {
+	if limiter == nil || consumer == nil || consumer.configConsumer == nil {
+		return false
+	}
+	return limiter.defaultClientLimit != nil || consumer.configConsumer.ClientRateLimit != nil || consumer.configConsumer.RateLimit != nil
+}
+
+func (limiter *rateLimiter) clientBucket(consumer *consumer, address string, now time.Time) *tokenBucket {
+	limit := consumer.configConsumer.ClientRateLimit
+	if limit == nil {
+		limit = limiter.defaultClientLimit
+	}
+	if limit == nil {
+		return nil
+	}
+
+	key := consumer.configConsumer.Name + "|" + address
+
+	limiter.clientMux.Lock()
+	defer limiter.clientMux.Unlock()
+
+	// clients that are back to a full bucket don't need to be kept
+	if now.Sub(limiter.lastPruned) > rateLimitPruneInterval {
+		for clientKey, bucket := range limiter.clients {
+			if bucket.idle(now) {
+				delete(limiter.clients, clientKey)
+			}
+		}
+		limiter.lastPruned = now
+	}
+
+	bucket, found := limiter.clients[key]
+	if !found {
+		bucket = newTokenBucket(limit, now)
+		limiter.clients[key] = bucket
+	}
+	return bucket
+}
+
+// check the query against the client and consumer limits. when the query is limited the limit that applied is
+// returned along with the number of limited queries to report, which is 0 when they were reported recently. the
+// count that is not reported is reported later by the limiter.
+func (limiter *rateLimiter) allow(consumer *consumer, address *net.IP, protocol string, request *dns.Msg) (bool, *config.GudgeonRateLimit, int64) {
+	if !limiter.limits(consumer) {
+		return true, nil, 0
+	}
+	now := time.Now()
+
+	clientAddress := ""
+	if address != nil {
+		clientAddress = address.String()
+	}
+
+	bucket := limiter.clientBucket(consumer, clientAddress, now)
+	if bucket == nil || bucket.take(now) {
+		bucket = limiter.consumers[consumer.configConsumer.Name]
+		if bucket == nil || bucket.take(now) {
+			return true, nil, 0
+		}
+	}
+
+	return false, bucket.limit, bucket.report(now, func() *limitedQuery {
+		query := &limitedQuery{protocol: protocol, consumer: consumer, request: request.Copy()}
+		if address != nil {
+			ip := append(net.IP(nil), *address...)
+			query.address = &ip
+		}
+		return query
+	})
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+)
+
+func testLimitedConsumers() []*consumer {
+	return []*consumer{
+		{configConsumer: &config.GudgeonConsumer{
+			Name:            "flood",
+			ClientRateLimit: &config.GudgeonRateLimit{Rate: 0.001, Burst: 1},
+			RateLimit:       &config.GudgeonRateLimit{Rate: 0.001, Burst: 3},
+		}},
+	}
+}
+
+func TestRateLimitResidual(t *testing.T) {
+	consumers := testLimitedConsumers()
+	limiter := newRateLimiter(&config.GudgeonConfig{}, consumers, nil)
+	defer limiter.close()
+
+	reported := int64(0)
+	var reportedQuery *limitedQuery
+	limiter.reportResidual = func(query *limitedQuery, limit *config.GudgeonRateLimit, limited int64) {
+		reported += limited
+		reportedQuery = query
+	}
+
+	request := new(dns.Msg)
+	request.SetQuestion("flood.example.com.", dns.TypeA)
+	address := net.ParseIP("192.168.0.1")
+
+	if allowed, _, _ := limiter.allow(consumers[0], &address, "udp", request); !allowed {
+		t.Errorf("Expected first query to be allowed")
+	}
+	// the first limited query is reported right away, the ones after it are held until the report interval
+	if allowed, _, limited := limiter.allow(consumers[0], &address, "udp", request); allowed || limited != 1 {
+		t.Errorf("Expected first limited query to be reported but got allowed %t with count %d", allowed, limited)
+	}
+	for count := 0; count < 3; count++ {
+		if allowed, _, limited := limiter.allow(consumers[0], &address, "udp", request); allowed || limited != 0 {
+			t.Errorf("Expected limited query to be held but got allowed %t with count %d", allowed, limited)
+		}
+	}
+
+	// the flood stopped, what is left is reported once the interval is over
+	limiter.flush(time.Now())
+	if reported != 0 {
+		t.Errorf("Expected no report before the interval is over but got %d", reported)
+	}
+	limiter.flush(time.Now().Add(2 * rateLimitReportInterval))
+	if reported != 3 || reportedQuery == nil || reportedQuery.request.Question[0].Name != "flood.example.com." || !reportedQuery.address.Equal(address) {
+		t.Errorf("Expected the 3 held queries to be reported with the first of them but got %d (%v)", reported, reportedQuery)
+	}
+	limiter.flush(time.Now().Add(4 * rateLimitReportInterval))
+	if reported != 3 {
+		t.Errorf("Expected held queries to be reported once but got %d", reported)
+	}
+}
+
+func TestRateLimitCarry(t *testing.T) {
+	consumers := testLimitedConsumers()
+	previous := newRateLimiter(&config.GudgeonConfig{}, consumers, nil)
+	defer previous.close()
+
+	request := new(dns.Msg)
+	request.SetQuestion("flood.example.com.", dns.TypeA)
+	address := net.ParseIP("192.168.0.1")
+	other := net.ParseIP("192.168.0.2")
+
+	previous.allow(consumers[0], &address, "udp", request)
+	previous.allow(consumers[0], &other, "udp", request)
+	if allowed, _, _ := previous.allow(consumers[0], &address, "udp", request); allowed {
+		t.Errorf("Expected client to be limited")
+	}
+
+	// a reload doesn't refill the client bucket or the shared consumer bucket
+	reloaded := testLimitedConsumers()
+	limiter := newRateLimiter(&config.GudgeonConfig{}, reloaded, nil)
+	defer limiter.close()
+	limiter.carry(previous, reloaded)
+	if allowed, _, _ := limiter.allow(reloaded[0], &address, "udp", request); allowed {
+		t.Errorf("Expected client to still be limited after reload")
+	}
+	third := net.ParseIP("192.168.0.3")
+	if allowed, _, _ := limiter.allow(reloaded[0], &third, "udp", request); !allowed {
+		t.Errorf("Expected new client to use the last token of the consumer")
+	}
+	fourth := net.ParseIP("192.168.0.4")
+	if allowed, _, _ := limiter.allow(reloaded[0], &fourth, "udp", request); allowed {
+		t.Errorf("Expected consumer to be limited after its tokens were used before and after reload")
+	}
+
+	// a consumer that no longer has a limit doesn't keep its buckets
+	unlimited := []*consumer{{configConsumer: &config.GudgeonConsumer{Name: "flood"}}}
+	limiter = newRateLimiter(&config.GudgeonConfig{}, unlimited, nil)
+	limiter.carry(previous, unlimited)
+	if allowed, _, _ := limiter.allow(unlimited[0], &address, "udp", request); !allowed {
+		t.Errorf("Expected client to be allowed when the consumer is no longer limited")
+	}
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// the rebinding protection for a request uses the first group that has its own setting, otherwise the network setting
+func (engine *engine) rebindingFor(groups []string) *config.GudgeonRebinding {
+	for _, g := range groups {
+		if group, found := engine.groups[g]; found && group.configGroup.Rebinding != nil {
+			return group.configGroup.Rebinding
+		}
+	}
+	if engine.config.Network != nil {
+		return engine.config.Network.Rebinding
+	}
+	return nil
+}
+
+// check the answer for private addresses that a public name should not resolve to. returns the response to use and
+// true when private addresses were found. when the protection strips addresses the response is a copy without the
+// a and aaaa records that have private addresses, otherwise the answer is blocked.
+func (engine *engine) protectRebinding(groups []string, request *dns.Msg, response *dns.Msg) (*dns.Msg, bool) {
+	if response == nil || len(response.Answer) < 1 || request == nil || len(request.Question) < 1 {
+		return response, false
+	}
+
+	rebinding := engine.rebindingFor(groups)
+	if !rebinding.Active() || rebinding.Allows(request.Question[0].Name) {
+		return response, false
+	}
+
+	kept := make([]dns.RR, 0, len(response.Answer))
+	for _, answer := range response.Answer {
+		switch record := answer.(type) {
+		case *dns.A:
+			if util.IsPrivateIP(record.A) {
+				continue
+			}
+		case *dns.AAAA:
+			if util.IsPrivateIP(record.AAAA) {
+				continue
+			}
+		}
+		kept = append(kept, answer)
+	}
+	if len(kept) == len(response.Answer) {
+		return response, false
+	}
+
+	if !rebinding.Strips() {
+		return blockedResponse(request), true
+	}
+
+	stripped := response.Copy()
+	stripped.Answer = kept
+	return stripped, true
+}
@@ -33,7 +33,7 @@ const (
 	_shrinkPragma = "PRAGMA shrink_memory;"
 
 	// single instance of insert statement used for inserting into the "buffer"
-	bufferInsertStatement = "INSERT INTO buffer (Address, ClientName, Consumer, RequestDomain, RequestType, ResponseText, Rcode, Blocked, Match, MatchList, MatchListShort, MatchRule, Cached, ServiceTime, Created, EndTime) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	bufferInsertStatement = "INSERT INTO buffer (Address, ClientName, Consumer, RequestDomain, RequestType, ResponseText, Rcode, Blocked, Paused, RateLimited, Rebinding, Match, MatchList, MatchListShort, MatchRule, Cached, ServiceTime, Created, EndTime) VALUES ( ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 )
 
 // coordinates all recording functions/features
@@ -93,6 +93,15 @@ type InfoRecord struct {
 	// hard consumer blocked
 	Blocked bool
 
+	// blocking was paused when the query was made
+	Paused bool
+
+	// the query was over a rate limit and was refused or dropped
+	RateLimited bool
+
+	// private addresses were stripped from the answer, or the answer was blocked, to prevent dns rebinding
+	Rebinding bool
+
 	// matching
 	Match          rule.Match
 	MatchList      string
@@ -119,6 +128,9 @@ func (record *InfoRecord) clear() {
 	record.ResponseText = ""
 	record.Rcode = ""
 	record.Blocked = false
+	record.Paused = false
+	record.RateLimited = false
+	record.Rebinding = false
 	record.Match = rule.MatchNone
 	record.MatchList = ""
 	record.MatchListShort = ""
@@ -145,7 +157,8 @@ func NewRecorder(conf *config.GudgeonConfig, engine Engine, db *sql.DB, metrics
 		qlog:      qlog,
 		metrics:   metrics,
 		infoQueue: make(chan *InfoRecord, recordQueueSize),
-		doneChan:  make(chan bool, 1),
+		// unbuffered so that shutdown can't receive its own done signal before the worker does
+		doneChan: make(chan bool),
 		recordPool: sync.Pool{
 			New: func() interface{} {
 				return &InfoRecord{}
@@ -305,6 +318,18 @@ func (recorder *recorder) condition(info *InfoRecord) {
 			info.Cached = true
 		}
 
+		if info.Result.Paused {
+			info.Paused = true
+		}
+
+		if info.Result.RateLimited {
+			info.RateLimited = true
+		}
+
+		if info.Result.Rebinding {
+			info.Rebinding = true
+		}
+
 		info.Match = info.Result.Match
 		if info.Result.Match != rule.MatchNone {
 			if info.Result.MatchList != nil {
@@ -513,6 +538,9 @@ func (recorder *recorder) buffer(info *InfoRecord) {
 		info.ResponseText,
 		info.Rcode,
 		info.Blocked,
+		info.Paused,
+		info.RateLimited,
+		info.Rebinding,
 		info.Match,
 		info.MatchList,
 		info.MatchListShort,
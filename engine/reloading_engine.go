@@ -5,6 +5,7 @@ import (
 	"github.com/chrisruffalo/gudgeon/events"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/miekg/dns"
 	log "github.com/sirupsen/logrus"
@@ -15,10 +16,11 @@ import (
 )
 
 type reloadingEngine struct {
-	confPath string
-	current  Engine
-	mux      sync.RWMutex
-	handles  []*events.Handle
+	confPath        string
+	current         Engine
+	mux             sync.RWMutex
+	handles         []*events.Handle
+	manifestHandles []*events.Handle
 }
 
 func NewReloadingEngine(confPath string, conf *config.GudgeonConfig) (Engine, error) {
@@ -30,44 +32,78 @@ func NewReloadingEngine(confPath string, conf *config.GudgeonConfig) (Engine, er
 
 	// create new reloading shell for engine
 	reloading := &reloadingEngine{
-		confPath: confPath,
-		current:  current,
-		handles:  make([]*events.Handle, 0),
+		confPath:        confPath,
+		current:         current,
+		handles:         make([]*events.Handle, 0),
+		manifestHandles: make([]*events.Handle, 0),
 	}
 
 	// establish file watch
 	events.Send("file:watch:start", &events.Message{"path": confPath})
 	// subscribe to topic
 	handle := events.Listen("file:"+confPath, func(message *events.Message) {
-		// clear all file watches
-		events.Send("file:watch:clear", nil)
-
-		// reload configuration
-		conf, warnings, err := config.Load(confPath)
-		if err != nil {
-			log.Errorf("Could not reload engine: %s", err)
-		} else {
-			// print log warnings and continue
-			if len(warnings) > 0 {
-				for _, warn := range warnings {
-					log.Warn(warn)
-				}
-			}
-
-			reloading.swap(conf)
-
-			log.Infof("Configuration updated from: '%s'", confPath)
-		}
-
-		// subscribe for new change events / ensure still subscribed
-		events.Send("file:watch:start", &events.Message{"path": confPath})
+		reloading.reload()
 	})
 	reloading.handles = append(reloading.handles, handle)
 
+	// local manifests also reload the engine when they change so that the lists they expand to are updated
+	reloading.watchManifests(conf)
+
 	// return reloading engine
 	return reloading, nil
 }
 
+// reload the configuration from the configuration path and swap to a new engine built from it
+func (rEngine *reloadingEngine) reload() {
+	// clear all file watches
+	events.Send("file:watch:clear", nil)
+
+	// reload configuration
+	conf, warnings, err := config.Load(rEngine.confPath)
+	if err != nil {
+		log.Errorf("Could not reload engine: %s", err)
+	} else {
+		// print log warnings and continue
+		if len(warnings) > 0 {
+			for _, warn := range warnings {
+				log.Warn(warn)
+			}
+		}
+
+		rEngine.swap(conf)
+		rEngine.watchManifests(conf)
+
+		log.Infof("Configuration updated from: '%s'", rEngine.confPath)
+	}
+
+	// subscribe for new change events / ensure still subscribed
+	events.Send("file:watch:start", &events.Message{"path": rEngine.confPath})
+}
+
+// replace the watches on local manifest files with watches for the manifests in the given configuration
+func (rEngine *reloadingEngine) watchManifests(conf *config.GudgeonConfig) {
+	for _, handle := range rEngine.manifestHandles {
+		if handle != nil {
+			handle.Close()
+		}
+	}
+	rEngine.manifestHandles = make([]*events.Handle, 0)
+
+	for _, list := range conf.Lists {
+		// remote manifests are refreshed every time an engine is built
+		if !list.IsManifest() || list.IsRemote() {
+			continue
+		}
+		manifestPath := conf.PathToList(list)
+		events.Send("file:watch:start", &events.Message{"path": manifestPath})
+		handle := events.Listen("file:"+manifestPath, func(message *events.Message) {
+			log.Infof("Manifest changed: '%s'", manifestPath)
+			rEngine.reload()
+		})
+		rEngine.manifestHandles = append(rEngine.manifestHandles, handle)
+	}
+}
+
 // wait to swap engine until all rlocked processes have completed
 // and then lock during the swap and release to resume normal operations
 func (rEngine *reloadingEngine) swap(config *config.GudgeonConfig) {
@@ -90,6 +126,15 @@ func (rEngine *reloadingEngine) swap(config *config.GudgeonConfig) {
 		return
 	}
 
+	// pauses survive the reload so blocking doesn't resume early and rate limit buckets survive so that they
+	// aren't refilled
+	if oldEngine, ok := rEngine.current.(*engine); ok {
+		if builtEngine, ok := newEngine.(*engine); ok {
+			builtEngine.pauses = oldEngine.pauses
+			builtEngine.limiter.carry(oldEngine.limiter, builtEngine.consumers)
+		}
+	}
+
 	// use new engine after build (if no errors happened)
 	rEngine.current = newEngine
 
@@ -105,6 +150,69 @@ func (engine *reloadingEngine) IsDomainRuleMatched(consumer *net.IP, domain stri
 	return rule.MatchNone, nil, ""
 }
 
+func (engine *reloadingEngine) Explain(domain string, consumerName string, groups []string, address *net.IP) (*Explanation, error) {
+	if engine.current != nil {
+		engine.mux.RLock()
+		defer engine.mux.RUnlock()
+		return engine.current.Explain(domain, consumerName, groups, address)
+	}
+	return nil, fmt.Errorf("No engine currently available")
+}
+
+func (engine *reloadingEngine) AddToList(listName string, domain string, user string, address string) (bool, error) {
+	if engine.current != nil {
+		engine.mux.RLock()
+		defer engine.mux.RUnlock()
+		return engine.current.AddToList(listName, domain, user, address)
+	}
+	return false, fmt.Errorf("No engine currently available")
+}
+
+func (engine *reloadingEngine) RemoveFromList(listName string, domain string, user string, address string) (bool, error) {
+	if engine.current != nil {
+		engine.mux.RLock()
+		defer engine.mux.RUnlock()
+		return engine.current.RemoveFromList(listName, domain, user, address)
+	}
+	return false, fmt.Errorf("No engine currently available")
+}
+
+func (engine *reloadingEngine) ListChanges(limit int) []*ListChange {
+	if engine.current != nil {
+		engine.mux.RLock()
+		defer engine.mux.RUnlock()
+		return engine.current.ListChanges(limit)
+	}
+	return []*ListChange{}
+}
+
+func (engine *reloadingEngine) Pause(scope string, name string, duration time.Duration) (*Pause, error) {
+	if engine.current != nil {
+		engine.mux.RLock()
+		defer engine.mux.RUnlock()
+		return engine.current.Pause(scope, name, duration)
+	}
+	return nil, fmt.Errorf("No engine currently available")
+}
+
+func (engine *reloadingEngine) Resume(scope string, name string) bool {
+	if engine.current != nil {
+		engine.mux.RLock()
+		defer engine.mux.RUnlock()
+		return engine.current.Resume(scope, name)
+	}
+	return false
+}
+
+func (engine *reloadingEngine) Pauses() []*Pause {
+	if engine.current != nil {
+		engine.mux.RLock()
+		defer engine.mux.RUnlock()
+		return engine.current.Pauses()
+	}
+	return []*Pause{}
+}
+
 func (engine *reloadingEngine) Resolve(domainName string) (string, error) {
 	if engine.current != nil {
 		engine.mux.RLock()
@@ -132,6 +240,42 @@ func (engine *reloadingEngine) Handle(address *net.IP, protocol string, request
 	return nil, nil, nil
 }
 
+func (engine *reloadingEngine) Transfer(writer dns.ResponseWriter, request *dns.Msg) {
+	if engine.current != nil {
+		engine.mux.RLock()
+		defer engine.mux.RUnlock()
+		engine.current.Transfer(writer, request)
+		return
+	}
+	response := new(dns.Msg)
+	response.SetRcode(request, dns.RcodeServerFailure)
+	_ = writer.WriteMsg(response)
+}
+
+func (engine *reloadingEngine) Notify(writer dns.ResponseWriter, request *dns.Msg) {
+	if engine.current != nil {
+		engine.mux.RLock()
+		defer engine.mux.RUnlock()
+		engine.current.Notify(writer, request)
+		return
+	}
+	response := new(dns.Msg)
+	response.SetRcode(request, dns.RcodeServerFailure)
+	_ = writer.WriteMsg(response)
+}
+
+func (engine *reloadingEngine) Update(writer dns.ResponseWriter, request *dns.Msg) {
+	if engine.current != nil {
+		engine.mux.RLock()
+		defer engine.mux.RUnlock()
+		engine.current.Update(writer, request)
+		return
+	}
+	response := new(dns.Msg)
+	response.SetRcode(request, dns.RcodeServerFailure)
+	_ = writer.WriteMsg(response)
+}
+
 func (engine *reloadingEngine) HandleWithConsumerName(consumerName string, rCon *resolver.RequestContext, request *dns.Msg) (*dns.Msg, *resolver.RequestContext, *resolver.ResolutionResult) {
 	if engine.current != nil {
 		engine.mux.RLock()
@@ -210,7 +354,7 @@ func (engine *reloadingEngine) Shutdown() {
 		engine.mux.RUnlock()
 	}
 	// since we are shutting down, close up handles
-	for _, handle := range engine.handles {
+	for _, handle := range append(engine.handles, engine.manifestHandles...) {
 		if handle != nil {
 			handle.Close()
 		}
@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/resolver"
+	"github.com/chrisruffalo/gudgeon/rule"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// the ttl of records in a rewritten answer that are not from a resolver
+const rewriteTTL = 300
+
+// a rule that answers a domain (or the subdomains of a wildcard) with a name or with addresses
+type rewrite struct {
+	pattern string
+	targets []string
+}
+
+// the text recorded for a match on the rule
+func (rewrite *rewrite) String() string {
+	return rewrite.pattern + " -> " + strings.Join(rewrite.targets, " ")
+}
+
+// rewrite rules by exact domain and by the parent domain of a wildcard
+type rewrites struct {
+	mux      sync.RWMutex
+	exact    map[string]*rewrite
+	wildcard map[string]*rewrite
+	count    uint64
+}
+
+func newRewrites() *rewrites {
+	return &rewrites{
+		exact:    make(map[string]*rewrite),
+		wildcard: make(map[string]*rewrite),
+	}
+}
+
+func (rewrites *rewrites) add(line string) error {
+	pattern, targets, err := util.ParseRewrite(line)
+	if err != nil || "" == pattern {
+		return err
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		rewrites.wildcard[strings.TrimPrefix(pattern, "*.")] = &rewrite{pattern: pattern, targets: targets}
+	} else {
+		rewrites.exact[pattern] = &rewrite{pattern: pattern, targets: targets}
+	}
+	rewrites.count++
+	return nil
+}
+
+// replace the rules with the rules in the file at the given path and return the number of rules loaded
+func (rewrites *rewrites) Load(path string) uint64 {
+	data, err := util.OpenDecompressed(path)
+	if err != nil {
+		log.Errorf("Could not open rewrite file: %s", err)
+		return 0
+	}
+	defer data.Close()
+
+	rewrites.mux.Lock()
+	defer rewrites.mux.Unlock()
+
+	rewrites.exact = make(map[string]*rewrite)
+	rewrites.wildcard = make(map[string]*rewrite)
+	rewrites.count = 0
+
+	scanner := bufio.NewScanner(data)
+	for scanner.Scan() {
+		if err := rewrites.add(scanner.Text()); err != nil {
+			log.Debugf("Skipping '%s' in rewrite list '%s': %s", scanner.Text(), path, err)
+		}
+	}
+
+	return rewrites.count
+}
+
+// the rule for the domain, an exact rule is preferred over the wildcard of the closest parent domain
+func (rewrites *rewrites) find(domain string) *rewrite {
+	if rewrites == nil {
+		return nil
+	}
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	rewrites.mux.RLock()
+	defer rewrites.mux.RUnlock()
+
+	if found, ok := rewrites.exact[domain]; ok {
+		return found
+	}
+	for _, parent := range util.DomainList(domain)[1:] {
+		if found, ok := rewrites.wildcard[parent]; ok {
+			return found
+		}
+	}
+	return nil
+}
+
+// split the lists of a group into the lists of rules and the rewrite lists
+func splitRewriteLists(lists []*config.GudgeonList) ([]*config.GudgeonList, []*config.GudgeonList) {
+	ruleLists := make([]*config.GudgeonList, 0, len(lists))
+	rewriteLists := make([]*config.GudgeonList, 0)
+	for _, list := range lists {
+		if list.IsRewrite() {
+			rewriteLists = append(rewriteLists, list)
+		} else {
+			ruleLists = append(ruleLists, list)
+		}
+	}
+	return ruleLists, rewriteLists
+}
+
+// load the rewrite lists from the configuration and reload them when their files change, the counts are set at
+// the same index as the list in the configuration
+func (engine *engine) loadRewriteLists(conf *config.GudgeonConfig, listCounts []uint64) {
+	engine.rewriteLists = make(map[string]*rewrites)
+
+	for idx, list := range conf.Lists {
+		if !list.IsRewrite() {
+			continue
+		}
+
+		rewriteList := newRewrites()
+		count := rewriteList.Load(conf.PathToList(list))
+		engine.rewriteLists[list.CanonicalName()] = rewriteList
+		if idx < len(listCounts) {
+			listCounts[idx] = count
+		}
+
+		// reload the list when its file changes
+		path := conf.PathToList(list)
+		handle := rule.WatchList(conf, list, func() uint64 {
+			return rewriteList.Load(path)
+		})
+		if handle != nil {
+			engine.handles = append(engine.handles, handle)
+		}
+	}
+}
+
+// the rules written into the configuration of a group, nil if the group has none
+func groupRewrites(configGroup *config.GudgeonGroup) *rewrites {
+	if len(configGroup.Rewrites) < 1 {
+		return nil
+	}
+	rewrites := newRewrites()
+	for _, line := range configGroup.Rewrites {
+		// the rules were checked when the configuration was loaded
+		_ = rewrites.add(line)
+	}
+	return rewrites
+}
+
+// the first rule for the domain from the groups in order. the rules in the configuration of a group come before
+// the rules in its lists. the list is nil for a rule from the configuration.
+func (engine *engine) rewriteFor(groups []string, domain string) (*rewrite, *config.GudgeonList) {
+	for _, g := range groups {
+		group, found := engine.groups[g]
+		if !found {
+			continue
+		}
+		if found := group.rewrites.find(domain); found != nil {
+			return found, nil
+		}
+		for _, list := range group.rewriteLists {
+			if found := engine.rewriteLists[list.CanonicalName()].find(domain); found != nil {
+				return found, list
+			}
+		}
+	}
+	return nil, nil
+}
+
+// answer the question with the targets. addresses of the type in the question are answered directly. a name is
+// answered with a cname to the name followed by the answer for the name from the resolvers.
+func (engine *engine) rewriteResponse(resolverNames []string, rCon *resolver.RequestContext, request *dns.Msg, targets []string) (*dns.Msg, *resolver.ResolutionResult) {
+	question := request.Question[0]
+	response := new(dns.Msg)
+	response.SetReply(request)
+
+	if len(targets) > 1 || net.ParseIP(targets[0]) != nil {
+		for _, target := range targets {
+			address := net.ParseIP(target)
+			header := dns.RR_Header{Name: question.Name, Class: question.Qclass, Ttl: rewriteTTL}
+			if ip4 := address.To4(); ip4 != nil && dns.TypeA == question.Qtype {
+				header.Rrtype = dns.TypeA
+				response.Answer = append(response.Answer, &dns.A{Hdr: header, A: ip4})
+			} else if ip4 == nil && dns.TypeAAAA == question.Qtype {
+				header.Rrtype = dns.TypeAAAA
+				response.Answer = append(response.Answer, &dns.AAAA{Hdr: header, AAAA: address})
+			}
+		}
+		return response, &resolver.ResolutionResult{}
+	}
+
+	response.Answer = append(response.Answer, &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: question.Name, Rrtype: dns.TypeCNAME, Class: question.Qclass, Ttl: rewriteTTL},
+		Target: dns.Fqdn(targets[0]),
+	})
+	if dns.TypeCNAME == question.Qtype {
+		return response, &resolver.ResolutionResult{}
+	}
+
+	targetRequest := request.Copy()
+	targetRequest.Question[0].Name = dns.Fqdn(targets[0])
+	targetResponse, _, result := engine.HandleWithResolvers(resolverNames, rCon, targetRequest)
+	if targetResponse != nil {
+		response.Answer = append(response.Answer, targetResponse.Answer...)
+		response.Rcode = targetResponse.Rcode
+	}
+	if result == nil {
+		result = &resolver.ResolutionResult{}
+	}
+
+	return response, result
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"bufio"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/events"
+	"github.com/chrisruffalo/gudgeon/resolver"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// the safe search endpoints of the search engines
+const (
+	googleSafeSearch     = "forcesafesearch.google.com"
+	bingSafeSearch       = "strict.bing.com"
+	duckDuckGoSafeSearch = "safe.duckduckgo.com"
+	youTubeStrict        = "restrict.youtube.com"
+	youTubeModerate      = "restrictmoderate.youtube.com"
+)
+
+// the names that are answered with the safe search endpoint of each engine, google is matched by isGoogleSearch
+// because it has a name in nearly every country code
+var safeSearchNames = map[string][]string{
+	config.SafeSearchBing:       {"bing.com", "www.bing.com"},
+	config.SafeSearchDuckDuckGo: {"duckduckgo.com", "www.duckduckgo.com", "start.duckduckgo.com", "html.duckduckgo.com"},
+	config.SafeSearchYouTube:    {"youtube.com", "www.youtube.com", "m.youtube.com", "youtubei.googleapis.com", "youtube.googleapis.com", "www.youtube-nocookie.com"},
+}
+
+// google search is google.com or google under a country code, like google.de, google.co.uk, or google.com.au, with
+// or without www
+func isGoogleSearch(domain string) bool {
+	domain = strings.TrimPrefix(domain, "www.")
+	if !strings.HasPrefix(domain, "google.") {
+		return false
+	}
+	labels := strings.Split(strings.TrimPrefix(domain, "google."), ".")
+	switch len(labels) {
+	case 1:
+		return "com" == labels[0] || len(labels[0]) == 2
+	case 2:
+		return ("com" == labels[0] || "co" == labels[0]) && len(labels[1]) == 2
+	}
+	return false
+}
+
+// the safe search rewrites for a group
+type safeSearch struct {
+	mux sync.RWMutex
+	// rewrites for the built in engines
+	builtIn map[string]string
+	google  bool
+	// rewrites from the file, these take precedence over the built in rewrites
+	mapped map[string]string
+}
+
+func newSafeSearch(conf *config.GudgeonSafeSearch) *safeSearch {
+	safeSearch := &safeSearch{
+		builtIn: make(map[string]string),
+		mapped:  make(map[string]string),
+	}
+	for _, engine := range conf.Engines {
+		target := ""
+		switch engine {
+		case config.SafeSearchGoogle:
+			safeSearch.google = true
+			continue
+		case config.SafeSearchBing:
+			target = bingSafeSearch
+		case config.SafeSearchDuckDuckGo:
+			target = duckDuckGoSafeSearch
+		case config.SafeSearchYouTube:
+			target = youTubeStrict
+			if config.YouTubeModerate == conf.YouTube {
+				target = youTubeModerate
+			}
+		}
+		for _, name := range safeSearchNames[engine] {
+			safeSearch.builtIn[name] = target
+		}
+	}
+	return safeSearch
+}
+
+// replace the rewrites from the file with the rewrites in the file at the given path. each line is a domain
+// followed by the name or address that it is answered with.
+func (safeSearch *safeSearch) load(path string) {
+	mapped := make(map[string]string)
+
+	data, err := util.OpenDecompressed(path)
+	if err != nil {
+		log.Errorf("Could not open safe search file: %s", err)
+	} else {
+		defer data.Close()
+		scanner := bufio.NewScanner(data)
+		for scanner.Scan() {
+			fields := strings.Fields(util.TrimComments(scanner.Text()))
+			if len(fields) < 1 {
+				continue
+			}
+			if len(fields) < 2 {
+				log.Warnf("Skipping '%s' in safe search file '%s', it has no target", fields[0], path)
+				continue
+			}
+			mapped[strings.ToLower(strings.TrimSuffix(fields[0], "."))] = strings.ToLower(fields[1])
+		}
+	}
+
+	safeSearch.mux.Lock()
+	safeSearch.mapped = mapped
+	safeSearch.mux.Unlock()
+}
+
+// the name or address that the domain is answered with or "" if the domain is not rewritten
+func (safeSearch *safeSearch) target(domain string) string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	safeSearch.mux.RLock()
+	target, found := safeSearch.mapped[domain]
+	safeSearch.mux.RUnlock()
+	if found {
+		return target
+	}
+	if target, found := safeSearch.builtIn[domain]; found {
+		return target
+	}
+	if safeSearch.google && isGoogleSearch(domain) {
+		return googleSafeSearch
+	}
+	return ""
+}
+
+// create the safe search rewrites for each group with safe search and reload the file of a group when it changes
+func (engine *engine) loadSafeSearch(groups []*group) {
+	for _, g := range groups {
+		if !g.configGroup.SafeSearch.Active() {
+			continue
+		}
+		g.safeSearch = newSafeSearch(g.configGroup.SafeSearch)
+
+		path := g.configGroup.SafeSearch.File
+		if "" == path {
+			continue
+		}
+		g.safeSearch.load(path)
+
+		// locally scoped variable for file watching
+		watched := g.safeSearch
+		handle := events.WatchFile(path, func() {
+			watched.load(path)
+		})
+		if handle != nil {
+			engine.handles = append(engine.handles, handle)
+		}
+	}
+}
+
+// the safe search target for the domain from the first group with safe search
+func (engine *engine) safeSearchTarget(groups []string, domain string) string {
+	for _, g := range groups {
+		if group, found := engine.groups[g]; found && group.safeSearch != nil {
+			return group.safeSearch.target(domain)
+		}
+	}
+	return ""
+}
+
+// answer the question with the safe search target
+func (engine *engine) safeSearchResponse(resolverNames []string, rCon *resolver.RequestContext, request *dns.Msg, target string) (*dns.Msg, *resolver.ResolutionResult) {
+	response, result := engine.rewriteResponse(resolverNames, rCon, request, []string{target})
+	result.SafeSearch = true
+	return response, result
+}
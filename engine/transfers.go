@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/events"
+	"github.com/chrisruffalo/gudgeon/resolver"
+)
+
+const (
+	// records in each message of a zone transfer
+	transferChunkSize = 100
+	// attempts to deliver a notify to each secondary
+	notifyAttempts = 3
+	notifyTimeout  = 2 * time.Second
+)
+
+// if the request is a zone transfer (AXFR or IXFR)
+func IsTransfer(request *dns.Msg) bool {
+	if request == nil || len(request.Question) < 1 {
+		return false
+	}
+	qType := request.Question[0].Qtype
+	return qType == dns.TypeAXFR || qType == dns.TypeIXFR
+}
+
+// if the request is a notify (rfc 1996) from a primary server that a zone changed
+func IsNotify(request *dns.Msg) bool {
+	return request != nil && request.Opcode == dns.OpcodeNotify && len(request.Question) > 0
+}
+
+// if the secondary is allowed to transfer the zone, it must be in the allowed addresses (when there are any)
+// and sign the request with the key of the transfer (when there is one)
+func transferAllowed(transfer *config.GudgeonTransfer, address net.IP, request *dns.Msg, tsigStatus error) bool {
+	return transfer != nil && transfer.Allows(address) && signedWith(transfer.Key, request, tsigStatus)
+}
+
+// if the request has a valid signature from the named key, always true when there is no key
+func signedWith(key string, request *dns.Msg, tsigStatus error) bool {
+	if "" == key {
+		return true
+	}
+	tsig := request.IsTsig()
+	return tsig != nil && tsigStatus == nil && strings.EqualFold(tsig.Hdr.Name, dns.Fqdn(key))
+}
+
+// answer a zone transfer for a zone loaded from a zone file. transfers are only answered over tcp, an IXFR over
+// udp is answered with only the current soa so that the secondary retries over tcp when it is out of date.
+func (engine *engine) Transfer(writer dns.ResponseWriter, request *dns.Msg) {
+	var address net.IP
+	udp := false
+	switch remote := writer.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		address, udp = remote.IP, true
+	case *net.TCPAddr:
+		address = remote.IP
+	}
+
+	refuse := func(rcode int) {
+		response := new(dns.Msg)
+		response.SetRcode(request, rcode)
+		if err := writer.WriteMsg(response); err != nil {
+			log.Errorf("Writing transfer response: %s", err)
+		}
+	}
+
+	question := request.Question[0]
+	zone := strings.ToLower(question.Name)
+	qType := dns.Type(question.Qtype).String()
+
+	if !transferAllowed(engine.config.GetTransfer(zone), address, request, writer.TsigStatus()) {
+		log.Infof("Refused %s of '%s' to %s", qType, zone, address)
+		refuse(dns.RcodeRefused)
+		return
+	}
+
+	records, found := resolver.ZoneTransfer(request)
+	if !found {
+		log.Infof("Refused %s of '%s' to %s, no zone file has the zone", qType, zone, address)
+		refuse(dns.RcodeNotAuth)
+		return
+	}
+
+	if udp {
+		if question.Qtype == dns.TypeAXFR {
+			refuse(dns.RcodeNotImplemented)
+			return
+		}
+		response := new(dns.Msg)
+		response.SetReply(request)
+		response.Authoritative = true
+		response.Answer = records[:1]
+		if tsig := request.IsTsig(); tsig != nil && writer.TsigStatus() == nil {
+			response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+		}
+		if err := writer.WriteMsg(response); err != nil {
+			log.Errorf("Writing transfer response: %s", err)
+		}
+		return
+	}
+
+	// send the records in chunks, each chunk is a message (signed if the request was signed)
+	envelopes := make(chan *dns.Envelope)
+	go func() {
+		for start := 0; start < len(records); start += transferChunkSize {
+			end := start + transferChunkSize
+			if end > len(records) {
+				end = len(records)
+			}
+			envelopes <- &dns.Envelope{RR: records[start:end]}
+		}
+		close(envelopes)
+	}()
+	if err := new(dns.Transfer).Out(writer, request, envelopes); err != nil {
+		log.Errorf("Sending %s of '%s' to %s: %s", qType, zone, address, err)
+		// drain the remaining chunks so that the sender is not stuck
+		for range envelopes {
+		}
+		return
+	}
+	log.Infof("Sent %s of '%s' to %s (%d records)", qType, zone, address, len(records))
+}
+
+// accept a notify from the primary server of a secondary source so that the zone is transferred again
+func (engine *engine) Notify(writer dns.ResponseWriter, request *dns.Msg) {
+	var address net.IP
+	switch remote := writer.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		address = remote.IP
+	case *net.TCPAddr:
+		address = remote.IP
+	}
+
+	// the name of the key the notify was signed with, only when the signature is valid
+	key := ""
+	tsig := request.IsTsig()
+	if tsig != nil && writer.TsigStatus() == nil {
+		key = tsig.Hdr.Name
+	}
+
+	zone := strings.ToLower(request.Question[0].Name)
+	response := new(dns.Msg)
+	response.SetReply(request)
+	if resolver.NotifyZone(zone, address, key) {
+		response.Authoritative = true
+		log.Infof("Notify from %s that '%s' changed", address, zone)
+	} else {
+		response.Rcode = dns.RcodeRefused
+		log.Infof("Refused notify from %s for '%s'", address, zone)
+	}
+	if "" != key {
+		response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+	}
+	if err := writer.WriteMsg(response); err != nil {
+		log.Errorf("Writing notify response: %s", err)
+	}
+}
+
+// send a notify to the secondary servers of zones that change
+func (engine *engine) watchZoneChanges() {
+	handle := events.Listen("zone:change", func(message *events.Message) {
+		if message == nil {
+			return
+		}
+		zone, _ := (*message)["zone"].(string)
+		if transfer := engine.config.GetTransfer(zone); transfer != nil {
+			for _, target := range transfer.NotifyTargets() {
+				go engine.notify(transfer, target)
+			}
+		}
+	})
+	engine.handles = append(engine.handles, handle)
+}
+
+// send a notify (rfc 1996) for the zone to the secondary at the target address
+func (engine *engine) notify(transfer *config.GudgeonTransfer, target string) {
+	request := new(dns.Msg)
+	request.SetNotify(transfer.Zone)
+	if soa := resolver.ZoneSOA(transfer.Zone); soa != nil {
+		request.Answer = []dns.RR{soa}
+	}
+
+	client := &dns.Client{Net: "udp", Timeout: notifyTimeout}
+	if key := engine.config.GetTsigKey(transfer.Key); key != nil {
+		client.TsigSecret = engine.config.TsigSecrets()
+		request.SetTsig(key.Fqdn(), key.AlgorithmName(), 300, time.Now().Unix())
+	}
+
+	var err error
+	for attempt := 0; attempt < notifyAttempts; attempt++ {
+		var response *dns.Msg
+		if response, _, err = client.Exchange(request, target); err == nil {
+			if response.Rcode != dns.RcodeSuccess {
+				log.Warnf("Secondary %s answered notify for '%s' with %s", target, transfer.Zone, dns.RcodeToString[response.Rcode])
+			} else {
+				log.Infof("Notified %s that '%s' changed", target, transfer.Zone)
+			}
+			return
+		}
+	}
+	log.Errorf("Could not notify %s that '%s' changed: %s", target, transfer.Zone, err)
+}
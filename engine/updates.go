@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/resolver"
+)
+
+// if the request is a dynamic update (rfc 2136)
+func IsUpdate(request *dns.Msg) bool {
+	return request != nil && request.Opcode == dns.OpcodeUpdate
+}
+
+// apply a dynamic update to a zone loaded from a zone file. the client must be allowed to update the zone by the
+// addresses and the key that the zone is configured with.
+func (engine *engine) Update(writer dns.ResponseWriter, request *dns.Msg) {
+	var address net.IP
+	switch remote := writer.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		address = remote.IP
+	case *net.TCPAddr:
+		address = remote.IP
+	}
+
+	response := new(dns.Msg)
+	response.SetReply(request)
+
+	if len(request.Question) != 1 {
+		response.Rcode = dns.RcodeFormatError
+	} else {
+		zone := strings.ToLower(dns.Fqdn(request.Question[0].Name))
+		update := engine.config.GetUpdate(zone)
+		if update == nil || !update.Allows(address) || !signedWith(update.Key, request, writer.TsigStatus()) {
+			log.Infof("Refused update of '%s' from %s", zone, address)
+			response.Rcode = dns.RcodeRefused
+		} else {
+			response.Rcode = resolver.UpdateZone(request, address.String())
+			if response.Rcode != dns.RcodeSuccess {
+				log.Infof("Update of '%s' from %s was not applied: %s", zone, address, dns.RcodeToString[response.Rcode])
+			}
+		}
+	}
+
+	if tsig := request.IsTsig(); tsig != nil && writer.TsigStatus() == nil {
+		response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+	}
+	if err := writer.WriteMsg(response); err != nil {
+		log.Errorf("Writing update response: %s", err)
+	}
+}
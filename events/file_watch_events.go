@@ -133,6 +133,16 @@ func StartFileWatch() {
 	})
 }
 
+// watch the file at the path and reload it each time it changes. the file is watched again after each reload
+// because a changed file can be a new file at the same path.
+func WatchFile(path string, reload func()) *Handle {
+	Send("file:watch:start", &Message{"path": path})
+	return Listen("file:"+path, func(message *Message) {
+		reload()
+		Send("file:watch:start", &Message{"path": path})
+	})
+}
+
 func StopFileWatch() {
 	Send("file:watch:close", &Message{})
 }
@@ -20,6 +20,8 @@ import (
 type provider struct {
 	engine  engine.Engine
 	servers []*dns.Server
+	// secrets of the tsig keys that requests can be signed with
+	tsigSecrets map[string]string
 }
 
 type Provider interface {
@@ -38,13 +40,28 @@ func NewProvider(engine engine.Engine) Provider {
 
 func defaultServer() *dns.Server {
 	return &dns.Server{
-		ReadTimeout:  3 * time.Second,
-		WriteTimeout: 3 * time.Second,
+		ReadTimeout:   3 * time.Second,
+		WriteTimeout:  3 * time.Second,
+		MsgAcceptFunc: acceptMessage,
 	}
 }
 
+// the default accept function rejects dynamic updates because their sections can have many records, they are
+// accepted here and the engine decides if they are allowed
+func acceptMessage(header dns.Header) dns.MsgAcceptAction {
+	isResponse := header.Bits&(1<<15) != 0
+	if opcode := int(header.Bits>>11) & 0xF; !isResponse && opcode == dns.OpcodeUpdate {
+		if header.Qdcount != 1 {
+			return dns.MsgReject
+		}
+		return dns.MsgAccept
+	}
+	return dns.DefaultMsgAcceptFunc(header)
+}
+
 func (provider *provider) serve(netType string, addr string) *dns.Server {
 	server := defaultServer()
+	server.TsigSecret = provider.tsigSecrets
 	server.Addr = addr
 	server.Net = netType
 
@@ -59,6 +76,7 @@ func (provider *provider) serve(netType string, addr string) *dns.Server {
 
 func (provider *provider) listen(listener net.Listener, packetConn net.PacketConn) *dns.Server {
 	server := defaultServer()
+	server.TsigSecret = provider.tsigSecrets
 	if packetConn != nil {
 		if t, ok := packetConn.(*net.UDPConn); ok && t != nil {
 			log.Infof("Listen to udp on address: %s", t.LocalAddr().String())
@@ -97,6 +115,20 @@ func (provider *provider) handle(writer dns.ResponseWriter, request *dns.Msg) {
 		protocol = "tcp"
 	}
 
+	// zone transfers can be more than one message and are written by the engine
+	if provider.engine != nil && engine.IsTransfer(request) {
+		provider.engine.Transfer(writer, request)
+		return
+	}
+	if provider.engine != nil && engine.IsNotify(request) {
+		provider.engine.Notify(writer, request)
+		return
+	}
+	if provider.engine != nil && engine.IsUpdate(request) {
+		provider.engine.Update(writer, request)
+		return
+	}
+
 	// if an engine is available actually provide some resolution
 	if provider.engine != nil {
 		// make query and get information back for metrics/logging
@@ -111,10 +143,13 @@ func (provider *provider) handle(writer dns.ResponseWriter, request *dns.Msg) {
 		log.Errorf("No engine to process request")
 	}
 
-	// write response to response writer
-	err := writer.WriteMsg(response)
-	if err != nil {
-		log.Errorf("Writing response: %s", err)
+	// a nil response means the request is dropped without an answer (rate limited)
+	if response != nil {
+		// write response to response writer
+		err := writer.WriteMsg(response)
+		if err != nil {
+			log.Errorf("Writing response: %s", err)
+		}
 	}
 
 	// we were having some errors during write that we need to figure out
@@ -153,6 +188,9 @@ func (provider *provider) Host(config *config.GudgeonConfig, engine engine.Engin
 		provider.engine = engine
 	}
 
+	// keys that sign zone transfers
+	provider.tsigSecrets = config.TsigSecrets()
+
 	// global dns handle function
 	dns.HandleFunc(".", provider.handle)
 
@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"os"
 	"testing"
 	"time"
 
@@ -130,3 +131,138 @@ func TestProviderLocalResolution(t *testing.T) {
 		source.Close()
 	}
 }
+
+func TestProviderZoneTransfer(t *testing.T) {
+	config := testutil.TestConf(t, "./testdata/transfer-test.yml")
+
+	// prepare engine with config options
+	engine, err := engine.NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not build engine: %s", err)
+		return
+	}
+
+	// create a new provider and start hosting
+	provider := NewProvider(engine)
+	err = provider.Host(config, engine)
+	if err != nil {
+		t.Errorf("Creating test provider: %s", err)
+		return
+	}
+	time.Sleep(2 * time.Second)
+
+	data := []struct {
+		qtype   uint16
+		serial  uint32
+		signed  bool
+		records int
+	}{
+		// the whole zone between two soa records
+		{dns.TypeAXFR, 0, true, 7},
+		// a secondary that is up to date only gets the soa
+		{dns.TypeIXFR, 2020010101, true, 1},
+		// a secondary with an unknown version gets the whole zone
+		{dns.TypeIXFR, 2019010101, true, 7},
+		// unsigned requests are refused
+		{dns.TypeAXFR, 0, false, 0},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		if d.qtype == dns.TypeIXFR {
+			request.SetIxfr("example.corp.", d.serial, "ns.example.corp.", "admin.example.corp.")
+		} else {
+			request.SetAxfr("example.corp.")
+		}
+		transfer := &dns.Transfer{TsigSecret: config.TsigSecrets()}
+		if d.signed {
+			request.SetTsig("transfer-key.", dns.HmacSHA256, 300, time.Now().Unix())
+		}
+
+		envelopes, err := transfer.In(request, "127.0.0.1:25354")
+		if err != nil {
+			t.Errorf("Could not start %s: %s", dns.Type(d.qtype).String(), err)
+			continue
+		}
+		records := 0
+		var transferErr error
+		for envelope := range envelopes {
+			if envelope.Error != nil {
+				transferErr = envelope.Error
+				break
+			}
+			records += len(envelope.RR)
+		}
+		if d.records > 0 && transferErr != nil {
+			t.Errorf("Unexpected error during %s (serial %d): %s", dns.Type(d.qtype).String(), d.serial, transferErr)
+		} else if d.records == 0 && transferErr == nil {
+			t.Errorf("Expected %s to be refused", dns.Type(d.qtype).String())
+		}
+		if records != d.records {
+			t.Errorf("Expected %d records from %s (serial %d) but got %d", d.records, dns.Type(d.qtype).String(), d.serial, records)
+		}
+	}
+
+	// make sure they shut down
+	err = provider.Shutdown()
+	if err != nil {
+		t.Errorf("Shutting down test provider: %s", err)
+	}
+	engine.Shutdown()
+}
+
+func TestProviderDynamicUpdate(t *testing.T) {
+	config := testutil.TestConf(t, "./testdata/update-test.yml")
+	// the update is written to a journal next to the zone file
+	defer os.Remove("./testdata/update.db.jnl")
+
+	// prepare engine with config options
+	engine, err := engine.NewEngine(config)
+	if err != nil {
+		t.Errorf("Could not build engine: %s", err)
+		return
+	}
+
+	// create a new provider and start hosting
+	provider := NewProvider(engine)
+	err = provider.Host(config, engine)
+	if err != nil {
+		t.Errorf("Creating test provider: %s", err)
+		return
+	}
+	time.Sleep(2 * time.Second)
+
+	client := &dns.Client{Net: "tcp", TsigSecret: config.TsigSecrets()}
+	record, _ := dns.NewRR("host.dyn.example.corp. 300 IN A 10.0.0.30")
+
+	// unsigned updates are refused
+	request := new(dns.Msg)
+	request.SetUpdate("dyn.example.corp.")
+	request.Insert([]dns.RR{record})
+	if response, _, err := client.Exchange(request, "127.0.0.1:25355"); err != nil || response.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected unsigned update to be refused but got %v (%s)", response, err)
+	}
+
+	// signed updates are applied
+	request = new(dns.Msg)
+	request.SetUpdate("dyn.example.corp.")
+	request.Insert([]dns.RR{record})
+	request.SetTsig("update-key.", dns.HmacSHA256, 300, time.Now().Unix())
+	if response, _, err := client.Exchange(request, "127.0.0.1:25355"); err != nil || response.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected signed update to succeed but got %v (%s)", response, err)
+	}
+
+	// the record is answered right away
+	question := new(dns.Msg)
+	question.SetQuestion("host.dyn.example.corp.", dns.TypeA)
+	if response, _, err := client.Exchange(question, "127.0.0.1:25355"); err != nil || "10.0.0.30" != util.GetFirstIPResponse(response) {
+		t.Errorf("Expected updated record in answer but got %v (%s)", response, err)
+	}
+
+	// make sure they shut down
+	err = provider.Shutdown()
+	if err != nil {
+		t.Errorf("Shutting down test provider: %s", err)
+	}
+	engine.Shutdown()
+}
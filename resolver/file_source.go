@@ -44,6 +44,10 @@ func (source *fileSource) Load(specification string) {
 		// assumed that specification is already a path to a file here
 		source.path = specification
 		source.reloadableSource.Load(source.path)
+		// zones from zone files can be updated
+		if zone, ok := source.reloadableSource.(*zoneSource); ok {
+			registerZoneFile(source, zone.origins)
+		}
 		// if not watched start the watch
 		if !source.watched {
 			source.watchAndLoad()
@@ -69,4 +73,9 @@ func (source *fileSource) Close() {
 	if source.handle != nil {
 		source.handle.Close()
 	}
+	unregisterZoneFile(source)
+	// close the loaded source
+	if source.reloadableSource != nil {
+		source.reloadableSource.Close()
+	}
 }
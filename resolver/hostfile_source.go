@@ -317,6 +317,7 @@ func (hostFileSource *hostFileSource) Answer(rCon *RequestContext, context *Reso
 
 		// update source used
 		context.SourceUsed = hostFileSource.Name()
+		context.Local = true
 	}
 
 	return response, nil
@@ -0,0 +1,241 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+const (
+	// the source option with the domain that lease host names are answered under
+	leaseDomainOption = "domain"
+	// the layout of lease times in isc dhcpd lease files
+	iscLeaseTimeLayout = "2006/01/02 15:04:05"
+)
+
+// a valid single label host name
+var leaseHostnameRegex = regexp.MustCompile("^[a-z0-9]([a-z0-9-]*[a-z0-9])?$")
+
+// a dhcp lease for a host name
+type lease struct {
+	address  net.IP
+	hostname string
+	// when the lease ends, zero for a lease that does not end
+	expires time.Time
+}
+
+// answers A, AAAA, and PTR questions for the host names in a dnsmasq (dnsmasq.leases) or isc dhcpd (dhcpd.leases)
+// lease file. the names are answered under the configured domain, or as single label names without a domain.
+type leaseSource struct {
+	filePath string
+	domain   string
+
+	mux   sync.RWMutex
+	hosts *hostFileSource
+	// loads the leases again when the first of the loaded leases ends
+	expiryTimer *time.Timer
+	closed      bool
+}
+
+func (leaseSource *leaseSource) Name() string {
+	leaseSource.mux.RLock()
+	defer leaseSource.mux.RUnlock()
+	return "leases:" + leaseSource.filePath
+}
+
+func (leaseSource *leaseSource) Load(leaseFile string) {
+	leaseSource.mux.Lock()
+	leaseSource.filePath = leaseFile
+	leaseSource.domain = strings.Trim(strings.ToLower(leaseSource.domain), ".")
+	domain := leaseSource.domain
+	leaseSource.mux.Unlock()
+
+	data, err := util.GetFileAsArray(leaseFile)
+	if err != nil {
+		log.Errorf("While opening '%s': %s", leaseFile, err)
+		return
+	}
+
+	// the leases become host file entries
+	now := time.Now()
+	nextExpiry := time.Time{}
+	entries := make([]string, 0)
+	for _, lease := range parseLeases(data) {
+		if !lease.expires.IsZero() {
+			if lease.expires.Before(now) {
+				continue
+			}
+			if nextExpiry.IsZero() || lease.expires.Before(nextExpiry) {
+				nextExpiry = lease.expires
+			}
+		}
+		name := lease.hostname
+		if "" != domain {
+			name = name + "." + domain
+		}
+		entries = append(entries, fmt.Sprintf("%s %s", lease.address.String(), name))
+	}
+
+	hosts := &hostFileSource{}
+	hosts.LoadArray(entries)
+	hosts.filePath = leaseFile
+
+	leaseSource.mux.Lock()
+	defer leaseSource.mux.Unlock()
+	if leaseSource.closed {
+		return
+	}
+	leaseSource.hosts = hosts
+
+	// leases that end are removed even when the lease file has not changed
+	if leaseSource.expiryTimer != nil {
+		leaseSource.expiryTimer.Stop()
+		leaseSource.expiryTimer = nil
+	}
+	if !nextExpiry.IsZero() {
+		leaseSource.expiryTimer = time.AfterFunc(time.Until(nextExpiry), func() {
+			leaseSource.Load(leaseFile)
+		})
+	}
+
+	log.Debugf("Loaded %d leases from '%s'", len(entries), leaseFile)
+}
+
+// the single label host name for the name a client gave or "" if the name can't be used
+func leaseHostname(name string) string {
+	name = strings.ToLower(strings.Trim(strings.TrimSpace(name), "\""))
+	if idx := strings.Index(name, "."); idx >= 0 {
+		name = name[:idx]
+	}
+	if !leaseHostnameRegex.MatchString(name) {
+		return ""
+	}
+	return name
+}
+
+// parse the leases in either a dnsmasq or an isc dhcpd lease file
+func parseLeases(lines []string) []*lease {
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "lease ") {
+			return parseIscLeases(lines)
+		}
+	}
+	return parseDnsmasqLeases(lines)
+}
+
+// dnsmasq leases are a line for each lease: "<expiry> <mac or iaid> <address> <hostname> <client id>", the
+// hostname is "*" when the client didn't give one and an expiry of 0 is a lease that does not end
+func parseDnsmasqLeases(lines []string) []*lease {
+	leases := make([]*lease, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || "duid" == fields[0] {
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		address := net.ParseIP(fields[2])
+		hostname := leaseHostname(fields[3])
+		if err != nil || address == nil || "" == hostname {
+			continue
+		}
+		parsed := &lease{address: address, hostname: hostname}
+		if expiry > 0 {
+			parsed.expires = time.Unix(expiry, 0)
+		}
+		leases = append(leases, parsed)
+	}
+	return leases
+}
+
+// isc dhcpd leases are blocks like "lease <address> { ... }" with the end of the lease, the binding state, and
+// the client hostname. the file is only appended to so a later block for an address replaces an earlier one.
+func parseIscLeases(lines []string) []*lease {
+	byAddress := make(map[string]*lease)
+	order := make([]string, 0)
+
+	var (
+		current *lease
+		active  bool
+	)
+	for _, line := range lines {
+		line = strings.TrimSuffix(strings.TrimSpace(line), ";")
+		fields := strings.Fields(line)
+		if len(fields) < 1 {
+			continue
+		}
+
+		switch {
+		case "lease" == fields[0] && len(fields) > 1:
+			current, active = &lease{address: net.ParseIP(fields[1])}, true
+		case current == nil:
+			continue
+		case "}" == fields[0]:
+			if current.address != nil {
+				key := current.address.String()
+				if _, found := byAddress[key]; !found {
+					order = append(order, key)
+				}
+				byAddress[key] = nil
+				if active && "" != current.hostname {
+					byAddress[key] = current
+				}
+			}
+			current = nil
+		case "ends" == fields[0] && len(fields) > 2 && "epoch" == fields[1]:
+			if epoch, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+				current.expires = time.Unix(epoch, 0)
+			}
+		case "ends" == fields[0] && len(fields) > 3:
+			// times are utc with the day of the week first
+			if ends, err := time.Parse(iscLeaseTimeLayout, fields[2]+" "+fields[3]); err == nil {
+				current.expires = ends
+			}
+		case "binding" == fields[0] && len(fields) > 2 && "state" == fields[1]:
+			active = "active" == fields[2]
+		case "client-hostname" == fields[0] && len(fields) > 1:
+			current.hostname = leaseHostname(fields[1])
+		}
+	}
+
+	leases := make([]*lease, 0, len(order))
+	for _, key := range order {
+		if found := byAddress[key]; found != nil {
+			leases = append(leases, found)
+		}
+	}
+	return leases
+}
+
+func (leaseSource *leaseSource) Answer(rCon *RequestContext, context *ResolutionContext, request *dns.Msg) (*dns.Msg, error) {
+	leaseSource.mux.RLock()
+	hosts := leaseSource.hosts
+	leaseSource.mux.RUnlock()
+	if hosts == nil {
+		return nil, nil
+	}
+
+	response, err := hosts.Answer(rCon, context, request)
+	if context != nil && context.SourceUsed == hosts.Name() {
+		context.SourceUsed = leaseSource.Name()
+	}
+	return response, err
+}
+
+func (leaseSource *leaseSource) Close() {
+	leaseSource.mux.Lock()
+	defer leaseSource.mux.Unlock()
+	leaseSource.closed = true
+	if leaseSource.expiryTimer != nil {
+		leaseSource.expiryTimer.Stop()
+		leaseSource.expiryTimer = nil
+	}
+}
@@ -0,0 +1,144 @@
+package resolver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/testutil"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+func TestLeaseSource(t *testing.T) {
+	data := []struct {
+		leaseFile string
+		domain    string
+		name      string
+		qType     uint16
+		expected  string
+	}{
+		// dnsmasq
+		{"testdata/dnsmasq.leases", "lan", "laptop.lan.", dns.TypeA, "192.168.1.10"},
+		{"testdata/dnsmasq.leases", "lan", "LAPTOP.lan.", dns.TypeA, "192.168.1.10"},
+		{"testdata/dnsmasq.leases", "lan", "laptop.lan.", dns.TypeAAAA, "fd00::10"},
+		{"testdata/dnsmasq.leases", "lan", "printer.lan.", dns.TypeA, "192.168.1.11"},
+		{"testdata/dnsmasq.leases", "lan", "expired.lan.", dns.TypeA, ""},
+		{"testdata/dnsmasq.leases", "lan", "laptop.", dns.TypeA, ""},
+		{"testdata/dnsmasq.leases", "lan", util.ReverseLookupDomainString("192.168.1.10"), dns.TypePTR, "laptop.lan."},
+		{"testdata/dnsmasq.leases", "lan", util.ReverseLookupDomainString("fd00::10"), dns.TypePTR, "laptop.lan."},
+		{"testdata/dnsmasq.leases", "lan", util.ReverseLookupDomainString("192.168.1.12"), dns.TypePTR, ""},
+		{"testdata/dnsmasq.leases", "", "laptop.", dns.TypeA, "192.168.1.10"},
+		{"testdata/dnsmasq.leases", "", util.ReverseLookupDomainString("192.168.1.11"), dns.TypePTR, "printer."},
+		// isc dhcpd
+		{"testdata/dhcpd.leases", ".Home.", "desktop.home.", dns.TypeA, "10.0.0.20"},
+		{"testdata/dhcpd.leases", "home", "tablet.home.", dns.TypeA, "10.0.0.23"},
+		{"testdata/dhcpd.leases", "home", "expired.home.", dns.TypeA, ""},
+		{"testdata/dhcpd.leases", "home", "released.home.", dns.TypeA, ""},
+		{"testdata/dhcpd.leases", "home", util.ReverseLookupDomainString("10.0.0.20"), dns.TypePTR, "desktop.home."},
+		{"testdata/dhcpd.leases", "home", util.ReverseLookupDomainString("10.0.0.22"), dns.TypePTR, ""},
+	}
+
+	for _, d := range data {
+		source := &leaseSource{domain: d.domain}
+		source.Load(d.leaseFile)
+		source.Close()
+
+		request := new(dns.Msg)
+		request.SetQuestion(d.name, d.qType)
+		context := DefaultResolutionContext()
+		response, err := source.Answer(nil, context, request)
+		if err != nil {
+			t.Errorf("Could not resolve '%s' from '%s': %s", d.name, d.leaseFile, err)
+			continue
+		}
+
+		answer := ""
+		if response != nil && len(response.Answer) > 0 {
+			switch rr := response.Answer[0].(type) {
+			case *dns.A:
+				answer = rr.A.String()
+			case *dns.AAAA:
+				answer = rr.AAAA.String()
+			case *dns.PTR:
+				answer = rr.Ptr
+			}
+		}
+		if d.expected != answer {
+			t.Errorf("Expected '%s' for '%s' from '%s' but got '%s'", d.expected, d.name, d.leaseFile, answer)
+		}
+		if "" != answer && context.SourceUsed != source.Name() {
+			t.Errorf("Expected source used to be '%s' but got '%s'", source.Name(), context.SourceUsed)
+		}
+	}
+}
+
+func TestLeaseSourceOptions(t *testing.T) {
+	source := NewConfigurationSource(&config.GudgeonSource{
+		Name:    "leases",
+		Specs:   []string{"testdata/dnsmasq.leases"},
+		Options: map[string]interface{}{"domain": "lan"},
+	}, nil)
+	defer source.Close()
+
+	watcher, ok := source.(*fileSource)
+	if !ok {
+		t.Fatalf("Expected a file source but got %T", source)
+	}
+	if leases, ok := watcher.reloadableSource.(*leaseSource); !ok || "lan" != leases.domain {
+		t.Fatalf("Expected a lease source with the domain from the options but got %T", watcher.reloadableSource)
+	}
+	if !isLocalSource(source) {
+		t.Errorf("Expected the lease source to be local")
+	}
+
+	request := new(dns.Msg)
+	request.SetQuestion("laptop.lan.", dns.TypeA)
+	response, err := source.Answer(nil, nil, request)
+	if err != nil || response == nil || len(response.Answer) != 1 {
+		t.Errorf("Expected an answer for a host with a lease but got %v (%v)", response, err)
+	}
+}
+
+func TestLeaseSourceExpiry(t *testing.T) {
+	dir := testutil.TempDir()
+	defer os.RemoveAll(dir)
+	leaseFile := path.Join(dir, "expiry.leases")
+	contents := fmt.Sprintf("%d 00:11:22:33:44:55 192.168.1.30 ending *\n0 00:11:22:33:44:56 192.168.1.31 static *\n", time.Now().Add(time.Second).Unix())
+	if err := ioutil.WriteFile(leaseFile, []byte(contents), 0644); err != nil {
+		t.Fatalf("Could not write lease file: %s", err)
+	}
+
+	source := &leaseSource{domain: "lan"}
+	source.Load(leaseFile)
+	defer source.Close()
+
+	// answer the question with the source and return the number of answers
+	ask := func(name string) int {
+		request := new(dns.Msg)
+		request.SetQuestion(name, dns.TypeA)
+		response, err := source.Answer(nil, nil, request)
+		if err != nil || response == nil {
+			return 0
+		}
+		return len(response.Answer)
+	}
+
+	if 1 != ask("ending.lan.") {
+		t.Errorf("Expected an answer for a lease that has not ended")
+	}
+
+	// the leases are loaded again when the lease ends without a change to the file or a query
+	time.Sleep(2500 * time.Millisecond)
+	if 0 != ask("ending.lan.") {
+		t.Errorf("Expected no answer for a lease that has ended")
+	}
+	if 1 != ask("static.lan.") {
+		t.Errorf("Expected an answer for a lease that does not end")
+	}
+}
@@ -24,6 +24,7 @@ type RequestContext struct {
 	Started  time.Time // when the request starts
 	Protocol string    // the protocol that the request came in with
 	Groups   []string  // the groups that belong to the original requester
+	Consumer string    // the name of the consumer that made the request
 
 	// pool reference for returning
 	pool *sync.Pool
@@ -40,6 +41,7 @@ func DefaultRequestContext() *RequestContext {
 func (context *RequestContext) Put() {
 	// clear values that won't be set
 	context.Groups = make([]string, 0)
+	context.Consumer = ""
 	// return to pool for reuse
 	if context.pool != nil {
 		context.pool.Put(context)
@@ -63,6 +65,7 @@ type ResolutionContext struct {
 	ResolverUsed string // the resolver that did the work
 	SourceUsed   string // actual source that did the resolution
 	Cached       bool   // was the result found by querying the Cache
+	Local        bool   // was the result from a local source (hosts or zone file)
 
 	// reporting on blocks/block status (todo: make Match not block)
 	Blocked     bool
@@ -80,6 +83,7 @@ func DefaultResolutionContext() *ResolutionContext {
 	context.ResolverUsed = ""
 	context.SourceUsed = ""
 	context.Cached = false
+	context.Local = false
 	context.Blocked = false
 	context.BlockedRule = ""
 
@@ -106,6 +110,8 @@ type resolver struct {
 	skip    []string
 	search  []string
 	sources []Source
+	// special use domains may be sent to sources that forward them
+	forwardSpecial bool
 }
 
 type Resolver interface {
@@ -139,6 +145,8 @@ func newSharedSourceResolver(configuredResolver *config.GudgeonResolver, configu
 		skip:    configuredResolver.SkipDomains,
 		search:  configuredResolver.Search,
 		sources: make([]Source, 0, len(configuredResolver.Sources)),
+
+		forwardSpecial: configuredResolver.ForwardSpecial,
 	}
 
 	// add literal hostfile source first source if hosts is configured
@@ -186,10 +194,18 @@ func newSharedSourceResolver(configuredResolver *config.GudgeonResolver, configu
 
 // base answer function
 func (resolver *resolver) answer(rCon *RequestContext, context *ResolutionContext, request *dns.Msg) (*dns.Msg, error) {
+	// special use domains and private reverse lookups are only answered by local sources
+	localOnly := !resolver.forwardSpecial && util.IsSpecialUseDomain(request.Question[0].Name)
+
 	// step through sources and return result
 	emptyCounter := 0
 	errCounter := 0
 	for _, source := range resolver.sources {
+		if localOnly && !isLocalSource(source) {
+			log.Debugf("Not forwarding special use domain '%s' to source '%s' in resolver: %s", request.Question[0].Name, source.Name(), resolver.name)
+			continue
+		}
+
 		response, err := source.Answer(rCon, context, request)
 
 		if err != nil {
@@ -198,8 +214,9 @@ func (resolver *resolver) answer(rCon *RequestContext, context *ResolutionContex
 			continue
 		}
 
-		// if the response is not empty and the response is not explicitly NXDOMAIN go on to the next source
-		if !util.IsEmptyResponse(response) {
+		// if the response is not empty and the response is not explicitly NXDOMAIN go on to the next source,
+		// unless the empty response is from the authority for the name
+		if !util.IsEmptyResponse(response) || util.IsAuthoritativeNegative(response) {
 			//  update the used resolver
 			if context != nil && "" == context.ResolverUsed {
 				context.ResolverUsed = resolver.name
@@ -40,6 +40,7 @@ type ResolverMap interface {
 // returned as part of resolution to get data what actually resolved the query
 type ResolutionResult struct {
 	Cached   bool
+	Local    bool // answered by a local source (hosts or zone file)
 	Consumer string
 	Source   string
 	Resolver string
@@ -47,6 +48,18 @@ type ResolutionResult struct {
 
 	// reporting on blocks
 	Blocked bool
+	// blocking was paused for the request
+	Paused bool
+	// the request was over a rate limit and was refused or dropped
+	RateLimited bool
+	// the number of requests that were limited since the last limited request was reported
+	RateLimitedQueries int64
+	// private addresses were stripped from the answer, or the answer was blocked, to prevent dns rebinding
+	Rebinding bool
+	// the query was answered by a query type policy of a group instead of being resolved
+	QueryTypePolicy bool
+	// the query was answered with the safe search endpoint of a search engine
+	SafeSearch bool
 
 	// reporting on matches
 	Match     rule.Match          // allowed or blocked
@@ -81,6 +94,9 @@ func NewResolverMap(config *config.GudgeonConfig, configuredResolvers []*config.
 		},
 	}
 
+	// keys that secondary sources sign transfers with
+	useTsigKeys(config.TsigKeys)
+
 	// create sources from specs
 	configuredSources := make(map[string]Source)
 	sharedSources := make(map[string]Source)
@@ -121,6 +137,8 @@ func (resolverMap *resolverMap) result(context *ResolutionContext) *ResolutionRe
 	// set results
 	result := resolverMap.pool.Get().(*ResolutionResult)
 	result.Cached = context.Cached
+	result.Local = context.Local
+	result.SafeSearch = false
 	result.Source = context.SourceUsed
 	result.Resolver = context.ResolverUsed
 
@@ -179,7 +197,7 @@ func (resolverMap *resolverMap) AnswerMultiResolvers(rCon *RequestContext, resol
 			errors = append(errors, fmt.Sprintf("%s", err))
 			continue
 		}
-		if !util.IsEmptyResponse(response) {
+		if !util.IsEmptyResponse(response) || util.IsAuthoritativeNegative(response) {
 			// then return
 			return response, result, nil
 		}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/miekg/dns"
 
+	"github.com/chrisruffalo/gudgeon/config"
 	"github.com/chrisruffalo/gudgeon/testutil"
 )
 
@@ -188,3 +189,59 @@ func BenchmarkResolver(b *testing.B) {
 
 	resolvers.Close()
 }
+
+// a source that forwards questions, it answers every question and counts the questions it was asked
+type forwardingTestSource struct {
+	asked int
+}
+
+func (source *forwardingTestSource) Name() string {
+	return "forwarding"
+}
+
+func (source *forwardingTestSource) Load(specification string) {
+}
+
+func (source *forwardingTestSource) Answer(rCon *RequestContext, context *ResolutionContext, request *dns.Msg) (*dns.Msg, error) {
+	source.asked++
+	response := new(dns.Msg)
+	response.SetReply(request)
+	rr, _ := dns.NewRR(request.Question[0].Name + " 60 IN A 203.0.113.1")
+	response.Answer = append(response.Answer, rr)
+	return response, nil
+}
+
+func (source *forwardingTestSource) Close() {
+}
+
+func TestSpecialUseDomains(t *testing.T) {
+	data := []struct {
+		domain    string
+		forward   bool
+		answered  bool
+		forwarded bool
+	}{
+		{"www.example.com.", false, true, true},
+		// a local source still answers special use domains
+		{"printer.local.", false, true, false},
+		{"nas.local.", false, false, false},
+		{"20.1.168.192.in-addr.arpa.", false, false, false},
+		{"nas.local.", true, true, true},
+	}
+
+	for _, d := range data {
+		forwarding := &forwardingTestSource{}
+		resolver := newResolver(&config.GudgeonResolver{Name: "test", Hosts: []string{"10.0.0.5 printer.local"}, ForwardSpecial: d.forward})
+		resolver.sources = append(resolver.sources, forwarding)
+
+		request := new(dns.Msg)
+		request.SetQuestion(d.domain, dns.TypeA)
+		response, err := resolver.Answer(nil, nil, request)
+		if err != nil {
+			t.Errorf("Unexpected error resolving '%s': %s", d.domain, err)
+		}
+		if answered := response != nil && len(response.Answer) > 0; answered != d.answered || (forwarding.asked > 0) != d.forwarded {
+			t.Errorf("Expected '%s' answered %t and forwarded %t but got %t and %d questions", d.domain, d.answered, d.forwarded, answered, forwarding.asked)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/config"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+const (
+	secondaryPrefix = "axfr://"
+	// bounds on how often the primary is checked, whatever the soa record asks for
+	secondaryMinimumWait = 30 * time.Second
+	secondaryMaximumWait = 24 * time.Hour
+	// how long to wait before trying again when there is no zone yet
+	secondaryInitialRetry = time.Minute
+	secondaryTimeout      = 5 * time.Second
+)
+
+// the tsig keys that secondary sources sign their requests with, by key name
+var tsigKeys = struct {
+	mux  sync.RWMutex
+	keys map[string]*config.GudgeonTsigKey
+}{
+	keys: make(map[string]*config.GudgeonTsigKey),
+}
+
+// use the configured tsig keys for the transfers of secondary sources
+func useTsigKeys(keys []*config.GudgeonTsigKey) {
+	tsigKeys.mux.Lock()
+	defer tsigKeys.mux.Unlock()
+	tsigKeys.keys = make(map[string]*config.GudgeonTsigKey, len(keys))
+	for _, key := range keys {
+		if key != nil && "" != key.AlgorithmName() {
+			tsigKeys.keys[key.Fqdn()] = key
+		}
+	}
+}
+
+func tsigKey(name string) *config.GudgeonTsigKey {
+	tsigKeys.mux.RLock()
+	defer tsigKeys.mux.RUnlock()
+	return tsigKeys.keys[dns.Fqdn(strings.ToLower(name))]
+}
+
+// the secondary sources that are running, so that a notify from a primary can reach them
+var secondaries = struct {
+	mux     sync.RWMutex
+	sources map[*secondarySource]bool
+}{
+	sources: make(map[*secondarySource]bool),
+}
+
+// a copy of a zone transferred from a primary server (like "axfr://transfer-key@10.0.0.2/example.corp"). the zone
+// is transferred when the source is loaded, when the soa record of the primary has a new serial after the refresh
+// interval, and when the primary sends a notify.
+type secondarySource struct {
+	spec    string
+	zone    string
+	primary string
+	key     string
+
+	// the transferred zone, nil until the first transfer and after the zone expires
+	mux     sync.RWMutex
+	current *zoneSource
+	soa     *dns.SOA
+	closed  bool
+	// when the zone was last transferred or confirmed to be up to date
+	refreshed time.Time
+
+	// trigger a refresh (from a notify) or stop refreshing
+	refreshChan chan bool
+	closeChan   chan bool
+}
+
+// if the specification is for a zone transferred from a primary
+func isSecondarySpec(specification string) bool {
+	return strings.HasPrefix(strings.ToLower(specification), secondaryPrefix)
+}
+
+func (secondary *secondarySource) Name() string {
+	return secondary.spec
+}
+
+func (secondary *secondarySource) Load(specification string) {
+	secondary.spec = specification
+	secondary.refreshChan = make(chan bool, 1)
+	secondary.closeChan = make(chan bool)
+
+	if err := secondary.parse(specification); err != nil {
+		log.Errorf("Secondary source '%s': %s", specification, err)
+		return
+	}
+
+	secondaries.mux.Lock()
+	secondaries.sources[secondary] = true
+	secondaries.mux.Unlock()
+
+	// the first transfer happens in the background so that an unreachable primary doesn't hold up the engine, the
+	// source doesn't answer until it is done
+	go secondary.maintain(0)
+}
+
+// parse "axfr://[key@]primary[:port]/zone"
+func (secondary *secondarySource) parse(specification string) error {
+	parsed, err := url.Parse(specification)
+	if err != nil {
+		return err
+	}
+	if parsed.User != nil {
+		secondary.key = parsed.User.Username()
+	}
+	secondary.zone = dns.Fqdn(strings.ToLower(strings.Trim(parsed.Path, "/")))
+	if "." == secondary.zone {
+		return fmt.Errorf("no zone given")
+	}
+	if "" == parsed.Hostname() {
+		return fmt.Errorf("no primary given")
+	}
+	port := parsed.Port()
+	if "" == port {
+		port = "53"
+	}
+	// a notify is matched against the address of the primary so a host name is resolved once, here
+	address := net.ParseIP(parsed.Hostname())
+	if address == nil {
+		addresses, err := net.LookupIP(parsed.Hostname())
+		if err != nil || len(addresses) < 1 {
+			return fmt.Errorf("could not resolve primary '%s': %v", parsed.Hostname(), err)
+		}
+		address = addresses[0]
+	}
+	secondary.primary = net.JoinHostPort(address.String(), port)
+	return nil
+}
+
+// sign the request with the key of the source, if it has one
+func (secondary *secondarySource) sign(request *dns.Msg) (map[string]string, error) {
+	if "" == secondary.key {
+		return nil, nil
+	}
+	key := tsigKey(secondary.key)
+	if key == nil {
+		return nil, fmt.Errorf("key '%s' is not a configured tsig key", secondary.key)
+	}
+	request.SetTsig(key.Fqdn(), key.AlgorithmName(), 300, time.Now().Unix())
+	return map[string]string{key.Fqdn(): key.SecretValue()}, nil
+}
+
+// the soa record of the zone on the primary
+func (secondary *secondarySource) primarySOA() (*dns.SOA, error) {
+	request := new(dns.Msg)
+	request.SetQuestion(secondary.zone, dns.TypeSOA)
+	secrets, err := secondary.sign(request)
+	if err != nil {
+		return nil, err
+	}
+	client := &dns.Client{Net: "tcp", Timeout: secondaryTimeout, TsigSecret: secrets}
+	response, _, err := client.Exchange(request, secondary.primary)
+	if err != nil {
+		return nil, err
+	}
+	for _, rr := range response.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa, nil
+		}
+	}
+	return nil, fmt.Errorf("primary answered without an soa record (%s)", dns.RcodeToString[response.Rcode])
+}
+
+// transfer the whole zone from the primary
+func (secondary *secondarySource) transfer() ([]dns.RR, error) {
+	request := new(dns.Msg)
+	request.SetAxfr(secondary.zone)
+	secrets, err := secondary.sign(request)
+	if err != nil {
+		return nil, err
+	}
+	transfer := &dns.Transfer{DialTimeout: secondaryTimeout, ReadTimeout: secondaryTimeout, TsigSecret: secrets}
+	envelopes, err := transfer.In(request, secondary.primary)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]dns.RR, 0)
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			err = envelope.Error
+			continue
+		}
+		records = append(records, envelope.RR...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the zone is between two copies of the soa record
+	if len(records) < 2 {
+		return nil, fmt.Errorf("transfer was incomplete")
+	}
+	return records[:len(records)-1], nil
+}
+
+// check the primary for a new version of the zone and transfer it, returns how long to wait for the next check
+func (secondary *secondarySource) refresh() time.Duration {
+	secondary.mux.RLock()
+	current := secondary.soa
+	secondary.mux.RUnlock()
+
+	// how long to wait after failing, from the soa record once there is a zone
+	retry := secondaryInitialRetry
+	if current != nil {
+		retry = boundedWait(current.Retry)
+	}
+
+	primary, err := secondary.primarySOA()
+	if err != nil {
+		log.Errorf("Secondary source '%s': checking primary: %s", secondary.spec, err)
+		secondary.expire()
+		return retry
+	}
+
+	if current == nil || serialBefore(current.Serial, primary.Serial) {
+		records, err := secondary.transfer()
+		if err != nil {
+			log.Errorf("Secondary source '%s': transfer: %s", secondary.spec, err)
+			secondary.expire()
+			return retry
+		}
+		zone := &zoneSource{filePath: secondary.spec, owner: secondary}
+		zone.reset()
+		zone.loadRecords(records)
+
+		secondary.mux.Lock()
+		// the source was closed during the transfer so the zone isn't kept
+		if secondary.closed {
+			secondary.mux.Unlock()
+			unregisterZones(secondary, nil)
+			return retry
+		}
+		secondary.current = zone
+		secondary.soa = records[0].(*dns.SOA)
+		secondary.refreshed = time.Now()
+		secondary.mux.Unlock()
+
+		log.Infof("Transferred '%s' from %s (serial %d, %d records)", secondary.zone, secondary.primary, secondary.soa.Serial, len(records))
+		return boundedWait(secondary.soa.Refresh)
+	}
+
+	// the zone is up to date
+	secondary.mux.Lock()
+	secondary.refreshed = time.Now()
+	secondary.mux.Unlock()
+	return boundedWait(current.Refresh)
+}
+
+// stop answering from the zone when it has not been refreshed within the expire time of the soa record
+func (secondary *secondarySource) expire() {
+	secondary.mux.Lock()
+	defer secondary.mux.Unlock()
+	if secondary.soa != nil && time.Since(secondary.refreshed) > time.Duration(secondary.soa.Expire)*time.Second {
+		log.Errorf("Secondary source '%s': zone expired, not answering until the next transfer", secondary.spec)
+		secondary.current = nil
+		secondary.soa = nil
+		unregisterZones(secondary, nil)
+	}
+}
+
+func boundedWait(seconds uint32) time.Duration {
+	wait := time.Duration(seconds) * time.Second
+	if wait < secondaryMinimumWait {
+		return secondaryMinimumWait
+	} else if wait > secondaryMaximumWait {
+		return secondaryMaximumWait
+	}
+	return wait
+}
+
+// refresh the zone on the schedule from the soa record or when the primary sends a notify
+func (secondary *secondarySource) maintain(wait time.Duration) {
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-secondary.closeChan:
+			timer.Stop()
+			return
+		case <-secondary.refreshChan:
+			timer.Stop()
+		case <-timer.C:
+		}
+		wait = secondary.refresh()
+	}
+}
+
+// a notify (rfc 1996) for the zone from the address, signed with the named key when the signature was valid. the
+// zone is refreshed by each secondary source with the address as the primary (and the key, if it has one). false
+// is returned if no secondary source accepts the notify.
+func NotifyZone(zone string, address net.IP, key string) bool {
+	zone = dns.Fqdn(strings.ToLower(zone))
+
+	secondaries.mux.RLock()
+	defer secondaries.mux.RUnlock()
+
+	accepted := false
+	for secondary := range secondaries.sources {
+		if secondary.zone != zone || ("" != secondary.key && !strings.EqualFold(dns.Fqdn(secondary.key), key)) {
+			continue
+		}
+		if host, _, err := net.SplitHostPort(secondary.primary); err != nil || !net.ParseIP(host).Equal(address) {
+			continue
+		}
+		accepted = true
+		// a refresh that is already waiting covers this notify too
+		select {
+		case secondary.refreshChan <- true:
+		default:
+		}
+	}
+	return accepted
+}
+
+func (secondary *secondarySource) Answer(rCon *RequestContext, context *ResolutionContext, request *dns.Msg) (*dns.Msg, error) {
+	secondary.mux.RLock()
+	zone := secondary.current
+	secondary.mux.RUnlock()
+
+	if zone == nil {
+		return nil, nil
+	}
+
+	response, err := zone.Answer(rCon, nil, request)
+	if err != nil || response == nil {
+		return response, err
+	}
+
+	if context != nil && (!util.IsEmptyResponse(response) || util.IsAuthoritativeNegative(response)) {
+		// don't cache responses
+		context.Stored = true
+
+		// update source used
+		context.SourceUsed = secondary.Name()
+		context.Local = true
+	}
+
+	return response, nil
+}
+
+func (secondary *secondarySource) Close() {
+	secondaries.mux.Lock()
+	if _, found := secondaries.sources[secondary]; found {
+		delete(secondaries.sources, secondary)
+		close(secondary.closeChan)
+	}
+	secondaries.mux.Unlock()
+
+	secondary.mux.Lock()
+	secondary.closed = true
+	secondary.current = nil
+	secondary.mux.Unlock()
+	unregisterZones(secondary, nil)
+}
@@ -0,0 +1,143 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+// a primary server for a zone that only answers requests signed with the test key
+type testPrimary struct {
+	mux     sync.Mutex
+	serial  uint32
+	address string
+}
+
+func (primary *testPrimary) records() []dns.RR {
+	primary.mux.Lock()
+	defer primary.mux.Unlock()
+	soa, _ := dns.NewRR(fmt.Sprintf("secondary.test. 3600 IN SOA ns.secondary.test. admin.secondary.test. %d 900 600 86400 300", primary.serial))
+	www, _ := dns.NewRR(fmt.Sprintf("www.secondary.test. 3600 IN A 10.0.0.%d", primary.serial))
+	return []dns.RR{soa, www}
+}
+
+func (primary *testPrimary) ServeDNS(writer dns.ResponseWriter, request *dns.Msg) {
+	if request.IsTsig() == nil || writer.TsigStatus() != nil {
+		response := new(dns.Msg)
+		response.SetRcode(request, dns.RcodeRefused)
+		_ = writer.WriteMsg(response)
+		return
+	}
+	records := primary.records()
+	if request.Question[0].Qtype == dns.TypeAXFR {
+		envelopes := make(chan *dns.Envelope, 1)
+		envelopes <- &dns.Envelope{RR: append(records, records[0])}
+		close(envelopes)
+		_ = new(dns.Transfer).Out(writer, request, envelopes)
+		return
+	}
+	response := new(dns.Msg)
+	response.SetReply(request)
+	response.Answer = records[:1]
+	tsig := request.IsTsig()
+	response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+	_ = writer.WriteMsg(response)
+}
+
+func TestSecondarySource(t *testing.T) {
+	conf := testutil.TestConf(t, "testdata/secondary.yml")
+	useTsigKeys(conf.TsigKeys)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen for test primary: %s", err)
+	}
+	primary := &testPrimary{serial: 1, address: listener.Addr().String()}
+	server := &dns.Server{Listener: listener, Handler: primary, TsigSecret: conf.TsigSecrets()}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	defer server.Shutdown()
+	time.Sleep(100 * time.Millisecond)
+
+	// answer the question with the source and return the address in the answer
+	ask := func(source Source, name string) string {
+		request := new(dns.Msg)
+		request.SetQuestion(name, dns.TypeA)
+		context := DefaultResolutionContext()
+		response, err := source.Answer(nil, context, request)
+		if err != nil || response == nil || len(response.Answer) < 1 {
+			return ""
+		}
+		if context.SourceUsed != source.Name() {
+			t.Errorf("Expected source used to be '%s' but got '%s'", source.Name(), context.SourceUsed)
+		}
+		return response.Answer[0].(*dns.A).A.String()
+	}
+
+	source := NewSource("axfr://transfer-key@" + primary.address + "/secondary.test")
+	defer source.Close()
+	if _, ok := source.(*secondarySource); !ok {
+		t.Fatalf("Expected a secondary source but got %T", source)
+	}
+	if !isLocalSource(source) {
+		t.Errorf("Expected the secondary source to be local")
+	}
+	// the first transfer happens in the background
+	for wait := 0; wait < 50 && "10.0.0.1" != ask(source, "www.secondary.test."); wait++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if answer := ask(source, "www.secondary.test."); "10.0.0.1" != answer {
+		t.Errorf("Expected answer from transferred zone but got '%s'", answer)
+	}
+
+	// a notify from another address or without the key is not accepted
+	if NotifyZone("secondary.test.", net.ParseIP("127.0.0.2"), "transfer-key.") || NotifyZone("secondary.test.", net.ParseIP("127.0.0.1"), "") {
+		t.Errorf("Expected notify to be refused")
+	}
+
+	// a notify from the primary transfers the new version
+	primary.mux.Lock()
+	primary.serial = 2
+	primary.mux.Unlock()
+	if !NotifyZone("secondary.test.", net.ParseIP("127.0.0.1"), "transfer-key.") {
+		t.Errorf("Expected notify to be accepted")
+	}
+	for wait := 0; wait < 50 && "10.0.0.2" != ask(source, "www.secondary.test."); wait++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if answer := ask(source, "www.secondary.test."); "10.0.0.2" != answer {
+		t.Errorf("Expected answer from new version of the zone after notify but got '%s'", answer)
+	}
+
+	// a source without the key can't transfer the zone
+	unsigned := NewSource("axfr://" + primary.address + "/secondary.test")
+	defer unsigned.Close()
+	time.Sleep(500 * time.Millisecond)
+	if answer := ask(unsigned, "www.secondary.test."); "" != answer {
+		t.Errorf("Expected no answer from a source that could not transfer the zone but got '%s'", answer)
+	}
+}
+
+func TestSecondaryPrimary(t *testing.T) {
+	// a primary given by host name is resolved so that a notify from it can be matched
+	named := &secondarySource{}
+	if err := named.parse("axfr://localhost:5353/secondary.test"); err != nil {
+		t.Fatalf("Could not parse secondary with a named primary: %s", err)
+	}
+	host, port, _ := net.SplitHostPort(named.primary)
+	if address := net.ParseIP(host); address == nil || !address.IsLoopback() || "5353" != port {
+		t.Errorf("Expected the primary to be resolved to a loopback address but got '%s'", named.primary)
+	}
+
+	// a primary that can't be resolved is rejected
+	if err := (&secondarySource{}).parse("axfr://primary.invalid/secondary.test"); err == nil {
+		t.Errorf("Expected a primary that can't be resolved to be rejected")
+	}
+}
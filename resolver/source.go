@@ -1,6 +1,7 @@
 package resolver
 
 import (
+	"fmt"
 	"net"
 	"os"
 	"strings"
@@ -22,6 +23,31 @@ type Source interface {
 	Close()
 }
 
+// a local source answers from data on this host and never forwards the question to another server. sources that
+// use other resolvers are local because the other resolver keeps special use domains local on its own.
+func isLocalSource(source Source) bool {
+	switch s := source.(type) {
+	case *hostFileSource, *zoneSource, *secondarySource, *leaseSource, *resolverSource:
+		return true
+	case *fileSource:
+		return isLocalSource(s.reloadableSource)
+	case *multiSource:
+		return allLocalSources(s.sources)
+	case *lbSource:
+		return allLocalSources(s.sources)
+	}
+	return false
+}
+
+func allLocalSources(sources []Source) bool {
+	for _, source := range sources {
+		if !isLocalSource(source) {
+			return false
+		}
+	}
+	return len(sources) > 0
+}
+
 func NewConfigurationSource(config *config.GudgeonSource, sourceMap map[string]Source) Source {
 	// create an array and guess at final size
 	sources := make([]Source, 0, len(config.Specs))
@@ -37,7 +63,7 @@ func NewConfigurationSource(config *config.GudgeonSource, sourceMap map[string]S
 		}
 		// source not found in map
 		if newSource == nil {
-			newSource = NewSource(spec)
+			newSource = newSourceWithOptions(spec, config.Options)
 		}
 		if newSource != nil {
 			// add source to list of sources that will be used by balancer or list
@@ -64,15 +90,33 @@ func NewConfigurationSource(config *config.GudgeonSource, sourceMap map[string]S
 }
 
 func NewSource(sourceSpecification string) Source {
+	return newSourceWithOptions(sourceSpecification, nil)
+}
+
+// the string value of a source option or "" if the option is not set
+func sourceOption(options map[string]interface{}, name string) string {
+	if value, found := options[name]; found && value != nil {
+		return strings.TrimSpace(fmt.Sprintf("%v", value))
+	}
+	return ""
+}
+
+// create a source with the options from the source configuration
+func newSourceWithOptions(sourceSpecification string, options map[string]interface{}) Source {
 	var source Source
 
-	// a source that exists as a file is a either a db(zone file), resolv.conf, or hostfile source
-	if _, err := os.Stat(sourceSpecification); !os.IsNotExist(err) {
+	// a zone transferred from a primary server
+	if isSecondarySpec(sourceSpecification) {
+		source = &secondarySource{}
+	} else if _, err := os.Stat(sourceSpecification); !os.IsNotExist(err) {
+		// a source that exists as a file is a either a db(zone file), dhcp leases, resolv.conf, or hostfile source
 		// put reloadable/file watching source in the middle
 		watcher := &fileSource{}
 		// determine type of file source
 		if glob.Glob("*.db", sourceSpecification) {
 			watcher.reloadableSource = &zoneSource{}
+		} else if glob.Glob("*.leases", sourceSpecification) {
+			watcher.reloadableSource = &leaseSource{domain: sourceOption(options, leaseDomainOption)}
 		} else if glob.Glob("*.conf", sourceSpecification) {
 			watcher.reloadableSource = &resolvSource{}
 		} else {
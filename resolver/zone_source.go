@@ -12,6 +12,8 @@ import (
 
 const (
 	zoneWildPrefix = "*."
+	// the longest chain of cnames that is followed inside of a zone
+	zoneMaxCnameChain = 8
 )
 
 type zoneSource struct {
@@ -19,12 +21,17 @@ type zoneSource struct {
 	// map[domain] -> map[class] -> map[rrtype] -> []rr
 	records   map[string]map[uint16]map[uint16][]dns.RR
 	wildnames []string
+	// the origins (owners of the soa records) of the zones in the file
+	origins []string
+	// every name in the zones, including the empty non-terminals between the origin and the names with records
+	names map[string]bool
+	// the source that the zones are registered for transfers under, the zone source itself when not set
+	owner Source
 }
 
 func (zoneSource *zoneSource) Load(zoneFile string) {
 	// set up source object
-	zoneSource.wildnames = make([]string, 0)
-	zoneSource.records = make(map[string]map[uint16]map[uint16][]dns.RR)
+	zoneSource.reset()
 
 	// get reader for zone file
 	file, err := os.Open(zoneFile)
@@ -43,38 +50,16 @@ func (zoneSource *zoneSource) Load(zoneFile string) {
 		return
 	}
 
+	// the records as they are in the file, kept for zone transfers
+	loaded := make([]dns.RR, 0)
+
 	for rr, hasNext := zp.Next(); true; {
 		if zp.Err() != nil {
 			break
 		}
 
 		if rr != nil && rr.Header() != nil {
-			name := strings.ToLower(rr.Header().Name)
-
-			// record as a name that has a wildcard prefix
-			if strings.HasPrefix(name, zoneWildPrefix) {
-				zoneSource.wildnames = append(zoneSource.wildnames, name)
-			}
-
-			// add record
-			zoneSource.addRecord(rr)
-
-			// if it's an A record we can create a PTR record too
-			if aRec, ok := rr.(*dns.A); ok && aRec.A != nil {
-				ptr := &dns.PTR{
-					Hdr: dns.RR_Header{Name: util.ReverseLookupDomain(&aRec.A), Rrtype: dns.TypePTR, Class: rr.Header().Class, Ttl: rr.Header().Ttl},
-					Ptr: name,
-				}
-				zoneSource.addRecord(ptr)
-			}
-
-			if aaaaRec, ok := rr.(*dns.AAAA); ok && aaaaRec.AAAA != nil {
-				ptr := &dns.PTR{
-					Hdr: dns.RR_Header{Name: util.ReverseLookupDomain(&aaaaRec.AAAA), Rrtype: dns.TypePTR, Class: rr.Header().Class, Ttl: rr.Header().Ttl},
-					Ptr: name,
-				}
-				zoneSource.addRecord(ptr)
-			}
+			loaded = append(loaded, rr)
 		}
 
 		// break if no next element
@@ -90,6 +75,104 @@ func (zoneSource *zoneSource) Load(zoneFile string) {
 	// get error from last parsed line
 	//err = zp.Err()
 	// todo: maybe report on this?
+
+	// apply the dynamic updates that were made to the zone
+	loaded = replayJournal(journalPath(zoneFile), loaded)
+
+	zoneSource.loadRecords(loaded)
+}
+
+func (zoneSource *zoneSource) reset() {
+	zoneSource.wildnames = make([]string, 0)
+	zoneSource.records = make(map[string]map[uint16]map[uint16][]dns.RR)
+	zoneSource.origins = make([]string, 0)
+	zoneSource.names = make(map[string]bool)
+}
+
+// answer from the given records, either read from a zone file or transferred from a primary server
+func (zoneSource *zoneSource) loadRecords(loaded []dns.RR) {
+	for _, rr := range loaded {
+		zoneSource.addZoneRecord(rr)
+	}
+	zoneSource.indexNames()
+	zoneSource.registerZones(loaded)
+}
+
+func (zoneSource *zoneSource) registrant() Source {
+	if zoneSource.owner != nil {
+		return zoneSource.owner
+	}
+	return zoneSource
+}
+
+// keep the records of each zone in the file so that the zones can be transferred to secondary servers, zones that
+// are no longer in the file are not transferred anymore
+func (zoneSource *zoneSource) registerZones(loaded []dns.RR) {
+	unregisterZones(zoneSource.registrant(), zoneSource.origins)
+	for _, origin := range zoneSource.origins {
+		// the soa record is first
+		records := make([]dns.RR, 1, len(loaded))
+		for _, rr := range loaded {
+			if _, ok := rr.(*dns.SOA); ok && strings.ToLower(rr.Header().Name) == origin {
+				if records[0] == nil {
+					records[0] = rr
+				}
+			} else if zoneSource.origin(strings.ToLower(rr.Header().Name)) == origin {
+				records = append(records, rr)
+			}
+		}
+		registerZone(zoneSource.registrant(), origin, records)
+	}
+}
+
+// add a record from the zone, the soa records set the origins and address records get a matching ptr record
+func (zoneSource *zoneSource) addZoneRecord(rr dns.RR) {
+	name := strings.ToLower(rr.Header().Name)
+
+	if soa, ok := rr.(*dns.SOA); ok && soa != nil && !util.StringIn(name, zoneSource.origins) {
+		zoneSource.origins = append(zoneSource.origins, name)
+	}
+
+	// record as a name that has a wildcard prefix
+	if strings.HasPrefix(name, zoneWildPrefix) {
+		zoneSource.wildnames = append(zoneSource.wildnames, name)
+	}
+
+	// add record
+	zoneSource.addRecord(rr)
+
+	// if it's an A record we can create a PTR record too
+	if aRec, ok := rr.(*dns.A); ok && aRec.A != nil {
+		ptr := &dns.PTR{
+			Hdr: dns.RR_Header{Name: util.ReverseLookupDomain(&aRec.A), Rrtype: dns.TypePTR, Class: rr.Header().Class, Ttl: rr.Header().Ttl},
+			Ptr: name,
+		}
+		zoneSource.addRecord(ptr)
+	}
+
+	if aaaaRec, ok := rr.(*dns.AAAA); ok && aaaaRec.AAAA != nil {
+		ptr := &dns.PTR{
+			Hdr: dns.RR_Header{Name: util.ReverseLookupDomain(&aaaaRec.AAAA), Rrtype: dns.TypePTR, Class: rr.Header().Class, Ttl: rr.Header().Ttl},
+			Ptr: name,
+		}
+		zoneSource.addRecord(ptr)
+	}
+}
+
+// record every name in the zones along with the names between it and the origin of its zone
+func (zoneSource *zoneSource) indexNames() {
+	for name := range zoneSource.records {
+		origin := zoneSource.origin(name)
+		if "" == origin {
+			continue
+		}
+		for current := name; ; current = parentName(current) {
+			zoneSource.names[current] = true
+			if current == origin || "" == current {
+				break
+			}
+		}
+	}
 }
 
 func (zoneSource *zoneSource) addRecord(rr dns.RR) {
@@ -115,37 +198,222 @@ func (zoneSource *zoneSource) Name() string {
 	return "zonefile:" + zoneSource.filePath
 }
 
-func (zoneSource *zoneSource) resolveName(name string, qClass uint16, qType uint16, intoResponse *dns.Msg) {
-	if domainRecords, found := zoneSource.records[name]; found {
-		classResponses := make([]map[uint16][]dns.RR, 0)
-		if qClass == dns.ClassANY {
-			for _, value := range domainRecords {
-				classResponses = append(classResponses, value)
+// the name with the first label removed, "" for the root
+func parentName(name string) string {
+	if "." == name || "" == name {
+		return ""
+	}
+	if idx := strings.Index(name, "."); idx >= 0 && idx < len(name)-1 {
+		return name[idx+1:]
+	}
+	return "."
+}
+
+// if the name is the domain or a name under it
+func inDomain(name string, domain string) bool {
+	return name == domain || "." == domain || strings.HasSuffix(name, "."+domain)
+}
+
+// the origin of the most specific zone that contains the name or "" if no zone in the file contains it
+func (zoneSource *zoneSource) origin(name string) string {
+	found := ""
+	for _, origin := range zoneSource.origins {
+		if inDomain(name, origin) && len(origin) > len(found) {
+			found = origin
+		}
+	}
+	return found
+}
+
+// copies of the records with the name, class, and type. the owner of the copies is changed to the given owner
+// when the records are synthesized from a wildcard.
+func (zoneSource *zoneSource) find(name string, owner string, qClass uint16, qType uint16) []dns.RR {
+	domainRecords, found := zoneSource.records[name]
+	if !found {
+		return nil
+	}
+
+	classResponses := make([]map[uint16][]dns.RR, 0)
+	if qClass == dns.ClassANY {
+		for _, value := range domainRecords {
+			classResponses = append(classResponses, value)
+		}
+	} else {
+		classResponses = append(classResponses, domainRecords[qClass])
+	}
+
+	rrs := make([]dns.RR, 0)
+	for _, cr := range classResponses {
+		if qType == dns.TypeANY {
+			for _, v := range cr {
+				rrs = append(rrs, v...)
 			}
 		} else {
-			classResponses = append(classResponses, domainRecords[qClass])
+			rrs = append(rrs, cr[qType]...)
 		}
+	}
 
-		rrs := make([]dns.RR, 0)
-		for _, cr := range classResponses {
-			if qType == dns.TypeANY {
-				for _, v := range cr {
-					rrs = append(rrs, v...)
+	copies := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		rrCopy := dns.Copy(rr)
+		if "" != owner {
+			rrCopy.Header().Name = owner
+		}
+		copies = append(copies, rrCopy)
+	}
+	return copies
+}
+
+// the soa record of the zone for the authority section of a negative answer. the ttl is the lower of the ttl of
+// the record and the minimum ttl of the zone (rfc 2308).
+func (zoneSource *zoneSource) negativeSOA(origin string, qClass uint16) []dns.RR {
+	if qClass == dns.ClassANY {
+		qClass = dns.ClassINET
+	}
+	rrs := zoneSource.find(origin, "", qClass, dns.TypeSOA)
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok && soa.Minttl < soa.Hdr.Ttl {
+			soa.Hdr.Ttl = soa.Minttl
+		}
+	}
+	return rrs
+}
+
+// the name of the zone cut (the closest delegation to the origin) at or above the name and the ns records there
+func (zoneSource *zoneSource) delegation(origin string, name string, qClass uint16) (string, []dns.RR) {
+	ancestors := make([]string, 0)
+	for current := name; current != origin && "" != current; current = parentName(current) {
+		ancestors = append(ancestors, current)
+	}
+	for idx := len(ancestors) - 1; idx >= 0; idx-- {
+		if ns := zoneSource.find(ancestors[idx], "", qClass, dns.TypeNS); len(ns) > 0 {
+			return ancestors[idx], ns
+		}
+	}
+	return "", nil
+}
+
+// the name that the records for the name are read from. this is the name itself if it is in the zone, otherwise
+// the wildcard at the closest encloser (rfc 4592), or "" if the name does not exist.
+func (zoneSource *zoneSource) source(origin string, name string) string {
+	if zoneSource.names[name] {
+		return name
+	}
+	for encloser := parentName(name); "" != encloser && inDomain(encloser, origin); encloser = parentName(encloser) {
+		if zoneSource.names[encloser] {
+			if wild := zoneWildPrefix + encloser; zoneSource.names[wild] {
+				return wild
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// the addresses in the zone for the names that the records point to (glue for ns records and additional data
+// for mx and srv records)
+func (zoneSource *zoneSource) additional(rrs []dns.RR, qClass uint16) []dns.RR {
+	extra := make([]dns.RR, 0)
+	for _, rr := range rrs {
+		target := ""
+		switch record := rr.(type) {
+		case *dns.NS:
+			target = record.Ns
+		case *dns.MX:
+			target = record.Mx
+		case *dns.SRV:
+			target = record.Target
+		}
+		target = strings.ToLower(target)
+		if "" == target || "" == zoneSource.origin(target) {
+			continue
+		}
+		extra = append(extra, zoneSource.find(target, "", qClass, dns.TypeA)...)
+		extra = append(extra, zoneSource.find(target, "", qClass, dns.TypeAAAA)...)
+	}
+	return extra
+}
+
+// answer the question as the authority for the zone with the given origin (rfc 1034 section 4.3.2)
+func (zoneSource *zoneSource) answerAuthoritative(origin string, name string, qClass uint16, qType uint16, response *dns.Msg) {
+	response.Authoritative = true
+
+	for chain := 0; chain < zoneMaxCnameChain; chain++ {
+		// names at or below a zone cut are answered with a referral to the delegated servers
+		if cut, ns := zoneSource.delegation(origin, name, qClass); "" != cut && !(cut == name && qType == dns.TypeDS) {
+			if len(response.Answer) < 1 {
+				response.Authoritative = false
+			}
+			response.Ns = append(response.Ns, ns...)
+			response.Extra = append(response.Extra, zoneSource.additional(ns, qClass)...)
+			return
+		}
+
+		source := zoneSource.source(origin, name)
+		if "" == source {
+			// a name that a cname points to is answered with the cname even if the name does not exist
+			if len(response.Answer) < 1 {
+				response.Rcode = dns.RcodeNameError
+			}
+			response.Ns = append(response.Ns, zoneSource.negativeSOA(origin, qClass)...)
+			return
+		}
+
+		// records synthesized from a wildcard are owned by the name in the question
+		owner := ""
+		if source != name {
+			owner = name
+		}
+
+		// follow cnames to the records of the type in the question
+		if qType != dns.TypeCNAME && qType != dns.TypeANY {
+			if cnames := zoneSource.find(source, owner, qClass, dns.TypeCNAME); len(cnames) > 0 {
+				response.Answer = append(response.Answer, cnames...)
+				target := strings.ToLower(cnames[0].(*dns.CNAME).Target)
+				// targets outside of the zone are left to the resolver
+				if !inDomain(target, origin) || zoneSource.origin(target) != origin {
+					return
 				}
-			} else {
-				rrs = append(rrs, cr[qType]...)
+				name = target
+				continue
 			}
 		}
 
-		// append responses if responses were made
-		if len(rrs) > 0 {
-			intoResponse.Answer = append(intoResponse.Answer, rrs...)
+		rrs := zoneSource.find(source, owner, qClass, qType)
+		if len(rrs) < 1 {
+			// the name exists but has no records of the type
+			response.Ns = append(response.Ns, zoneSource.negativeSOA(origin, qClass)...)
+			return
+		}
+		response.Answer = append(response.Answer, rrs...)
+		response.Extra = append(response.Extra, zoneSource.additional(rrs, qClass)...)
+		return
+	}
+}
+
+// answer with the records for the name, or the first wildcard that matches the name, without an authority
+func (zoneSource *zoneSource) answerRecords(name string, qClass uint16, qType uint16, response *dns.Msg) {
+	// resolve CNAMES first
+	if qType == dns.TypeA || qType == dns.TypeAAAA {
+		response.Answer = append(response.Answer, zoneSource.find(name, "", qClass, dns.TypeCNAME)...)
+	}
+	response.Answer = append(response.Answer, zoneSource.find(name, "", qClass, qType)...)
+	if len(response.Answer) < 1 {
+		// check wildcards
+		for _, wild := range zoneSource.wildnames {
+			// if a wildcard matches, break and leave
+			if glob.Glob(wild, name) {
+				response.Answer = append(response.Answer, zoneSource.find(wild, name, qClass, qType)...)
+				if len(response.Answer) > 0 {
+					break
+				}
+			}
 		}
 	}
 }
 
 func (zoneSource *zoneSource) Answer(rCon *RequestContext, context *ResolutionContext, request *dns.Msg) (*dns.Msg, error) {
-	if request == nil {
+	if request == nil || len(request.Question) < 1 {
 		return nil, nil
 	}
 
@@ -165,41 +433,27 @@ func (zoneSource *zoneSource) Answer(rCon *RequestContext, context *ResolutionCo
 	}
 	response.SetReply(request)
 
-	// resolve CNAMES first
-	if qType == dns.TypeA || qType == dns.TypeAAAA {
-		zoneSource.resolveName(name, qClass, dns.TypeCNAME, response)
-	}
-	zoneSource.resolveName(name, qClass, qType, response)
-	if len(response.Answer) < 1 {
-		// check wildcards
-		for _, wild := range zoneSource.wildnames {
-			// if a wildcard matches, break and leave
-			if glob.Glob(wild, name) {
-				zoneSource.resolveName(wild, qClass, qType, response)
-				if len(response.Answer) > 0 {
-					break
-				}
-			}
-		}
-	}
-
-	// normalize names to question name
-	for _, rr := range response.Answer {
-		rr.Header().Name = name
+	if origin := zoneSource.origin(name); "" != origin {
+		zoneSource.answerAuthoritative(origin, name, qClass, qType, response)
+	} else {
+		// names outside of the zones (like the ptr records made for addresses or the names in a file with no soa
+		// record) are only answered if they exist
+		zoneSource.answerRecords(name, qClass, qType, response)
 	}
 
 	// if not nil or empty update the context
-	if context != nil && !util.IsEmptyResponse(response) {
+	if context != nil && (!util.IsEmptyResponse(response) || util.IsAuthoritativeNegative(response)) {
 		// don't cache responses
 		context.Stored = true
 
 		// update source used
 		context.SourceUsed = zoneSource.Name()
+		context.Local = true
 	}
 
 	return response, nil
 }
 
 func (zoneSource *zoneSource) Close() {
-
+	unregisterZones(zoneSource.registrant(), nil)
 }
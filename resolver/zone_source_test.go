@@ -11,6 +11,7 @@ import (
 func TestLoadZoneFile(t *testing.T) {
 	zoneSource := &zoneSource{}
 	zoneSource.Load("./testdata/zone-test.db")
+	zoneSource.Close()
 }
 
 func TestZoneSource(t *testing.T) {
@@ -46,6 +47,7 @@ func TestZoneSource(t *testing.T) {
 
 	zone := &zoneSource{}
 	zone.Load("./testdata/zone-test.db")
+	defer zone.Close()
 
 	for _, d := range data {
 		// create question
@@ -83,3 +85,81 @@ func TestZoneSource(t *testing.T) {
 	}
 
 }
+
+func TestZoneSourceAuthority(t *testing.T) {
+	data := []struct {
+		name          string
+		qtype         uint16
+		rcode         int
+		authoritative bool
+		answers       int
+		authority     uint16
+		extra         int
+		owner         string
+	}{
+		// answers from the zone
+		{"www.example.lan.", dns.TypeA, dns.RcodeSuccess, true, 1, 0, 0, "www.example.lan."},
+		{"example.lan.", dns.TypeNS, dns.RcodeSuccess, true, 1, 0, 1, "example.lan."},
+		// nxdomain and nodata have the soa in the authority section
+		{"missing.example.lan.", dns.TypeA, dns.RcodeNameError, true, 0, dns.TypeSOA, 0, ""},
+		{"www.example.lan.", dns.TypeAAAA, dns.RcodeSuccess, true, 0, dns.TypeSOA, 0, ""},
+		// empty non-terminals exist
+		{"branch.example.lan.", dns.TypeA, dns.RcodeSuccess, true, 0, dns.TypeSOA, 0, ""},
+		// cnames in the zone are followed
+		{"alias.example.lan.", dns.TypeA, dns.RcodeSuccess, true, 3, 0, 0, "alias.example.lan."},
+		{"alias.example.lan.", dns.TypeCNAME, dns.RcodeSuccess, true, 1, 0, 0, "alias.example.lan."},
+		{"outside.example.lan.", dns.TypeA, dns.RcodeSuccess, true, 1, 0, 0, "outside.example.lan."},
+		// wildcards are synthesized with the name in the question
+		{"web.apps.example.lan.", dns.TypeA, dns.RcodeSuccess, true, 1, 0, 0, "web.apps.example.lan."},
+		{"web.apps.example.lan.", dns.TypeAAAA, dns.RcodeSuccess, true, 0, dns.TypeSOA, 0, ""},
+		{"named.apps.example.lan.", dns.TypeA, dns.RcodeSuccess, true, 0, dns.TypeSOA, 0, ""},
+		{"deep.named.apps.example.lan.", dns.TypeA, dns.RcodeNameError, true, 0, dns.TypeSOA, 0, ""},
+		// delegations are referrals with glue
+		{"lab.example.lan.", dns.TypeA, dns.RcodeSuccess, false, 0, dns.TypeNS, 1, ""},
+		{"host.lab.example.lan.", dns.TypeA, dns.RcodeSuccess, false, 0, dns.TypeNS, 1, ""},
+		{"lab.example.lan.", dns.TypeDS, dns.RcodeSuccess, true, 1, 0, 0, "lab.example.lan."},
+	}
+
+	zone := &zoneSource{}
+	zone.Load("./testdata/zone-authority.db")
+	defer zone.Close()
+
+	for _, d := range data {
+		request := &dns.Msg{
+			Question: []dns.Question{
+				{Name: d.name, Qtype: d.qtype, Qclass: dns.ClassINET},
+			},
+		}
+
+		context := &ResolutionContext{}
+		response, err := zone.Answer(nil, context, request)
+		if err != nil || response == nil {
+			t.Errorf("Error asking question '%s': %s", d.name, err)
+			continue
+		}
+
+		if response.Rcode != d.rcode {
+			t.Errorf("Query '%s' (%s) expected rcode %s but got %s", d.name, dns.Type(d.qtype).String(), dns.RcodeToString[d.rcode], dns.RcodeToString[response.Rcode])
+		}
+		if response.Authoritative != d.authoritative {
+			t.Errorf("Query '%s' (%s) expected authoritative to be %t", d.name, dns.Type(d.qtype).String(), d.authoritative)
+		}
+		if len(response.Answer) != d.answers {
+			t.Errorf("Query '%s' (%s) expected %d answers but got %d", d.name, dns.Type(d.qtype).String(), d.answers, len(response.Answer))
+		} else if d.answers > 0 && response.Answer[0].Header().Name != d.owner {
+			t.Errorf("Query '%s' (%s) expected answer owned by '%s' but got '%s'", d.name, dns.Type(d.qtype).String(), d.owner, response.Answer[0].Header().Name)
+		}
+		if d.authority != 0 && (len(response.Ns) < 1 || response.Ns[0].Header().Rrtype != d.authority) {
+			t.Errorf("Query '%s' (%s) expected %s record in authority section", d.name, dns.Type(d.qtype).String(), dns.Type(d.authority).String())
+		}
+		if len(response.Extra) != d.extra {
+			t.Errorf("Query '%s' (%s) expected %d additional records but got %d", d.name, dns.Type(d.qtype).String(), d.extra, len(response.Extra))
+		}
+		if d.authority == dns.TypeSOA && len(response.Ns) > 0 && response.Ns[0].Header().Ttl != 300 {
+			t.Errorf("Query '%s' (%s) expected negative soa ttl of 300 but got %d", d.name, dns.Type(d.qtype).String(), response.Ns[0].Header().Ttl)
+		}
+		if context.SourceUsed == "" {
+			t.Errorf("Query '%s' (%s) should be answered by the zone", d.name, dns.Type(d.qtype).String())
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package resolver
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/events"
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+const (
+	// the number of earlier versions of each zone that are kept to answer incremental transfers
+	zoneHistoryDepth = 16
+)
+
+// a version of a zone, the records start with the soa record and don't include the ptr records made for addresses
+type zoneVersion struct {
+	serial  uint32
+	records []dns.RR
+}
+
+// the versions of the zones that have been loaded from zone files or transferred from a primary, by origin, and the
+// sources that loaded each zone. a zone is kept while any source that loaded it is open.
+var zoneVersions = struct {
+	mux      sync.RWMutex
+	versions map[string][]*zoneVersion
+	owners   map[string]map[Source]bool
+}{
+	versions: make(map[string][]*zoneVersion),
+	owners:   make(map[string]map[Source]bool),
+}
+
+// compare serial numbers with sequence space arithmetic (rfc 1982), true when serial a comes before serial b
+func serialBefore(a uint32, b uint32) bool {
+	return a != b && int32(b-a) > 0
+}
+
+// keep the records of a zone loaded by the source so that it can be transferred. when the zone changes a
+// "zone:change" event is sent so that the secondary servers can be notified.
+func registerZone(owner Source, origin string, records []dns.RR) {
+	if len(records) < 1 {
+		return
+	}
+	soa, ok := records[0].(*dns.SOA)
+	if !ok {
+		return
+	}
+
+	zoneVersions.mux.Lock()
+	if zoneVersions.owners[origin] == nil {
+		zoneVersions.owners[origin] = make(map[Source]bool)
+	}
+	zoneVersions.owners[origin][owner] = true
+	versions := zoneVersions.versions[origin]
+	changed := len(versions) > 0 && versions[len(versions)-1].serial != soa.Serial
+	if len(versions) > 0 && versions[len(versions)-1].serial == soa.Serial {
+		// the same version is replaced
+		versions = versions[:len(versions)-1]
+	}
+	versions = append(versions, &zoneVersion{serial: soa.Serial, records: records})
+	if len(versions) > zoneHistoryDepth {
+		versions = versions[len(versions)-zoneHistoryDepth:]
+	}
+	zoneVersions.versions[origin] = versions
+	zoneVersions.mux.Unlock()
+
+	if changed {
+		events.Send("zone:change", &events.Message{"zone": origin, "serial": soa.Serial})
+	}
+}
+
+// forget the zones loaded by the source, except for the origins that are kept. a zone is no longer transferred once
+// no open source has it.
+func unregisterZones(owner Source, keep []string) {
+	zoneVersions.mux.Lock()
+	defer zoneVersions.mux.Unlock()
+	for origin, owners := range zoneVersions.owners {
+		if !owners[owner] || util.StringIn(origin, keep) {
+			continue
+		}
+		delete(owners, owner)
+		if len(owners) < 1 {
+			delete(zoneVersions.owners, origin)
+			delete(zoneVersions.versions, origin)
+		}
+	}
+}
+
+// the current soa record for the zone or nil if no zone file has the zone
+func ZoneSOA(origin string) *dns.SOA {
+	zoneVersions.mux.RLock()
+	defer zoneVersions.mux.RUnlock()
+	versions := zoneVersions.versions[strings.ToLower(origin)]
+	if len(versions) < 1 {
+		return nil
+	}
+	return dns.Copy(versions[len(versions)-1].records[0]).(*dns.SOA)
+}
+
+// the records that answer an AXFR or IXFR request for a zone loaded from a zone file. an AXFR is the whole zone
+// between two copies of the soa record. an IXFR (rfc 1995) is the difference between the version of the zone with
+// the serial in the request and the current version, or the whole zone if that version is no longer known. false
+// is returned when no zone file has the zone.
+func ZoneTransfer(request *dns.Msg) ([]dns.RR, bool) {
+	if request == nil || len(request.Question) < 1 {
+		return nil, false
+	}
+	question := request.Question[0]
+	origin := strings.ToLower(question.Name)
+
+	zoneVersions.mux.RLock()
+	versions := zoneVersions.versions[origin]
+	zoneVersions.mux.RUnlock()
+	if len(versions) < 1 {
+		return nil, false
+	}
+	current := versions[len(versions)-1]
+
+	if question.Qtype == dns.TypeIXFR {
+		// the serial that the secondary has is in the authority section of the request
+		for _, rr := range request.Ns {
+			soa, ok := rr.(*dns.SOA)
+			if !ok {
+				continue
+			}
+			// the secondary is up to date
+			if !serialBefore(soa.Serial, current.serial) {
+				return []dns.RR{dns.Copy(current.records[0])}, true
+			}
+			for _, version := range versions {
+				if version.serial == soa.Serial {
+					return incrementalTransfer(version, current), true
+				}
+			}
+			break
+		}
+	}
+
+	// the full zone
+	records := make([]dns.RR, 0, len(current.records)+1)
+	for _, rr := range current.records {
+		records = append(records, dns.Copy(rr))
+	}
+	return append(records, dns.Copy(current.records[0])), true
+}
+
+// the condensed difference between two versions of a zone: the new soa, the old soa and the deleted records, the
+// new soa and the added records, and the new soa again
+func incrementalTransfer(from *zoneVersion, to *zoneVersion) []dns.RR {
+	existing := make(map[string]bool, len(from.records))
+	for _, rr := range from.records[1:] {
+		existing[rr.String()] = true
+	}
+	kept := make(map[string]bool, len(to.records))
+	for _, rr := range to.records[1:] {
+		kept[rr.String()] = true
+	}
+
+	records := []dns.RR{dns.Copy(to.records[0]), dns.Copy(from.records[0])}
+	for _, rr := range from.records[1:] {
+		if !kept[rr.String()] {
+			records = append(records, dns.Copy(rr))
+		}
+	}
+	records = append(records, dns.Copy(to.records[0]))
+	for _, rr := range to.records[1:] {
+		if !existing[rr.String()] {
+			records = append(records, dns.Copy(rr))
+		}
+	}
+	return append(records, dns.Copy(to.records[0]))
+}
@@ -0,0 +1,96 @@
+package resolver
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func zoneRecords(t *testing.T, lines ...string) []dns.RR {
+	records := make([]dns.RR, 0, len(lines))
+	for _, line := range lines {
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			t.Fatalf("Could not parse record '%s': %s", line, err)
+		}
+		records = append(records, rr)
+	}
+	return records
+}
+
+func TestZoneTransfer(t *testing.T) {
+	owner := &zoneSource{}
+	defer unregisterZones(owner, nil)
+
+	registerZone(owner, "transfer.test.", zoneRecords(t,
+		"transfer.test. 3600 IN SOA ns.transfer.test. admin.transfer.test. 1 900 600 86400 300",
+		"www.transfer.test. 3600 IN A 10.0.0.1",
+		"mail.transfer.test. 3600 IN A 10.0.0.2",
+	))
+	registerZone(owner, "transfer.test.", zoneRecords(t,
+		"transfer.test. 3600 IN SOA ns.transfer.test. admin.transfer.test. 2 900 600 86400 300",
+		"www.transfer.test. 3600 IN A 10.0.0.1",
+		"mail.transfer.test. 3600 IN A 10.0.0.3",
+		"ftp.transfer.test. 3600 IN A 10.0.0.4",
+	))
+
+	data := []struct {
+		qtype    uint16
+		serial   uint32
+		expected []string
+	}{
+		{dns.TypeAXFR, 0, []string{"SOA 2", "A www", "A mail", "A ftp", "SOA 2"}},
+		{dns.TypeIXFR, 2, []string{"SOA 2"}},
+		{dns.TypeIXFR, 1, []string{"SOA 2", "SOA 1", "A mail", "SOA 2", "A mail", "A ftp", "SOA 2"}},
+		{dns.TypeIXFR, 4294967295, []string{"SOA 2", "A www", "A mail", "A ftp", "SOA 2"}},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		if d.qtype == dns.TypeIXFR {
+			request.SetIxfr("transfer.test.", d.serial, "ns.transfer.test.", "admin.transfer.test.")
+		} else {
+			request.SetAxfr("transfer.test.")
+		}
+
+		records, found := ZoneTransfer(request)
+		if !found {
+			t.Errorf("Expected zone to be found for %s", dns.Type(d.qtype).String())
+			continue
+		}
+
+		// describe each record by type and serial or label
+		described := make([]string, 0, len(records))
+		for _, rr := range records {
+			if soa, ok := rr.(*dns.SOA); ok {
+				described = append(described, fmt.Sprintf("SOA %d", soa.Serial))
+			} else {
+				described = append(described, dns.Type(rr.Header().Rrtype).String()+" "+dns.SplitDomainName(rr.Header().Name)[0])
+			}
+		}
+
+		if len(described) != len(d.expected) {
+			t.Errorf("Expected %v from %s (serial %d) but got %v", d.expected, dns.Type(d.qtype).String(), d.serial, described)
+			continue
+		}
+		for idx := range described {
+			if described[idx] != d.expected[idx] {
+				t.Errorf("Expected %v from %s (serial %d) but got %v", d.expected, dns.Type(d.qtype).String(), d.serial, described)
+				break
+			}
+		}
+	}
+
+	if _, found := ZoneTransfer(&dns.Msg{Question: []dns.Question{{Name: "missing.test.", Qtype: dns.TypeAXFR, Qclass: dns.ClassINET}}}); found {
+		t.Errorf("Expected no transfer for a zone that was not loaded")
+	}
+
+	// once the owner lets go of the zone it is no longer transferable
+	unregisterZones(owner, nil)
+	request := new(dns.Msg)
+	request.SetAxfr("transfer.test.")
+	if _, found := ZoneTransfer(request); found {
+		t.Errorf("Expected no transfer for a zone after its owner was closed")
+	}
+}
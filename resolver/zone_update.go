@@ -0,0 +1,406 @@
+package resolver
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// the journal of the updates to a zone file is kept next to the zone file
+	journalSuffix = ".jnl"
+)
+
+// the zone file sources with each zone, by origin, so that updates can reload them
+var zoneFiles = struct {
+	mux     sync.RWMutex
+	sources map[string][]*fileSource
+	// updates are applied one at a time
+	updateMux sync.Mutex
+}{
+	sources: make(map[string][]*fileSource),
+}
+
+func journalPath(zoneFile string) string {
+	return zoneFile + journalSuffix
+}
+
+// keep the file source for each zone in the zone file it loaded
+func registerZoneFile(source *fileSource, origins []string) {
+	zoneFiles.mux.Lock()
+	defer zoneFiles.mux.Unlock()
+	for _, origin := range origins {
+		found := false
+		for _, existing := range zoneFiles.sources[origin] {
+			found = found || existing == source
+		}
+		if !found {
+			zoneFiles.sources[origin] = append(zoneFiles.sources[origin], source)
+		}
+	}
+}
+
+func unregisterZoneFile(source *fileSource) {
+	zoneFiles.mux.Lock()
+	defer zoneFiles.mux.Unlock()
+	for origin, sources := range zoneFiles.sources {
+		kept := make([]*fileSource, 0, len(sources))
+		for _, existing := range sources {
+			if existing != source {
+				kept = append(kept, existing)
+			}
+		}
+		zoneFiles.sources[origin] = kept
+	}
+}
+
+// the update records in the journal of a zone file, in the order they were applied
+func readJournal(path string) []dns.RR {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	records := make([]dns.RR, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if "" == line || strings.HasPrefix(line, ";") {
+			continue
+		}
+		rr, err := dns.NewRR(line)
+		if err != nil || rr == nil {
+			log.Warnf("Skipping line in journal '%s': %s", path, line)
+			continue
+		}
+		records = append(records, rr)
+	}
+	return records
+}
+
+// apply the updates in the journal to the records loaded from the zone file
+func replayJournal(path string, loaded []dns.RR) []dns.RR {
+	updates := readJournal(path)
+	if len(updates) < 1 {
+		return loaded
+	}
+	origins := make([]string, 0)
+	for _, rr := range loaded {
+		if _, ok := rr.(*dns.SOA); ok {
+			origins = append(origins, strings.ToLower(rr.Header().Name))
+		}
+	}
+	for _, rr := range updates {
+		// the zone of the record is the most specific origin that contains it
+		zone := ""
+		for _, origin := range origins {
+			if inDomain(strings.ToLower(rr.Header().Name), origin) && len(origin) > len(zone) {
+				zone = origin
+			}
+		}
+		if "" != zone {
+			loaded = applyUpdate(zone, loaded, rr)
+		}
+	}
+	return loaded
+}
+
+// if the records have the same owner, type, and data
+func sameRecord(a dns.RR, b dns.RR) bool {
+	if _, ok := a.(*dns.RR_Header); ok {
+		return false
+	}
+	if _, ok := b.(*dns.RR_Header); ok {
+		return false
+	}
+	a, b = dns.Copy(a), dns.Copy(b)
+	a.Header().Class, b.Header().Class = dns.ClassINET, dns.ClassINET
+	a.Header().Name, b.Header().Name = strings.ToLower(a.Header().Name), strings.ToLower(b.Header().Name)
+	return dns.IsDuplicate(a, b)
+}
+
+// apply a single record from the update section of an update (rfc 2136 section 3.4.2) to the records of the zone
+func applyUpdate(zone string, records []dns.RR, rr dns.RR) []dns.RR {
+	header := rr.Header()
+	name := strings.ToLower(header.Name)
+	apex := name == zone
+
+	switch header.Class {
+	case dns.ClassANY:
+		// delete an rrset or all of the rrsets of a name, the soa and ns records of the zone are never deleted
+		kept := make([]dns.RR, 0, len(records))
+		for _, existing := range records {
+			eHeader := existing.Header()
+			if strings.ToLower(eHeader.Name) != name || (header.Rrtype != dns.TypeANY && header.Rrtype != eHeader.Rrtype) || (apex && (eHeader.Rrtype == dns.TypeSOA || eHeader.Rrtype == dns.TypeNS)) {
+				kept = append(kept, existing)
+			}
+		}
+		return kept
+	case dns.ClassNONE:
+		// delete a record, the soa record and the last ns record of the zone are never deleted
+		if header.Rrtype == dns.TypeSOA {
+			return records
+		}
+		nameServers := 0
+		for _, existing := range records {
+			if apex && existing.Header().Rrtype == dns.TypeNS && strings.ToLower(existing.Header().Name) == name {
+				nameServers++
+			}
+		}
+		kept := make([]dns.RR, 0, len(records))
+		for _, existing := range records {
+			if sameRecord(existing, rr) && !(apex && header.Rrtype == dns.TypeNS && nameServers < 2) {
+				continue
+			}
+			kept = append(kept, existing)
+		}
+		return kept
+	}
+
+	// add a record
+	added := dns.Copy(rr)
+	if header.Rrtype == dns.TypeSOA {
+		// the soa record is only replaced by a newer one
+		if !apex {
+			return records
+		}
+		for idx, existing := range records {
+			if soa, ok := existing.(*dns.SOA); ok && strings.ToLower(soa.Hdr.Name) == name {
+				if serialBefore(soa.Serial, added.(*dns.SOA).Serial) {
+					records[idx] = added
+				}
+				break
+			}
+		}
+		return records
+	}
+
+	// a cname can't be added to a name with other records and other records can't be added to a cname
+	hasCname, hasOther := false, false
+	for _, existing := range records {
+		if strings.ToLower(existing.Header().Name) == name {
+			hasCname = hasCname || existing.Header().Rrtype == dns.TypeCNAME
+			hasOther = hasOther || existing.Header().Rrtype != dns.TypeCNAME
+		}
+	}
+	if (header.Rrtype == dns.TypeCNAME && hasOther) || (header.Rrtype != dns.TypeCNAME && hasCname) {
+		return records
+	}
+
+	for idx, existing := range records {
+		// a duplicate (or the cname of the name) is replaced
+		if sameRecord(existing, added) || (header.Rrtype == dns.TypeCNAME && existing.Header().Rrtype == dns.TypeCNAME && strings.ToLower(existing.Header().Name) == name) {
+			records[idx] = added
+			return records
+		}
+	}
+	return append(records, added)
+}
+
+// if the name has records
+func nameInUse(records []dns.RR, name string) bool {
+	for _, existing := range records {
+		if strings.ToLower(existing.Header().Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// the records of the name with the type
+func rrset(records []dns.RR, name string, rrType uint16) []dns.RR {
+	set := make([]dns.RR, 0)
+	for _, existing := range records {
+		if strings.ToLower(existing.Header().Name) == name && existing.Header().Rrtype == rrType {
+			set = append(set, existing)
+		}
+	}
+	return set
+}
+
+// check the prerequisite section of an update (rfc 2136 section 3.2)
+func checkPrerequisites(zone string, records []dns.RR, prerequisites []dns.RR) int {
+	// rrsets that must exist with exactly the given records
+	exact := make(map[string][]dns.RR)
+	for _, rr := range prerequisites {
+		header := rr.Header()
+		name := strings.ToLower(header.Name)
+		if header.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !inDomain(name, zone) {
+			return dns.RcodeNotZone
+		}
+		switch header.Class {
+		case dns.ClassANY:
+			if header.Rrtype == dns.TypeANY && !nameInUse(records, name) {
+				return dns.RcodeNameError
+			} else if header.Rrtype != dns.TypeANY && len(rrset(records, name, header.Rrtype)) < 1 {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if header.Rrtype == dns.TypeANY && nameInUse(records, name) {
+				return dns.RcodeYXDomain
+			} else if header.Rrtype != dns.TypeANY && len(rrset(records, name, header.Rrtype)) > 0 {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			key := fmt.Sprintf("%s/%d", name, header.Rrtype)
+			exact[key] = append(exact[key], rr)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+
+	for _, expected := range exact {
+		existing := rrset(records, strings.ToLower(expected[0].Header().Name), expected[0].Header().Rrtype)
+		if !sameRecords(existing, expected) {
+			return dns.RcodeNXRrset
+		}
+	}
+
+	return dns.RcodeSuccess
+}
+
+// if every record in each list is in the other list
+func sameRecords(a []dns.RR, b []dns.RR) bool {
+	contains := func(list []dns.RR, rr dns.RR) bool {
+		for _, item := range list {
+			if sameRecord(item, rr) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rr := range a {
+		if !contains(b, rr) {
+			return false
+		}
+	}
+	for _, rr := range b {
+		if !contains(a, rr) {
+			return false
+		}
+	}
+	return true
+}
+
+// check the update section of an update before anything is changed (rfc 2136 section 3.4.1)
+func prescanUpdate(zone string, updates []dns.RR) int {
+	for _, rr := range updates {
+		header := rr.Header()
+		if !inDomain(strings.ToLower(header.Name), zone) {
+			return dns.RcodeNotZone
+		}
+		switch header.Rrtype {
+		case dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB:
+			return dns.RcodeFormatError
+		}
+		switch header.Class {
+		case dns.ClassINET:
+			if _, empty := rr.(*dns.RR_Header); empty || header.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if header.Ttl != 0 {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if _, empty := rr.(*dns.RR_Header); empty || header.Ttl != 0 || header.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// apply a dynamic update (rfc 2136) to a zone loaded from a zone file. the update is written to the journal of the
+// zone file and the zone file is loaded again so that the update is answered right away. the serial of the zone is
+// increased with each update that changes the zone. the rcode of the response to the update is returned.
+func UpdateZone(request *dns.Msg, client string) int {
+	if request == nil || len(request.Question) != 1 || request.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	zone := strings.ToLower(dns.Fqdn(request.Question[0].Name))
+
+	zoneFiles.updateMux.Lock()
+	defer zoneFiles.updateMux.Unlock()
+
+	zoneFiles.mux.RLock()
+	sources := append([]*fileSource{}, zoneFiles.sources[zone]...)
+	zoneFiles.mux.RUnlock()
+
+	zoneVersions.mux.RLock()
+	versions := zoneVersions.versions[zone]
+	zoneVersions.mux.RUnlock()
+
+	if len(sources) < 1 || len(versions) < 1 {
+		return dns.RcodeNotAuth
+	}
+	records := versions[len(versions)-1].records
+
+	if rcode := checkPrerequisites(zone, records, request.Answer); rcode != dns.RcodeSuccess {
+		return rcode
+	}
+	if rcode := prescanUpdate(zone, request.Ns); rcode != dns.RcodeSuccess {
+		return rcode
+	}
+
+	updated := append([]dns.RR{}, records...)
+	for _, rr := range request.Ns {
+		updated = applyUpdate(zone, updated, rr)
+	}
+	// records keep their place as the update is applied so a change is a record that is different in its place
+	changed := len(updated) != len(records)
+	for idx := 0; !changed && idx < len(updated); idx++ {
+		changed = updated[idx].String() != records[idx].String()
+	}
+	if !changed {
+		return dns.RcodeSuccess
+	}
+
+	// the serial increases with every change unless the update already increased it
+	oldSOA := records[0].(*dns.SOA)
+	soa := dns.Copy(rrset(updated, zone, dns.TypeSOA)[0]).(*dns.SOA)
+	if !serialBefore(oldSOA.Serial, soa.Serial) {
+		soa.Serial = oldSOA.Serial + 1
+	}
+
+	// write the update records and the new soa record to the journal
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("; update from %s at %s\n", client, time.Now().Format(time.RFC3339)))
+	for _, rr := range request.Ns {
+		builder.WriteString(strings.TrimSpace(rr.String()) + "\n")
+	}
+	builder.WriteString(soa.String() + "\n")
+
+	path := journalPath(sources[0].path)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Errorf("Could not open journal '%s': %s", path, err)
+		return dns.RcodeServerFailure
+	}
+	_, err = file.WriteString(builder.String())
+	file.Close()
+	if err != nil {
+		log.Errorf("Could not write journal '%s': %s", path, err)
+		return dns.RcodeServerFailure
+	}
+
+	// load the zone file and the journal again so that the update is visible right away
+	for _, source := range sources {
+		source.Load(source.path)
+	}
+
+	log.Infof("Updated '%s' from %s (serial %d)", zone, client, soa.Serial)
+	return dns.RcodeSuccess
+}
@@ -0,0 +1,112 @@
+package resolver
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/chrisruffalo/gudgeon/testutil"
+)
+
+func TestUpdateZone(t *testing.T) {
+	// updates write a journal next to the zone file so a copy of the zone file is used
+	dir := testutil.TempDir()
+	defer os.RemoveAll(dir)
+	contents, err := ioutil.ReadFile("testdata/zone-authority.db")
+	if err != nil {
+		t.Fatalf("Could not read zone file: %s", err)
+	}
+	zoneFile := path.Join(dir, "update.db")
+	if err := ioutil.WriteFile(zoneFile, contents, 0644); err != nil {
+		t.Fatalf("Could not write zone file: %s", err)
+	}
+
+	source := NewSource(zoneFile)
+	defer source.Close()
+
+	// answer the question with the source and return the number of answers
+	answers := func(source Source, name string, qType uint16) int {
+		request := new(dns.Msg)
+		request.SetQuestion(name, qType)
+		response, err := source.Answer(nil, nil, request)
+		if err != nil || response == nil {
+			return 0
+		}
+		return len(response.Answer)
+	}
+
+	newRR := func(line string) dns.RR {
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			t.Fatalf("Could not parse record '%s': %s", line, err)
+		}
+		return rr
+	}
+
+	data := []struct {
+		name          string
+		prerequisites []dns.RR
+		updates       []dns.RR
+		rcode         int
+		question      string
+		qType         uint16
+		expected      int
+	}{
+		{"add a record", nil, []dns.RR{newRR("printer.example.lan. 300 IN A 192.168.1.50")}, dns.RcodeSuccess, "printer.example.lan.", dns.TypeA, 1},
+		{"add another record", nil, []dns.RR{newRR("printer.example.lan. 300 IN A 192.168.1.51")}, dns.RcodeSuccess, "printer.example.lan.", dns.TypeA, 2},
+		{"add a duplicate", nil, []dns.RR{newRR("printer.example.lan. 600 IN A 192.168.1.51")}, dns.RcodeSuccess, "printer.example.lan.", dns.TypeA, 2},
+		{"prerequisite name not in use", []dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "printer.example.lan.", Rrtype: dns.TypeANY, Class: dns.ClassNONE}}}, []dns.RR{newRR("printer.example.lan. 300 IN A 192.168.1.52")}, dns.RcodeYXDomain, "printer.example.lan.", dns.TypeA, 2},
+		{"prerequisite rrset exists", []dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "scanner.example.lan.", Rrtype: dns.TypeA, Class: dns.ClassANY}}}, []dns.RR{newRR("scanner.example.lan. 300 IN A 192.168.1.60")}, dns.RcodeNXRrset, "scanner.example.lan.", dns.TypeA, 0},
+		{"delete a record", nil, []dns.RR{newRR("printer.example.lan. 0 NONE A 192.168.1.50")}, dns.RcodeSuccess, "printer.example.lan.", dns.TypeA, 1},
+		{"add a cname to a name with records", nil, []dns.RR{newRR("printer.example.lan. 300 IN CNAME www.example.lan.")}, dns.RcodeSuccess, "printer.example.lan.", dns.TypeCNAME, 0},
+		{"add a txt record", nil, []dns.RR{newRR("_acme-challenge.example.lan. 60 IN TXT \"token\"")}, dns.RcodeSuccess, "_acme-challenge.example.lan.", dns.TypeTXT, 1},
+		{"delete an rrset", nil, []dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "_acme-challenge.example.lan.", Rrtype: dns.TypeTXT, Class: dns.ClassANY}}}, dns.RcodeSuccess, "_acme-challenge.example.lan.", dns.TypeTXT, 0},
+		{"the name servers of the zone are kept", nil, []dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "example.lan.", Rrtype: dns.TypeANY, Class: dns.ClassANY}}}, dns.RcodeSuccess, "example.lan.", dns.TypeNS, 1},
+		{"outside of the zone", nil, []dns.RR{newRR("printer.example.com. 300 IN A 192.168.1.50")}, dns.RcodeNotZone, "printer.example.com.", dns.TypeA, 0},
+		{"bad ttl for a delete", nil, []dns.RR{newRR("printer.example.lan. 300 NONE A 192.168.1.51")}, dns.RcodeFormatError, "printer.example.lan.", dns.TypeA, 1},
+	}
+
+	serial := ZoneSOA("example.lan.").Serial
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetUpdate("example.lan.")
+		request.Answer = d.prerequisites
+		request.Ns = d.updates
+
+		if rcode := UpdateZone(request, "127.0.0.1"); rcode != d.rcode {
+			t.Errorf("Update '%s' expected %s but got %s", d.name, dns.RcodeToString[d.rcode], dns.RcodeToString[rcode])
+		}
+		if count := answers(source, d.question, d.qType); count != d.expected {
+			t.Errorf("Update '%s' expected %d answers for '%s' but got %d", d.name, d.expected, d.question, count)
+		}
+	}
+
+	// the serial increases with each update that changes the zone, a duplicate with a new ttl is a change
+	if updated := ZoneSOA("example.lan.").Serial; updated != serial+6 {
+		t.Errorf("Expected serial %d after updates but got %d", serial+6, updated)
+	}
+
+	// a zone that is not loaded from a zone file can't be updated
+	request := new(dns.Msg)
+	request.SetUpdate("missing.lan.")
+	if rcode := UpdateZone(request, "127.0.0.1"); rcode != dns.RcodeNotAuth {
+		t.Errorf("Expected update of a missing zone to be NOTAUTH but got %s", dns.RcodeToString[rcode])
+	}
+
+	// the updates are read from the journal when the zone file is loaded again
+	source.Close()
+	reloaded := NewSource(zoneFile)
+	defer reloaded.Close()
+	if count := answers(reloaded, "printer.example.lan.", dns.TypeA); count != 1 {
+		t.Errorf("Expected 1 answer for 'printer.example.lan.' after reload but got %d", count)
+	}
+	if count := answers(reloaded, "_acme-challenge.example.lan.", dns.TypeTXT); count != 0 {
+		t.Errorf("Expected no answers for '_acme-challenge.example.lan.' after reload but got %d", count)
+	}
+	if reloadedSerial := ZoneSOA("example.lan.").Serial; reloadedSerial != serial+6 {
+		t.Errorf("Expected serial %d after reload but got %d", serial+6, reloadedSerial)
+	}
+}
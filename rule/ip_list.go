@@ -0,0 +1,166 @@
+package rule
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chrisruffalo/gudgeon/util"
+)
+
+// a node in a binary prefix tree of addresses
+type ipNode struct {
+	children [2]*ipNode
+	// the text of the rule that ends at this node, empty when no rule ends here
+	rule string
+}
+
+// a list of addresses and networks (in CIDR notation) that are compared against the addresses in an answer instead
+// of the name in the question. ipv4 and ipv6 rules are kept in separate prefix trees so that a lookup only walks the
+// bits of the address.
+type IPList struct {
+	mux   sync.RWMutex
+	v4    *ipNode
+	v6    *ipNode
+	count uint64
+}
+
+func NewIPList() *IPList {
+	return &IPList{
+		v4: &ipNode{},
+		v6: &ipNode{},
+	}
+}
+
+// parse a line, as from a file, and return the part that represents the address or network. anything after the
+// first field is ignored so that lists with trailing notes (like "10.0.0.0/8 ; note") can be used.
+func ParseIPLine(line string) string {
+	line = strings.TrimSpace(util.TrimComments(line))
+	if fields := strings.Fields(line); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// parse the rule into the address bytes and prefix length that it covers
+func parseIPRule(ruleText string) (net.IP, int, bool) {
+	if strings.Contains(ruleText, "/") {
+		_, parsedNet, err := net.ParseCIDR(ruleText)
+		if err != nil || parsedNet == nil {
+			return nil, 0, false
+		}
+		ones, _ := parsedNet.Mask.Size()
+		return parsedNet.IP, ones, true
+	}
+	ip := net.ParseIP(ruleText)
+	if ip == nil {
+		return nil, 0, false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return ip, len(ip) * 8, true
+}
+
+func (list *IPList) root(address net.IP) *ipNode {
+	if len(address) == net.IPv4len {
+		return list.v4
+	}
+	return list.v6
+}
+
+func (list *IPList) add(ruleText string) bool {
+	address, prefix, ok := parseIPRule(ruleText)
+	if !ok {
+		return false
+	}
+
+	current := list.root(address)
+	for bit := 0; bit < prefix; bit++ {
+		direction := (address[bit/8] >> uint(7-bit%8)) & 1
+		if current.children[direction] == nil {
+			current.children[direction] = &ipNode{}
+		}
+		current = current.children[direction]
+	}
+	if "" == current.rule {
+		current.rule = ruleText
+		list.count++
+	}
+	return true
+}
+
+// add a single rule to the list, returns false if the rule is not an address or network
+func (list *IPList) Add(ruleText string) bool {
+	list.mux.Lock()
+	defer list.mux.Unlock()
+	return list.add(ruleText)
+}
+
+// replace the rules in the list with the rules in the file at the given path and return the number of rules loaded
+func (list *IPList) Load(path string) uint64 {
+	data, err := util.OpenDecompressed(path)
+	if err != nil {
+		log.Errorf("Could not open list file: %s", err)
+		return 0
+	}
+	defer data.Close()
+
+	list.mux.Lock()
+	defer list.mux.Unlock()
+
+	list.v4 = &ipNode{}
+	list.v6 = &ipNode{}
+	list.count = 0
+
+	scanner := bufio.NewScanner(data)
+	scanner.Buffer(make([]byte, _loadBufferSize), _loadBufferSize)
+	for scanner.Scan() {
+		text := ParseIPLine(scanner.Text())
+		if "" != text && !list.add(text) {
+			log.Debugf("Skipping '%s' in ip list '%s', it is not an address or network", text, path)
+		}
+	}
+
+	return list.count
+}
+
+// the number of rules in the list
+func (list *IPList) Count() uint64 {
+	list.mux.RLock()
+	defer list.mux.RUnlock()
+	return list.count
+}
+
+// returns the most specific rule that contains the address or "" if no rule contains it
+func (list *IPList) Find(ip net.IP) string {
+	if list == nil || ip == nil {
+		return ""
+	}
+	address := ip.To4()
+	if address == nil {
+		address = ip.To16()
+	}
+	if address == nil {
+		return ""
+	}
+
+	list.mux.RLock()
+	defer list.mux.RUnlock()
+
+	found := ""
+	current := list.root(address)
+	for bit := 0; current != nil; bit++ {
+		if "" != current.rule {
+			found = current.rule
+		}
+		if bit >= len(address)*8 {
+			break
+		}
+		current = current.children[(address[bit/8]>>uint(7-bit%8))&1]
+	}
+	return found
+}
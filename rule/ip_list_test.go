@@ -0,0 +1,59 @@
+package rule
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseIPLine(t *testing.T) {
+	data := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"# hosting ranges", ""},
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"  192.0.2.0/24 ; SBL123  ", "192.0.2.0/24"},
+		{"2001:db8::1 # note", "2001:db8::1"},
+	}
+
+	for _, d := range data {
+		if result := ParseIPLine(d.input); d.expected != result {
+			t.Errorf("Input '%s' should have '%s' but got '%s'", d.input, d.expected, result)
+		}
+	}
+}
+
+func TestIPListFind(t *testing.T) {
+	list := NewIPList()
+	for _, ruleText := range []string{"10.0.0.0/8", "10.1.0.0/16", "192.0.2.7", "2001:db8::/32"} {
+		if !list.Add(ruleText) {
+			t.Errorf("Could not add rule '%s'", ruleText)
+		}
+	}
+	if list.Add("not.an.address") {
+		t.Errorf("Expected rule that is not an address to be rejected")
+	}
+	if list.Count() != 4 {
+		t.Errorf("Expected 4 rules but got %d", list.Count())
+	}
+
+	data := []struct {
+		address  string
+		expected string
+	}{
+		{"10.2.3.4", "10.0.0.0/8"},
+		{"10.1.3.4", "10.1.0.0/16"},
+		{"192.0.2.7", "192.0.2.7"},
+		{"::ffff:192.0.2.7", "192.0.2.7"},
+		{"192.0.2.8", ""},
+		{"2001:db8:1::1", "2001:db8::/32"},
+		{"2001:db9::1", ""},
+	}
+
+	for _, d := range data {
+		if result := list.Find(net.ParseIP(d.address)); d.expected != result {
+			t.Errorf("Address '%s' should match '%s' but got '%s'", d.address, d.expected, result)
+		}
+	}
+}
@@ -53,6 +53,15 @@ func (reloadingStore *reloadingStore) FindMatch(lists []*config.GudgeonList, dom
 	return MatchNone, nil, ""
 }
 
+func (reloadingStore *reloadingStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	if reloadingStore.delegate != nil {
+		reloadingStore.mux.RLock()
+		defer reloadingStore.mux.RUnlock()
+		return reloadingStore.delegate.FindAllMatches(lists, domain)
+	}
+	return []*RuleMatch{}
+}
+
 func (reloadingStore *reloadingStore) Close() {
 	if reloadingStore.delegate != nil {
 		reloadingStore.mux.Lock()
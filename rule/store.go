@@ -2,25 +2,29 @@ package rule
 
 import (
 	"bufio"
-	"os"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/chrisruffalo/gudgeon/config"
 	"github.com/chrisruffalo/gudgeon/events"
+	"github.com/chrisruffalo/gudgeon/util"
 )
 
 // a match can be:
 // allow (don't block, override/bypass block)
 // block (explicit block)
 // none (no reason found to block or allow)
+// would block (a block rule in an audit list or group matched but the query is not blocked)
+// rewrite (a rewrite rule answered the query with another name or addresses)
 type Match uint8
 
 const (
-	MatchAllow Match = 2
-	MatchBlock Match = 1
-	MatchNone  Match = 0
+	MatchRewrite    Match = 4
+	MatchWouldBlock Match = 3
+	MatchAllow      Match = 2
+	MatchBlock      Match = 1
+	MatchNone       Match = 0
 
 	// decent size buffer
 	_loadBufferSize = 32 * 1024
@@ -37,9 +41,32 @@ type Store interface {
 
 	FindMatch(lists []*config.GudgeonList, domain string) (Match, *config.GudgeonList, string)
 
+	// find every rule in the given lists that matches the domain instead of stopping at the first match
+	FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch
+
 	Close()
 }
 
+// a rule that matched a domain and the list it was found in
+type RuleMatch struct {
+	Match Match               `json:"match"`
+	List  *config.GudgeonList `json:"-"`
+	Rule  string              `json:"rule"`
+}
+
+// create a rule match with the match type that the type of list implies
+func newRuleMatch(list *config.GudgeonList, rule string) *RuleMatch {
+	match := MatchBlock
+	if list.ParsedType() == config.ALLOW {
+		match = MatchAllow
+	}
+	return &RuleMatch{
+		Match: match,
+		List:  list,
+		Rule:  rule,
+	}
+}
+
 type baseStore struct {
 	// map of block/allow -> short name -> config list
 	lists map[config.ListType]map[string]*config.GudgeonList
@@ -47,6 +74,7 @@ type baseStore struct {
 
 type eachListAction func(index int, listType config.ListType, list *config.GudgeonList)
 type matchListAction func(listType config.ListType, list *config.GudgeonList) (Match, *config.GudgeonList, string)
+type allMatchListAction func(list *config.GudgeonList) []*RuleMatch
 
 func (baseStore *baseStore) addList(list *config.GudgeonList) {
 	if list == nil {
@@ -126,6 +154,18 @@ func (baseStore *baseStore) forEachIn(lists []*config.GudgeonList, listAction ea
 	return actionedListCount
 }
 
+/**
+ * For each list in the base store that also appears in the list that was given perform an action
+ * and collect all of the matches that are returned
+ */
+func (baseStore *baseStore) allMatchesForEachIn(lists []*config.GudgeonList, matchAction allMatchListAction) []*RuleMatch {
+	matches := make([]*RuleMatch, 0)
+	baseStore.forEachIn(lists, func(index int, listType config.ListType, list *config.GudgeonList) {
+		matches = append(matches, matchAction(list)...)
+	})
+	return matches
+}
+
 /**
  * For each list of the given type in the base store that also appears in the list that was given
  * perform an action that can return a match
@@ -201,8 +241,17 @@ func CreateStore(storeRoot string, conf *config.GudgeonConfig) (Store, []uint64)
 	// reloading -> complex -> actual chosen store (which can delegate even further)
 	store.delegate = &complexStore{backingStore: delegate}
 
+	// manifests are expanded into other lists by the engine, ip lists are matched against answers by the
+	// engine, and rewrite lists are loaded by the engine so none of them are loaded as rules
+	lists := make([]*config.GudgeonList, 0, len(conf.Lists))
+	for _, list := range conf.Lists {
+		if !list.IsManifest() && !list.IsIP() && !list.IsRewrite() {
+			lists = append(lists, list)
+		}
+	}
+
 	// initialize stores
-	store.Init(storeRoot, conf, conf.Lists)
+	store.Init(storeRoot, conf, lists)
 
 	// load files into stores based on complexity
 	outputCount := make([]uint64, 0, len(conf.Lists))
@@ -211,26 +260,23 @@ func CreateStore(storeRoot string, conf *config.GudgeonConfig) (Store, []uint64)
 	var buffer = make([]byte, _loadBufferSize)
 
 	for _, list := range conf.Lists {
+		// keep counts in the same order as the configured lists
+		if list.IsManifest() || list.IsIP() || list.IsRewrite() {
+			outputCount = append(outputCount, 0)
+			continue
+		}
+
 		listCounter := loadList(store, conf, list, buffer)
 
 		// locally scoped variable for list watching
 		watchList := list
 
-		// notify that we want to watch for changes in a given file
-		events.Send("file:watch:start", &events.Message{"path": conf.PathToList(watchList)})
 		// save handle so it can later be used to close watchers
-		handle := events.Listen("file:"+conf.PathToList(watchList), func(message *events.Message) {
+		handle := WatchList(conf, watchList, func() uint64 {
 			store.Clear(conf, watchList)
 			newRuleCount := loadList(store, conf, watchList, buffer)
 			store.Finalize(conf.SessionRoot(), []*config.GudgeonList{watchList})
-			// send message that a list value changed
-			events.Send("store:list:changed", &events.Message{
-				"listName":      watchList.CanonicalName(),
-				"listShortName": watchList.ShortName(),
-				"count":         newRuleCount,
-			})
-			// watch file again
-			events.Send("file:watch:start", &events.Message{"path": conf.PathToList(watchList)})
+			return newRuleCount
 		})
 		if handle != nil {
 			store.handlers = append(store.handlers, handle)
@@ -241,16 +287,29 @@ func CreateStore(storeRoot string, conf *config.GudgeonConfig) (Store, []uint64)
 	}
 
 	// finalize both stores (store finalizes delegate)
-	store.Finalize(storeRoot, conf.Lists)
+	store.Finalize(storeRoot, lists)
 
 	// finalize and return store
 	return store, outputCount
 }
 
+// watch the file of a list and reload the list when it changes, the count from the reload is sent with the message
+// that the list changed
+func WatchList(conf *config.GudgeonConfig, list *config.GudgeonList, reload func() uint64) *events.Handle {
+	return events.WatchFile(conf.PathToList(list), func() {
+		count := reload()
+		events.Send("store:list:changed", &events.Message{
+			"listName":      list.CanonicalName(),
+			"listShortName": list.ShortName(),
+			"count":         count,
+		})
+	})
+}
+
 // load list with a reusable buffer
 func loadList(store Store, config *config.GudgeonConfig, list *config.GudgeonList, buffer []byte) uint64 {
-	// open file and scan
-	data, err := os.Open(config.PathToList(list))
+	// open file (decompressing if required) and scan
+	data, err := util.OpenDecompressed(config.PathToList(list))
 	if err != nil {
 		log.Errorf("Could not open list file: %s", err)
 		return uint64(0)
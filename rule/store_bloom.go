@@ -26,7 +26,7 @@ func (store *bloomStore) createBloom(config *config.GudgeonConfig, list *config.
 		var err error
 		linesInFile := store.defaultRuleCount
 		if config != nil {
-			linesInFile, err = util.LineCount(config.PathToList(list))
+			linesInFile, err = util.DecompressedLineCount(config.PathToList(list))
 			if err != nil {
 				linesInFile = store.defaultRuleCount
 			}
@@ -126,6 +126,28 @@ func (store *bloomStore) FindMatch(lists []*config.GudgeonList, domain string) (
 	return match, list, rule
 }
 
+func (store *bloomStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	domains := util.DomainList(domain)
+
+	return store.allMatchesForEachIn(lists, func(list *config.GudgeonList) []*RuleMatch {
+		matches := make([]*RuleMatch, 0)
+		filter, found := store.blooms[list.CanonicalName()]
+		if !found {
+			return matches
+		}
+		for _, d := range domains {
+			if found, _ := store.foundInList(filter, d); found {
+				// the backing store confirms that the match is not a false positive
+				if store.backingStore != nil {
+					return store.backingStore.FindAllMatches([]*config.GudgeonList{list}, domain)
+				}
+				matches = append(matches, newRuleMatch(list, d))
+			}
+		}
+		return matches
+	})
+}
+
 func (store *bloomStore) Close() {
 	// remove reference to blooms
 	store.blooms = make(map[string]*bloom.BloomFilter)
@@ -2,6 +2,10 @@ package rule
 
 import (
 	"testing"
+
+	"github.com/willf/bloom"
+
+	"github.com/chrisruffalo/gudgeon/config"
 )
 
 func TestBloomRuleStore(t *testing.T) {
@@ -38,3 +42,17 @@ func BenchmarkBloomHashRuleStore(b *testing.B) {
 		}
 	}, b)
 }
+
+func TestBloomCompressedListSize(t *testing.T) {
+	conf := &config.GudgeonConfig{Home: t.Name()}
+	list := &config.GudgeonList{Name: "compressed", Source: "testdata/compressed.list.gz"}
+
+	store := &bloomStore{}
+	store.Init("", conf, []*config.GudgeonList{list})
+
+	// sized from the lines in the decompressed list and not the bytes of the compressed file
+	expected := bloom.NewWithEstimates(5000, bloomRate).Cap()
+	if actual := store.blooms[list.CanonicalName()].Cap(); expected != actual {
+		t.Errorf("Expected bloom filter with %d bits for compressed list but got %d", expected, actual)
+	}
+}
@@ -106,6 +106,25 @@ func (store *complexStore) FindMatch(lists []*config.GudgeonList, domain string)
 	return MatchNone, nil, ""
 }
 
+func (store *complexStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	matches := store.allMatchesForEachIn(lists, func(list *config.GudgeonList) []*RuleMatch {
+		listMatches := make([]*RuleMatch, 0)
+		for _, rule := range store.complexRules[list.CanonicalName()] {
+			if rule.IsMatch(domain) {
+				listMatches = append(listMatches, newRuleMatch(list, rule.Text()))
+			}
+		}
+		return listMatches
+	})
+
+	// simple rules are in the backing store
+	if store.backingStore != nil {
+		matches = append(matches, store.backingStore.FindAllMatches(lists, domain)...)
+	}
+
+	return matches
+}
+
 func (store *complexStore) Close() {
 	// default no-op
 }
@@ -111,6 +111,33 @@ func (store *hashStore) FindMatch(lists []*config.GudgeonList, domain string) (M
 	return match, list, rule
 }
 
+func (store *hashStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	// get domain hashes
+	domains := util.DomainList(domain)
+	domainHashes := make([]uint64, len(domains))
+	for idx, d := range domains {
+		domainHashes[idx] = murmur3.StringSum64(strings.ToLower(d))
+	}
+
+	return store.allMatchesForEachIn(lists, func(list *config.GudgeonList) []*RuleMatch {
+		matches := make([]*RuleMatch, 0)
+		rules, found := store.hashes[list.CanonicalName()]
+		if !found {
+			return matches
+		}
+		for idx := 0; idx < len(domainHashes); idx++ {
+			if found := store.foundInList(rules, domainHashes[idx]); found {
+				// the delegate confirms the hash match and has the text of the rules
+				if store.delegate != nil {
+					return store.delegate.FindAllMatches([]*config.GudgeonList{list}, domain)
+				}
+				matches = append(matches, newRuleMatch(list, domains[idx]))
+			}
+		}
+		return matches
+	})
+}
+
 func (store *hashStore) Close() {
 	// overwrite map with empty map
 	store.hashes = make(map[string]map[uint64]struct{})
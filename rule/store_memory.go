@@ -23,7 +23,7 @@ func (store *memoryStore) Init(sessionRoot string, config *config.GudgeonConfig,
 		if _, found := store.rules[list.CanonicalName()]; !found {
 			startingArrayLength := uint(0)
 			if config != nil {
-				startingArrayLength, _ = util.LineCount(config.PathToList(list))
+				startingArrayLength, _ = util.DecompressedLineCount(config.PathToList(list))
 			}
 			store.rules[list.CanonicalName()] = make([]string, 0, startingArrayLength)
 		}
@@ -33,7 +33,7 @@ func (store *memoryStore) Init(sessionRoot string, config *config.GudgeonConfig,
 func (store *memoryStore) Clear(config *config.GudgeonConfig, list *config.GudgeonList) {
 	startingArrayLength := uint(0)
 	if config != nil {
-		startingArrayLength, _ = util.LineCount(config.PathToList(list))
+		startingArrayLength, _ = util.DecompressedLineCount(config.PathToList(list))
 	}
 	store.rules[list.CanonicalName()] = make([]string, 0, startingArrayLength)
 	store.removeList(list)
@@ -105,6 +105,24 @@ func (store *memoryStore) FindMatch(lists []*config.GudgeonList, domain string)
 	return match, list, rule
 }
 
+func (store *memoryStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	domains := util.DomainList(domain)
+
+	return store.allMatchesForEachIn(lists, func(list *config.GudgeonList) []*RuleMatch {
+		matches := make([]*RuleMatch, 0)
+		rules, found := store.rules[list.CanonicalName()]
+		if !found {
+			return matches
+		}
+		for _, d := range domains {
+			if found, ruleString := store.foundInList(rules, d); found {
+				matches = append(matches, newRuleMatch(list, ruleString))
+			}
+		}
+		return matches
+	})
+}
+
 func (store *memoryStore) Close() {
 	// remove reference to rules
 	store.rules = make(map[string][]string)
@@ -2,6 +2,8 @@ package rule
 
 import (
 	"testing"
+
+	"github.com/chrisruffalo/gudgeon/config"
 )
 
 func TestMemoryRuleStore(t *testing.T) {
@@ -11,3 +13,15 @@ func TestMemoryRuleStore(t *testing.T) {
 func BenchmarkMemoryRuleStore(b *testing.B) {
 	benchNonComplexStore(func() Store { return &memoryStore{} }, b)
 }
+
+func TestMemoryCompressedListSize(t *testing.T) {
+	conf := &config.GudgeonConfig{Home: t.Name()}
+	list := &config.GudgeonList{Name: "compressed", Source: "testdata/compressed.list.gz"}
+
+	store := &memoryStore{}
+	store.Init("", conf, []*config.GudgeonList{list})
+
+	if actual := cap(store.rules[list.CanonicalName()]); 5000 != actual {
+		t.Errorf("Expected room for 5000 rules from compressed list but got %d", actual)
+	}
+}
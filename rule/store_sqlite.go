@@ -325,6 +325,55 @@ func (store *sqlStore) FindMatch(lists []*config.GudgeonList, domain string) (Ma
 	return MatchNone, nil, ""
 }
 
+func (store *sqlStore) FindAllMatches(lists []*config.GudgeonList, domain string) []*RuleMatch {
+	matches := make([]*RuleMatch, 0)
+
+	store.closingMutex.RLock()
+	defer store.closingMutex.RUnlock()
+	if store.db == nil || store.closing {
+		return matches
+	}
+
+	domains := util.DomainList(domain)
+	vars := make([]interface{}, 0, len(lists)+len(domains))
+	store.forEachIn(lists, func(index int, listType config.ListType, list *config.GudgeonList) {
+		vars = append(vars, list.ShortName())
+	})
+	numLists := len(vars)
+	if numLists < 1 || len(domains) < 1 {
+		return matches
+	}
+	for _, d := range domains {
+		vars = append(vars, d)
+	}
+
+	// not cached like the single match query because this is only used for troubleshooting
+	query := queryStartFragment + queryListVarFragment + strings.Repeat(", ?", numLists-1) + ")" + queryRuleVarFragment + strings.Repeat(", ?", len(domains)-1) + ")"
+	rows, err := store.db.Query(query, vars...)
+	if err != nil {
+		log.Errorf("Finding all rule matches: %s", err)
+		return matches
+	}
+	defer rows.Close()
+
+	var (
+		listName string
+		ltype    config.ListType
+		rule     string
+	)
+	for rows.Next() {
+		if err := rows.Scan(&listName, &ltype, &rule); err != nil {
+			log.Errorf("Reading rule match: %s", err)
+			continue
+		}
+		if list := store.getList(listName); list != nil {
+			matches = append(matches, newRuleMatch(list, rule))
+		}
+	}
+
+	return matches
+}
+
 func (store *sqlStore) Close() {
 	store.closingMutex.Lock()
 	store.closing = true
@@ -89,6 +89,7 @@ func singleRunTest(tmpDir string, ruleData []ruleList, store Store, t *testing.T
 			if MatchBlock != result {
 				t.Errorf("Rules of type %d in list %s expected to block '%s' but did not", data.ruleType, lists[0].ShortName(), expectedBlock)
 			}
+			checkAllMatches(store, lists, expectedBlock, MatchBlock, t)
 		}
 
 		// check allowed
@@ -97,6 +98,7 @@ func singleRunTest(tmpDir string, ruleData []ruleList, store Store, t *testing.T
 			if MatchAllow != result {
 				t.Errorf("Rules of type %d in list %s expected to allow '%s' but did not", data.ruleType, lists[0].ShortName(), expectedAllow)
 			}
+			checkAllMatches(store, lists, expectedAllow, MatchAllow, t)
 		}
 
 		// check no match
@@ -105,12 +107,28 @@ func singleRunTest(tmpDir string, ruleData []ruleList, store Store, t *testing.T
 			if MatchNone != result {
 				t.Errorf("Rules of type %d in list %s expected to not match '%s' but did", data.ruleType, lists[0].ShortName(), expectedNoMatch)
 			}
+			if matches := store.FindAllMatches(lists, expectedNoMatch); len(matches) > 0 {
+				t.Errorf("List %s expected to have no matches for '%s' but found %d", lists[0].ShortName(), expectedNoMatch, len(matches))
+			}
 		}
 
 		store.Clear(nil, lists[0])
 	}
 }
 
+// every match found should have the expected type and come from the given list
+func checkAllMatches(store Store, lists []*config.GudgeonList, domain string, expected Match, t *testing.T) {
+	matches := store.FindAllMatches(lists, domain)
+	if len(matches) < 1 {
+		t.Errorf("List %s expected to have matches for '%s' but found none", lists[0].ShortName(), domain)
+	}
+	for _, match := range matches {
+		if match.Match != expected || match.List != lists[0] || "" == match.Rule {
+			t.Errorf("List %s has unexpected match for '%s': %v", lists[0].ShortName(), domain, match)
+		}
+	}
+}
+
 // for benchmarking non-complex implementations
 func benchNonComplexStore(createRuleStore ruleStoreCreator, b *testing.B) {
 	tmpDir := testutil.TempDir()
@@ -187,3 +205,57 @@ func printMemUsage(msg string, b *testing.B) {
 func bToMb(b uint64) uint64 {
 	return b / 1024 / 1024
 }
+
+func TestFindAllMatches(t *testing.T) {
+	creators := map[string]ruleStoreCreator{
+		"memory":       func() Store { return &complexStore{backingStore: &memoryStore{}} },
+		"hash":         func() Store { return &complexStore{backingStore: &hashStore{}} },
+		"hash+sqlite":  func() Store { return &complexStore{backingStore: &hashStore{delegate: &sqlStore{}}} },
+		"hash32":       func() Store { return &complexStore{backingStore: &hashStore32{}} },
+		"bloom+sqlite": func() Store { return &complexStore{backingStore: &bloomStore{backingStore: &sqlStore{}}} },
+		"sqlite":       func() Store { return &complexStore{backingStore: &sqlStore{}} },
+	}
+
+	for name, creator := range creators {
+		tmpDir := testutil.TempDir()
+
+		lists := []*config.GudgeonList{
+			{Name: "ads", Type: "block"},
+			{Name: "trackers", Type: "block"},
+			{Name: "exceptions", Type: "allow"},
+			{Name: "other", Type: "block"},
+		}
+		for _, list := range lists {
+			list.VerifyAndInit()
+		}
+
+		store := creator()
+		store.Init(tmpDir, nil, lists)
+		store.Load(lists[0], "rate.com")
+		store.Load(lists[1], "we.rate.com")
+		store.Load(lists[1], "*.rate.*")
+		store.Load(lists[2], "rate.com")
+		store.Load(lists[3], "other.com")
+		store.Finalize(tmpDir, lists)
+
+		matches := store.FindAllMatches(lists, "we.rate.com")
+		if len(matches) != 4 {
+			t.Errorf("[%s] Expected 4 matches but found %d", name, len(matches))
+		}
+		allows := 0
+		for _, match := range matches {
+			if match.List == lists[3] {
+				t.Errorf("[%s] Unexpected match in list '%s'", name, match.List.Name)
+			}
+			if match.Match == MatchAllow {
+				allows++
+			}
+		}
+		if allows != 1 {
+			t.Errorf("[%s] Expected 1 allow match but found %d", name, allows)
+		}
+
+		store.Close()
+		os.RemoveAll(tmpDir)
+	}
+}
@@ -0,0 +1,48 @@
+package util
+
+import (
+	"net"
+)
+
+// networks that are not reachable on the public internet: unspecified, loopback, private (rfc 1918 and unique local),
+// shared (carrier grade nat), and link-local addresses
+var privateNets = parseNets(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+func parseNets(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if _, parsedNet, err := net.ParseCIDR(cidr); err == nil {
+			nets = append(nets, parsedNet)
+		}
+	}
+	return nets
+}
+
+// if the address is private, loopback, link-local or otherwise not a public address. ipv4 addresses mapped into
+// ipv6 are checked as ipv4 addresses.
+func IsPrivateIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, privateNet := range privateNets {
+		if privateNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
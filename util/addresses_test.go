@@ -0,0 +1,34 @@
+package util
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPrivateIP(t *testing.T) {
+	data := []struct {
+		address  string
+		expected bool
+	}{
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"172.32.0.1", false},
+		{"192.168.1.1", true},
+		{"127.0.0.1", true},
+		{"169.254.10.10", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"8.8.8.8", false},
+		{"::1", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"::ffff:192.168.1.1", true},
+		{"2001:4860:4860::8888", false},
+	}
+
+	for _, d := range data {
+		if result := IsPrivateIP(net.ParseIP(d.address)); result != d.expected {
+			t.Errorf("Address '%s' should be private (%t) but got %t", d.address, d.expected, result)
+		}
+	}
+}
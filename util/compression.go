@@ -0,0 +1,248 @@
+package util
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// the type of compression (or archive) that a list is stored in
+type Compression uint8
+
+const (
+	CompressionNone  = Compression(0)
+	CompressionGzip  = Compression(1)
+	CompressionBzip2 = Compression(2)
+	CompressionXz    = Compression(3)
+	CompressionZip   = Compression(4)
+)
+
+// magic bytes at the start of each supported format
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zipMagic   = []byte{'P', 'K', 0x03, 0x04}
+)
+
+func (compression Compression) String() string {
+	switch compression {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionBzip2:
+		return "bzip2"
+	case CompressionXz:
+		return "xz"
+	case CompressionZip:
+		return "zip"
+	}
+	return "none"
+}
+
+// determine compression from the extension of a file name or url, query strings and fragments are ignored
+func CompressionFromName(name string) Compression {
+	if idx := strings.IndexAny(name, "?#"); idx > -1 {
+		name = name[:idx]
+	}
+	name = strings.ToLower(name)
+
+	switch {
+	case strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".gzip"):
+		return CompressionGzip
+	case strings.HasSuffix(name, ".bz2") || strings.HasSuffix(name, ".bzip2"):
+		return CompressionBzip2
+	case strings.HasSuffix(name, ".xz"):
+		return CompressionXz
+	case strings.HasSuffix(name, ".zip"):
+		return CompressionZip
+	}
+	return CompressionNone
+}
+
+// determine compression from an http Content-Type (or Content-Encoding) header value
+func CompressionFromContentType(contentType string) Compression {
+	// drop parameters like "; charset=utf-8"
+	if idx := strings.Index(contentType, ";"); idx > -1 {
+		contentType = contentType[:idx]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+
+	switch contentType {
+	case "application/gzip", "application/x-gzip", "application/x-gunzip", "application/gzipped", "gzip", "x-gzip":
+		return CompressionGzip
+	case "application/x-bzip2", "application/x-bzip", "application/bzip2":
+		return CompressionBzip2
+	case "application/x-xz", "application/xz":
+		return CompressionXz
+	case "application/zip", "application/x-zip", "application/x-zip-compressed":
+		return CompressionZip
+	}
+	return CompressionNone
+}
+
+// determine compression by peeking at the leading bytes of the content
+func CompressionFromMagic(header []byte) Compression {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(header, xzMagic):
+		return CompressionXz
+	case bytes.HasPrefix(header, zipMagic):
+		return CompressionZip
+	case bytes.HasPrefix(header, bzip2Magic) && len(header) > 3 && header[3] >= '1' && header[3] <= '9':
+		return CompressionBzip2
+	}
+	return CompressionNone
+}
+
+// wraps the reader used to decompress a file so that closing it also closes the file
+type decompressingReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (reader *decompressingReader) Close() error {
+	var err error
+	for _, closer := range reader.closers {
+		if cErr := closer.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
+
+// open a file and return a reader of the decompressed content. the compression type is determined from the
+// file name first and then from the leading bytes of the file so that files without a known extension still work.
+// entries in zip archives are read one after another as if they were a single file.
+func OpenDecompressed(inputfile string) (io.ReadCloser, error) {
+	return OpenDecompressedAs(inputfile, CompressionNone)
+}
+
+// count the lines in the decompressed content of a file
+func DecompressedLineCount(inputfile string) (uint, error) {
+	r, err := OpenDecompressed(inputfile)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	return ReaderLineCount(r)
+}
+
+// the same as OpenDecompressed but a compression hint (from a content type, for example) can be provided
+func OpenDecompressedAs(inputfile string, compression Compression) (io.ReadCloser, error) {
+	file, err := os.Open(inputfile)
+	if err != nil {
+		return nil, err
+	}
+
+	if compression == CompressionNone {
+		compression = CompressionFromName(inputfile)
+	}
+
+	// peek at the start of the file and trust the content over the name
+	buffered := bufio.NewReader(file)
+	if header, _ := buffered.Peek(len(xzMagic)); len(header) > 0 {
+		if sniffed := CompressionFromMagic(header); sniffed != CompressionNone {
+			compression = sniffed
+		} else if compression != CompressionNone {
+			// the name (or hint) says compressed but the content is plain, read it as plain text
+			compression = CompressionNone
+		}
+	}
+
+	var reader io.Reader
+	closers := []io.Closer{file}
+
+	switch compression {
+	case CompressionGzip:
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("opening gzip stream '%s': %s", inputfile, err)
+		}
+		closers = append([]io.Closer{gzipReader}, closers...)
+		reader = gzipReader
+	case CompressionBzip2:
+		reader = bzip2.NewReader(buffered)
+	case CompressionXz:
+		xzReader, err := xz.NewReader(buffered)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("opening xz stream '%s': %s", inputfile, err)
+		}
+		reader = xzReader
+	case CompressionZip:
+		reader, err = zipEntriesReader(file, &closers)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("opening zip archive '%s': %s", inputfile, err)
+		}
+	default:
+		reader = buffered
+	}
+
+	return &decompressingReader{Reader: reader, closers: closers}, nil
+}
+
+// create a reader that reads every (non-directory) entry in the zip archive in order
+func zipEntriesReader(file *os.File, closers *[]io.Closer) (io.Reader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	readers := make([]io.Reader, 0, len(archive.File))
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		entryReader, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		*closers = append([]io.Closer{entryReader}, *closers...)
+		// ensure each entry ends with a newline so that the last line of one entry doesn't run into the next
+		readers = append(readers, entryReader, bytes.NewReader(_lineSep))
+	}
+
+	return io.MultiReader(readers...), nil
+}
+
+// decompress the source file into the target file, the target is replaced only after the decompression is successful
+func DecompressFile(source string, target string, compression Compression) error {
+	reader, err := OpenDecompressedAs(source, compression)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	tmpTarget := target + ".tmp"
+	out, err := os.Create(tmpTarget)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, reader)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpTarget)
+		return err
+	}
+
+	return os.Rename(tmpTarget, target)
+}
@@ -0,0 +1,125 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestCompressionFromName(t *testing.T) {
+	data := []struct {
+		name     string
+		expected Compression
+	}{
+		{"https://example.com/list.txt", CompressionNone},
+		{"https://example.com/list.txt.gz", CompressionGzip},
+		{"https://example.com/list.tgz?version=2", CompressionGzip},
+		{"/tmp/list.BZ2", CompressionBzip2},
+		{"list.xz", CompressionXz},
+		{"https://example.com/lists.zip#fragment", CompressionZip},
+		{"https://example.com/zip", CompressionNone},
+	}
+
+	for _, d := range data {
+		if actual := CompressionFromName(d.name); d.expected != actual {
+			t.Errorf("Expected compression %s for '%s' but got %s", d.expected, d.name, actual)
+		}
+	}
+}
+
+func TestCompressionFromContentType(t *testing.T) {
+	data := []struct {
+		contentType string
+		expected    Compression
+	}{
+		{"text/plain; charset=utf-8", CompressionNone},
+		{"application/gzip", CompressionGzip},
+		{"application/x-gzip; charset=binary", CompressionGzip},
+		{"application/x-bzip2", CompressionBzip2},
+		{"application/x-xz", CompressionXz},
+		{"application/zip", CompressionZip},
+		{"", CompressionNone},
+	}
+
+	for _, d := range data {
+		if actual := CompressionFromContentType(d.contentType); d.expected != actual {
+			t.Errorf("Expected compression %s for '%s' but got %s", d.expected, d.contentType, actual)
+		}
+	}
+}
+
+func TestOpenDecompressed(t *testing.T) {
+	expected := "one.com\ntwo.com\n# comment\nthree.com\n"
+
+	data := []struct {
+		file     string
+		expected string
+	}{
+		{"testdata/compressed.list", expected},
+		{"testdata/compressed.list.gz", expected},
+		{"testdata/compressed.list.bz2", expected},
+		{"testdata/compressed.list.xz", expected},
+		// gzip content without a gzip extension
+		{"testdata/gzipped.list", expected},
+		// all entries from the archive are read in order
+		{"testdata/compressed.list.zip", expected + "\nfour.com\n\n"},
+	}
+
+	for _, d := range data {
+		reader, err := OpenDecompressed(d.file)
+		if err != nil {
+			t.Errorf("Could not open '%s': %s", d.file, err)
+			continue
+		}
+		content, err := ioutil.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			t.Errorf("Could not read '%s': %s", d.file, err)
+			continue
+		}
+		if d.expected != string(content) {
+			t.Errorf("Unexpected content from '%s': %s", d.file, strings.Replace(string(content), "\n", "\\n", -1))
+		}
+	}
+}
+
+func TestDecompressFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gudgeon-compression-")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	target := path.Join(dir, "target.list")
+	if err := DecompressFile("testdata/compressed.list.xz", target, CompressionXz); err != nil {
+		t.Fatalf("Could not decompress file: %s", err)
+	}
+
+	lines, err := LineCount(target)
+	if err != nil || lines != 4 {
+		t.Errorf("Expected 4 lines in decompressed file but got %d (err: %v)", lines, err)
+	}
+}
+
+func TestDecompressedLineCount(t *testing.T) {
+	data := []struct {
+		file     string
+		expected uint
+	}{
+		{"testdata/compressed.list", 4},
+		{"testdata/compressed.list.gz", 4},
+		{"testdata/compressed.list.bz2", 4},
+		{"testdata/compressed.list.xz", 4},
+		{"testdata/gzipped.list", 4},
+		{"testdata/compressed.list.zip", 7},
+	}
+
+	for _, d := range data {
+		lines, err := DecompressedLineCount(d.file)
+		if err != nil || d.expected != lines {
+			t.Errorf("Expected %d lines in '%s' but got %d (err: %v)", d.expected, d.file, lines, err)
+		}
+	}
+}
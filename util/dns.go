@@ -44,6 +44,20 @@ func IsEmptyResponse(response *dns.Msg) bool {
 	return true
 }
 
+// returns true if the response is a negative answer (NXDOMAIN or no records) from the authority for the name. these
+// are complete answers even though they are empty.
+func IsAuthoritativeNegative(response *dns.Msg) bool {
+	if response == nil || !response.Authoritative || (response.Rcode != dns.RcodeNameError && len(response.Answer) > 0) {
+		return false
+	}
+	for _, rr := range response.Ns {
+		if _, ok := rr.(*dns.SOA); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // get the first A record response value
 func GetFirstIPResponse(response *dns.Msg) string {
 	if IsEmptyResponse(response) {
@@ -85,6 +85,36 @@ func TestIsEmpty(t *testing.T) {
 	}
 }
 
+func TestIsAuthoritativeNegative(t *testing.T) {
+	soa := &dns.SOA{Hdr: dns.RR_Header{Name: "example.lan.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 60}, Ns: "ns.example.lan.", Mbox: "admin.example.lan."}
+	a := &dns.A{Hdr: dns.RR_Header{Name: "www.example.lan.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: net.ParseIP("192.168.1.10")}
+
+	data := []struct {
+		authoritative bool
+		rcode         int
+		answer        []dns.RR
+		ns            []dns.RR
+		expected      bool
+	}{
+		{true, dns.RcodeNameError, nil, []dns.RR{soa}, true},
+		{true, dns.RcodeSuccess, nil, []dns.RR{soa}, true},
+		{true, dns.RcodeSuccess, []dns.RR{a}, []dns.RR{soa}, false},
+		{false, dns.RcodeNameError, nil, []dns.RR{soa}, false},
+		{true, dns.RcodeNameError, nil, nil, false},
+	}
+
+	for _, d := range data {
+		response := &dns.Msg{MsgHdr: dns.MsgHdr{Authoritative: d.authoritative, Rcode: d.rcode}, Answer: d.answer, Ns: d.ns}
+		if IsAuthoritativeNegative(response) != d.expected {
+			t.Errorf("Expected authoritative negative to be %t for response:\n%s", d.expected, response)
+		}
+	}
+
+	if IsAuthoritativeNegative(nil) {
+		t.Errorf("Nil response should not be an authoritative negative")
+	}
+}
+
 func TestGetRecordValue(t *testing.T) {
 	// create static header
 	hdr := dns.RR_Header{Name: "test.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 0}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"encoding/hex"
+	"fmt"
 	"net"
 	"strconv"
 	"strings"
@@ -114,3 +115,80 @@ func DomainList(domain string) []string {
 	}
 	return domains
 }
+
+// zones that are only meaningful on the local network (RFC 6761, RFC 6762, RFC 7686, RFC 8375) and the reverse
+// zones of private, loopback, and link-local addresses (RFC 6303)
+var specialUseZones = func() map[string]bool {
+	zones := map[string]bool{
+		"local":                true,
+		"localhost":            true,
+		"invalid":              true,
+		"test":                 true,
+		"onion":                true,
+		"home.arpa":            true,
+		"0.in-addr.arpa":       true,
+		"10.in-addr.arpa":      true,
+		"127.in-addr.arpa":     true,
+		"254.169.in-addr.arpa": true,
+		"168.192.in-addr.arpa": true,
+		"c.f.ip6.arpa":         true,
+		"d.f.ip6.arpa":         true,
+		"8.e.f.ip6.arpa":       true,
+		"9.e.f.ip6.arpa":       true,
+		"a.e.f.ip6.arpa":       true,
+		"b.e.f.ip6.arpa":       true,
+	}
+	for second := 16; second < 32; second++ {
+		zones[strconv.Itoa(second)+".172.in-addr.arpa"] = true
+	}
+	zones[strings.TrimSuffix(ReverseLookupDomainString("::1"), ".")] = true
+	zones[strings.TrimSuffix(ReverseLookupDomainString("::"), ".")] = true
+	return zones
+}()
+
+// special use domains and private reverse lookups should be answered locally and never sent to public resolvers
+func IsSpecialUseDomain(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	for "" != domain {
+		if specialUseZones[domain] {
+			return true
+		}
+		idx := strings.Index(domain, ".")
+		if idx < 0 {
+			break
+		}
+		domain = domain[idx+1:]
+	}
+	return false
+}
+
+// parse a rewrite rule like "printer.corp -> 10.0.3.4" or "*.internal.example gateway.internal" into the domain
+// pattern and the targets. the targets are either one or more addresses or a single name. the arrow is optional
+// and an empty pattern is returned for a line with no rule.
+func ParseRewrite(line string) (string, []string, error) {
+	fields := strings.Fields(strings.Replace(TrimComments(line), "->", " ", -1))
+	if len(fields) < 1 {
+		return "", nil, nil
+	}
+	if len(fields) < 2 {
+		return "", nil, fmt.Errorf("has no target")
+	}
+
+	pattern := strings.ToLower(strings.TrimSuffix(fields[0], "."))
+	if "" == pattern || "*" == pattern || strings.Contains(strings.TrimPrefix(pattern, "*."), "*") {
+		return "", nil, fmt.Errorf("pattern '%s' must be a domain or a wildcard like '*.example.com'", fields[0])
+	}
+
+	targets := fields[1:]
+	for idx, target := range targets {
+		if net.ParseIP(target) != nil {
+			continue
+		}
+		if len(targets) > 1 {
+			return "", nil, fmt.Errorf("target '%s' must be an address, only a single target can be a name", target)
+		}
+		targets[idx] = strings.ToLower(target)
+	}
+
+	return pattern, targets, nil
+}
@@ -66,3 +66,40 @@ func TestDomainList(t *testing.T) {
 		}
 	}
 }
+
+func TestParseRewrite(t *testing.T) {
+	data := []struct {
+		input   string
+		pattern string
+		targets []string
+		err     bool
+	}{
+		{"# comment", "", nil, false},
+		{"printer.corp -> 10.0.3.4", "printer.corp", []string{"10.0.3.4"}, false},
+		{"*.Internal.Example. Gateway.Internal", "*.internal.example", []string{"gateway.internal"}, false},
+		{"host.example 10.0.0.1 fd00::1 # two addresses", "host.example", []string{"10.0.0.1", "fd00::1"}, false},
+		{"host.example", "", nil, true},
+		{"host.example 10.0.0.1 gateway.internal", "", nil, true},
+		{"*.* 10.0.0.1", "", nil, true},
+	}
+
+	for _, d := range data {
+		pattern, targets, err := ParseRewrite(d.input)
+		if (err != nil) != d.err || pattern != d.pattern || !reflect.DeepEqual(targets, d.targets) {
+			t.Errorf("Rewrite '%s' expected '%s' %v (error %t) but got '%s' %v (%v)", d.input, d.pattern, d.targets, d.err, pattern, targets, err)
+		}
+	}
+}
+
+func TestIsSpecialUseDomain(t *testing.T) {
+	for _, domain := range []string{"printer.local.", "LOCALHOST", "thing.test", "router.home.arpa.", "4.3.2.10.in-addr.arpa.", "1.1.20.172.in-addr.arpa.", "1.0.168.192.in-addr.arpa", ReverseLookupDomainString("fd00::1"), ReverseLookupDomainString("fe80::1"), ReverseLookupDomainString("::1")} {
+		if !IsSpecialUseDomain(domain) {
+			t.Errorf("Expected '%s' to be a special use domain", domain)
+		}
+	}
+	for _, domain := range []string{"example.com.", "local.example.com", "8.8.8.8.in-addr.arpa.", "1.1.32.172.in-addr.arpa.", "arpa", ReverseLookupDomainString("2001:4860::8888")} {
+		if IsSpecialUseDomain(domain) {
+			t.Errorf("Expected '%s' not to be a special use domain", domain)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package util
+
+import (
+	"encoding/base64"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// dnsmasq add-mac, the mac address of the client as raw bytes, base64, or text
+	EdnsMacOption = dns.EDNS0LOCALSTART
+	// dnsmasq add-cpe-id, an identifier for the customer premises equipment as text
+	EdnsCpeIdOption = uint16(65074)
+)
+
+// the identity of the original client that a forwarder adds to a query with edns0 options
+type ClientIdentity struct {
+	// from a client subnet option with a full length (/32 or /128) source prefix
+	IP net.IP
+	// from the add-mac option, normalized to lowercase colon-separated form
+	MAC string
+	// from the add-cpe-id option
+	CpeID string
+}
+
+func macFromOption(data []byte) string {
+	if len(data) == 6 {
+		return strings.ToLower(net.HardwareAddr(data).String())
+	}
+	if mac := NormalizeMAC(string(data)); "" != mac {
+		return mac
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil && len(decoded) == 6 {
+		return strings.ToLower(net.HardwareAddr(decoded).String())
+	}
+	return ""
+}
+
+// get the client identity carried by the edns0 options of the request, returns nil when the request carries no
+// identity. when strip is true the options that carried the identity are removed from the request so that they
+// are not forwarded.
+func ClientIdentityFromRequest(request *dns.Msg, strip bool) *ClientIdentity {
+	if request == nil {
+		return nil
+	}
+	opt := request.IsEdns0()
+	if opt == nil || len(opt.Option) < 1 {
+		return nil
+	}
+
+	identity := &ClientIdentity{}
+	kept := make([]dns.EDNS0, 0, len(opt.Option))
+	for _, option := range opt.Option {
+		used := false
+		switch typed := option.(type) {
+		case *dns.EDNS0_SUBNET:
+			// only a full address identifies a client, shorter prefixes (from public forwarders) are left alone
+			if typed.Address != nil && ((typed.Family == 1 && typed.SourceNetmask == 32) || (typed.Family == 2 && typed.SourceNetmask == 128)) {
+				identity.IP = typed.Address
+				used = true
+			}
+		case *dns.EDNS0_LOCAL:
+			if EdnsMacOption == typed.Code {
+				if mac := macFromOption(typed.Data); "" != mac {
+					identity.MAC = mac
+					used = true
+				}
+			} else if EdnsCpeIdOption == typed.Code {
+				if cpeID := strings.TrimSpace(string(typed.Data)); "" != cpeID {
+					identity.CpeID = cpeID
+					used = true
+				}
+			}
+		}
+		if !used {
+			kept = append(kept, option)
+		}
+	}
+
+	if identity.IP == nil && "" == identity.MAC && "" == identity.CpeID {
+		return nil
+	}
+	if strip {
+		opt.Option = kept
+	}
+	return identity
+}
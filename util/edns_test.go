@@ -0,0 +1,83 @@
+package util
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestClientIdentityFromRequest(t *testing.T) {
+	request := new(dns.Msg)
+	request.SetQuestion("example.com.", dns.TypeA)
+	request.SetEdns0(4096, false)
+	opt := request.IsEdns0()
+	opt.Option = append(opt.Option,
+		&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 32, Address: net.ParseIP("192.168.0.25").To4()},
+		&dns.EDNS0_LOCAL{Code: EdnsMacOption, Data: []byte{0xaa, 0xbb, 0xcc, 0x00, 0x11, 0x22}},
+		&dns.EDNS0_LOCAL{Code: EdnsCpeIdOption, Data: []byte("living-room")},
+		&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "24a5ac1223344556"},
+	)
+
+	// options survive packing and unpacking
+	packed, err := request.Pack()
+	if err != nil {
+		t.Errorf("Could not pack request: %s", err)
+		return
+	}
+	unpacked := new(dns.Msg)
+	if err := unpacked.Unpack(packed); err != nil {
+		t.Errorf("Could not unpack request: %s", err)
+		return
+	}
+
+	identity := ClientIdentityFromRequest(unpacked, true)
+	if identity == nil {
+		t.Errorf("Expected a client identity from the request")
+		return
+	}
+	if !identity.IP.Equal(net.ParseIP("192.168.0.25")) || "aa:bb:cc:00:11:22" != identity.MAC || "living-room" != identity.CpeID {
+		t.Errorf("Unexpected client identity: %v", identity)
+	}
+	// only the cookie is left after stripping
+	if options := unpacked.IsEdns0().Option; len(options) != 1 || options[0].Option() != dns.EDNS0COOKIE {
+		t.Errorf("Expected only the cookie option to remain but found %v", options)
+	}
+}
+
+func TestClientIdentityFormats(t *testing.T) {
+	data := []struct {
+		option   dns.EDNS0
+		expected *ClientIdentity
+	}{
+		// a subnet is not a client
+		{&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("192.168.0.0").To4()}, nil},
+		{&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 2, SourceNetmask: 128, Address: net.ParseIP("2001:db8::25")}, &ClientIdentity{IP: net.ParseIP("2001:db8::25")}},
+		// dnsmasq add-mac=text and add-mac=base64
+		{&dns.EDNS0_LOCAL{Code: EdnsMacOption, Data: []byte("AA:BB:CC:00:11:22")}, &ClientIdentity{MAC: "aa:bb:cc:00:11:22"}},
+		{&dns.EDNS0_LOCAL{Code: EdnsMacOption, Data: []byte("qrvMABEi")}, &ClientIdentity{MAC: "aa:bb:cc:00:11:22"}},
+		{&dns.EDNS0_LOCAL{Code: EdnsMacOption, Data: []byte("not a mac")}, nil},
+	}
+
+	for _, d := range data {
+		request := new(dns.Msg)
+		request.SetQuestion("example.com.", dns.TypeA)
+		request.SetEdns0(4096, false)
+		request.IsEdns0().Option = append(request.IsEdns0().Option, d.option)
+
+		identity := ClientIdentityFromRequest(request, false)
+		if d.expected == nil {
+			if identity != nil {
+				t.Errorf("Expected no identity from %v but got %v", d.option, identity)
+			}
+			continue
+		}
+		if identity == nil || !identity.IP.Equal(d.expected.IP) || identity.MAC != d.expected.MAC {
+			t.Errorf("Expected identity %v from %v but got %v", d.expected, d.option, identity)
+		}
+		// options are left in place without stripping
+		if len(request.IsEdns0().Option) != 1 {
+			t.Errorf("Expected option to remain in the request")
+		}
+	}
+}
@@ -45,6 +45,11 @@ func LineCount(inputfile string) (uint, error) {
 	}
 	defer r.Close()
 
+	return ReaderLineCount(r)
+}
+
+// count the lines read from the reader
+func ReaderLineCount(r io.Reader) (uint, error) {
 	buf := lineCountSlab.Alloc(_lineBufferByteSize)
 	defer lineCountSlab.DecRef(buf)
 
@@ -0,0 +1,174 @@
+package util
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the kernel arp table (ipv4)
+const procArpPath = "/proc/net/arp"
+
+// a cached view of the arp (ipv4) and neighbor (ipv6) tables that maps addresses to hardware (mac) addresses
+type NeighborTable struct {
+	mux     sync.RWMutex
+	entries map[string]string
+
+	// sources of neighbor entries, replaceable for testing
+	arpPath   string
+	neighbors func() (io.ReadCloser, error)
+
+	closeChan chan bool
+	closeOnce sync.Once
+}
+
+// create a neighbor table that is loaded right away and then reloaded in the background on the refresh interval
+func NewNeighborTable(refresh time.Duration) *NeighborTable {
+	return newNeighborTable(refresh, procArpPath, ipNeighbors)
+}
+
+func newNeighborTable(refresh time.Duration, arpPath string, neighbors func() (io.ReadCloser, error)) *NeighborTable {
+	table := &NeighborTable{
+		entries:   make(map[string]string),
+		arpPath:   arpPath,
+		neighbors: neighbors,
+		closeChan: make(chan bool),
+	}
+	table.load()
+	go table.maintain(refresh)
+	return table
+}
+
+// the output of "ip neigh" which lists ipv4 and ipv6 neighbors
+func ipNeighbors() (io.ReadCloser, error) {
+	output, err := exec.Command("ip", "neigh", "show").Output()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(strings.NewReader(string(output))), nil
+}
+
+// normalize a mac address to lowercase colon-separated form, returns an empty string if the address is not valid
+func NormalizeMAC(mac string) string {
+	hw, err := net.ParseMAC(strings.TrimSpace(mac))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(hw.String())
+}
+
+// parse the contents of /proc/net/arp into a map of address to mac address, incomplete entries are skipped
+func ParseProcArp(reader io.Reader, entries map[string]string) {
+	scanner := bufio.NewScanner(reader)
+	// skip header line
+	scanner.Scan()
+	for scanner.Scan() {
+		// IP address, HW type, Flags, HW address, Mask, Device
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		// flag 0x0 is an incomplete entry
+		if "0x0" == fields[2] {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		mac := NormalizeMAC(fields[3])
+		if ip == nil || "" == mac || "00:00:00:00:00:00" == mac {
+			continue
+		}
+		entries[ip.String()] = mac
+	}
+}
+
+// parse the output of "ip neigh" into a map of address to mac address, entries without an address are skipped
+func ParseIpNeigh(reader io.Reader, entries map[string]string) {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		// fe80::1 dev eth0 lladdr 00:11:22:33:44:55 router REACHABLE
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 1 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+		for idx := 1; idx < len(fields)-1; idx++ {
+			if "lladdr" == fields[idx] {
+				if mac := NormalizeMAC(fields[idx+1]); "" != mac {
+					entries[ip.String()] = mac
+				}
+				break
+			}
+		}
+	}
+}
+
+func (table *NeighborTable) load() {
+	entries := make(map[string]string)
+
+	if file, err := os.Open(table.arpPath); err == nil {
+		ParseProcArp(file, entries)
+		_ = file.Close()
+	} else if !os.IsNotExist(err) {
+		log.Debugf("Could not read arp table: %s", err)
+	}
+
+	if table.neighbors != nil {
+		if reader, err := table.neighbors(); err == nil {
+			ParseIpNeigh(reader, entries)
+			_ = reader.Close()
+		} else {
+			log.Debugf("Could not read neighbor table: %s", err)
+		}
+	}
+
+	table.mux.Lock()
+	table.entries = entries
+	table.mux.Unlock()
+}
+
+// reload the table on the refresh interval until the table is closed
+func (table *NeighborTable) maintain(refresh time.Duration) {
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-table.closeChan:
+			return
+		case <-ticker.C:
+			table.load()
+		}
+	}
+}
+
+// the mac address for the given address or an empty string if the address is not in the table. only the
+// loaded table is read, new neighbors are found when the table is reloaded in the background.
+func (table *NeighborTable) MAC(ip net.IP) string {
+	if table == nil || ip == nil {
+		return ""
+	}
+
+	table.mux.RLock()
+	defer table.mux.RUnlock()
+	return table.entries[ip.String()]
+}
+
+// stop reloading the table
+func (table *NeighborTable) Close() {
+	if table == nil {
+		return
+	}
+	table.closeOnce.Do(func() {
+		close(table.closeChan)
+	})
+}
@@ -0,0 +1,93 @@
+package util
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testNeighbors = `fe80::1 dev eth0 lladdr 00:11:22:33:44:55 router REACHABLE
+2001:db8::10 dev eth0 lladdr AA-BB-CC-00-11-44 STALE
+2001:db8::11 dev eth0  FAILED
+192.168.0.13 dev eth0 lladdr aa:bb:cc:00:11:55 DELAY
+`
+
+func TestParseNeighbors(t *testing.T) {
+	entries := make(map[string]string)
+	ParseIpNeigh(strings.NewReader(testNeighbors), entries)
+
+	expected := map[string]string{
+		"fe80::1":      "00:11:22:33:44:55",
+		"2001:db8::10": "aa:bb:cc:00:11:44",
+		"192.168.0.13": "aa:bb:cc:00:11:55",
+	}
+	if len(entries) != len(expected) {
+		t.Errorf("Expected %d entries but got %d: %v", len(expected), len(entries), entries)
+	}
+	for ip, mac := range expected {
+		if entries[ip] != mac {
+			t.Errorf("Expected mac '%s' for %s but got '%s'", mac, ip, entries[ip])
+		}
+	}
+}
+
+func TestNeighborTable(t *testing.T) {
+	var (
+		mux   sync.Mutex
+		loads = 0
+		extra = ""
+	)
+	table := newNeighborTable(50*time.Millisecond, "testdata/arp", func() (io.ReadCloser, error) {
+		mux.Lock()
+		defer mux.Unlock()
+		loads++
+		return ioutil.NopCloser(strings.NewReader(testNeighbors + extra)), nil
+	})
+	defer table.Close()
+
+	data := []struct {
+		ip  string
+		mac string
+	}{
+		{"192.168.0.10", "aa:bb:cc:00:11:22"},
+		// incomplete entry
+		{"192.168.0.11", ""},
+		{"192.168.0.12", "aa:bb:cc:00:11:33"},
+		{"192.168.0.13", "aa:bb:cc:00:11:55"},
+		{"2001:db8:0::10", "aa:bb:cc:00:11:44"},
+		{"192.168.0.99", ""},
+	}
+	for _, d := range data {
+		if mac := table.MAC(net.ParseIP(d.ip)); mac != d.mac {
+			t.Errorf("Expected mac '%s' for %s but got '%s'", d.mac, d.ip, mac)
+		}
+	}
+
+	// lookups only read the table, a new neighbor is found when the table is reloaded in the background
+	mux.Lock()
+	extra = "192.168.0.99 dev eth0 lladdr aa:bb:cc:00:11:99 REACHABLE\n"
+	mux.Unlock()
+	for wait := 0; wait < 50 && "" == table.MAC(net.ParseIP("192.168.0.99")); wait++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if mac := table.MAC(net.ParseIP("192.168.0.99")); "aa:bb:cc:00:11:99" != mac {
+		t.Errorf("Expected new neighbor after the table was reloaded but got '%s'", mac)
+	}
+
+	// a closed table is not reloaded again
+	table.Close()
+	time.Sleep(60 * time.Millisecond)
+	mux.Lock()
+	closedLoads := loads
+	mux.Unlock()
+	time.Sleep(150 * time.Millisecond)
+	mux.Lock()
+	defer mux.Unlock()
+	if loads != closedLoads {
+		t.Errorf("Expected the table to stop reloading after it was closed")
+	}
+}
@@ -81,10 +81,30 @@ export class QueryLog extends React.Component {
             return (
               <div style={{ color: "red" }}><ErrorCircleOIcon alt="blocked" /> BLOCKED</div>
             );
+          } else if ( rowData.RateLimited ) {
+            return (
+              <div style={{ color: "red" }}><ErrorCircleOIcon alt="rate limited" /> RATE LIMITED</div>
+            );
+          } else if ( rowData.Rebinding && "NXDOMAIN" === responseCode ) {
+            return (
+              <div style={{ color: "red" }}><ErrorCircleOIcon alt="rebinding" /> REBINDING BLOCKED</div>
+            );
+          } else if ( rowData.Rebinding ) {
+            return (
+              <div style={{ color: "orange" }}><ErrorCircleOIcon alt="rebinding" /> { responseText } (private addresses removed)</div>
+            );
           } else if ( rowData.Match === 1 ) {
             return (
               <div style={{ color: "red" }}><ErrorCircleOIcon alt="blocked" /> { rowData.MatchList }{ rowData.MatchRule ? ' (' + rowData.MatchRule + ")" : null }</div>
             );          
+          } else if ( rowData.Match === 4 ) {
+            return (
+              <div style={{ color: "blue" }}>{ responseText } (rewrite: { rowData.MatchList ? rowData.MatchList + ' ' : null }{ rowData.MatchRule })</div>
+            );
+          } else if ( rowData.Match === 3 ) {
+            return (
+              <div style={{ color: "orange" }}><ErrorCircleOIcon alt="would block" /> { responseText } ({ rowData.Paused ? 'paused, ' : null }would block: { rowData.MatchList }{ rowData.MatchRule ? ' ' + rowData.MatchRule : null })</div>
+            );
           } else if ( rowData.Cached ) {
             return (
               <div style={{ color: "green" }}><VolumeIcon alt="cached" /> { responseText }</div>
@@ -177,7 +197,26 @@ export class QueryLog extends React.Component {
   });
 
   componentDidMount() {
-
+    // offer to allow blocked domains when there is a local allow list that can be edited
+    Axios
+      .get('/api/lists')
+      .then(response => response.data)
+      .then(lists => {
+        let allowList = (lists || []).find(list => list.type === "allow" && list.editable);
+        if ( allowList == null ) {
+          return;
+        }
+        this.setState({ actions: [
+          rowData => ({
+            icon: () => <Check />,
+            tooltip: 'Allow this domain (' + allowList.name + ')',
+            hidden: rowData.Match !== 1,
+            onClick: (event, rowData) => {
+              Axios.post('/api/lists/' + encodeURIComponent(allowList.name) + '/domains', { domain: rowData.RequestDomain });
+            }
+          })
+        ]});
+      });
   }
 
   componentWillUnmount() {
@@ -195,6 +195,10 @@ export class QueryTester extends React.Component {
         ruleMatch = "BLOCKED";
       } else if ( response.result.Match === 2 ) {
         ruleMatch = "ALLOWED";
+      } else if ( response.result.Match === 3 ) {
+        ruleMatch = "WOULD BLOCK";
+      } else if ( response.result.Match === 4 ) {
+        ruleMatch = "REWRITE";
       }
 
       output = (
@@ -205,8 +209,8 @@ export class QueryTester extends React.Component {
                 <tbody>
                   <tr><td><strong>Cached</strong></td><td className={css(gudgeonStyles.queryLog)}>{ response.result.Cached ? "True" : "False" }</td></tr>
                   <tr><td><strong>Match Type</strong></td><td className={css(gudgeonStyles.queryLog)}>{ ruleMatch }</td></tr>
-                  { ruleMatch === "BLOCKED" || ruleMatch === "ALLOWED" ? (<tr><td><strong>Match List</strong></td><td className={css(gudgeonStyles.queryLog)}>{ response.result.MatchList.Name }</td></tr>) : null }
-                  { ruleMatch === "BLOCKED" || ruleMatch === "ALLOWED" ? (<tr><td><strong>Match Rule</strong></td><td className={css(gudgeonStyles.queryLog)}>{ response.result.MatchRule }</td></tr>) : null }
+                  { ruleMatch !== "NONE" ? (<tr><td><strong>Match List</strong></td><td className={css(gudgeonStyles.queryLog)}>{ response.result.MatchList.Name }</td></tr>) : null }
+                  { ruleMatch !== "NONE" ? (<tr><td><strong>Match Rule</strong></td><td className={css(gudgeonStyles.queryLog)}>{ response.result.MatchRule }</td></tr>) : null }
                 </tbody>
               </table>
               { response.text != null && response.text.length > 0 ? <SyntaxHighlighter language='dns' style={googlecode}>{response.text}</SyntaxHighlighter> : null }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -198,6 +199,36 @@ func (web *web) GetQueryLogInfo(c *gin.Context) {
 		}
 	}
 
+	if paused := c.Query("paused"); len(paused) > 0 {
+		if "true" == strings.ToLower(paused) {
+			boolHolder := true
+			query.Paused = &boolHolder
+		} else if "false" == strings.ToLower(paused) {
+			boolHolder := false
+			query.Paused = &boolHolder
+		}
+	}
+
+	if rateLimited := c.Query("ratelimited"); len(rateLimited) > 0 {
+		if "true" == strings.ToLower(rateLimited) {
+			boolHolder := true
+			query.RateLimited = &boolHolder
+		} else if "false" == strings.ToLower(rateLimited) {
+			boolHolder := false
+			query.RateLimited = &boolHolder
+		}
+	}
+
+	if rebinding := c.Query("rebinding"); len(rebinding) > 0 {
+		if "true" == strings.ToLower(rebinding) {
+			boolHolder := true
+			query.Rebinding = &boolHolder
+		} else if "false" == strings.ToLower(rebinding) {
+			boolHolder := false
+			query.Rebinding = &boolHolder
+		}
+	}
+
 	if address := c.Query("address"); len(address) > 0 {
 		query.Address = address
 	}
@@ -374,6 +405,144 @@ func (web *web) GetTestResult(c *gin.Context) {
 	})
 }
 
+func (web *web) GetExplain(c *gin.Context) {
+	domain := c.Query("domain")
+	if len(domain) < 1 {
+		c.String(http.StatusBadRequest, "Domain must be provided")
+		return
+	}
+
+	var groups []string
+	if groupsParam := c.Query("groups"); len(groupsParam) > 0 {
+		groups = strings.Split(groupsParam, ",")
+	}
+
+	var address *net.IP
+	if ipParam := c.Query("ip"); len(ipParam) > 0 {
+		ip := net.ParseIP(ipParam)
+		if ip == nil {
+			c.String(http.StatusBadRequest, "IP must be a valid address")
+			return
+		}
+		address = &ip
+	}
+
+	explanation, err := web.engine.Explain(domain, c.Query("consumer"), groups, address)
+	if err != nil {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, explanation)
+}
+
+func (web *web) GetLists(c *gin.Context) {
+	c.JSON(http.StatusOK, web.engine.Lists())
+}
+
+// the user making a change comes from basic auth or from a header set by an authenticating proxy
+func requestUser(c *gin.Context) string {
+	if user, _, ok := c.Request.BasicAuth(); ok && "" != user {
+		return user
+	}
+	return c.GetHeader("X-Forwarded-User")
+}
+
+func (web *web) AddListDomain(c *gin.Context) {
+	body := struct {
+		Domain string `json:"domain"`
+	}{}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.String(http.StatusBadRequest, "Could not parse request: %s", err)
+			return
+		}
+	}
+	if "" == body.Domain {
+		body.Domain = c.Query("domain")
+	}
+
+	changed, err := web.engine.AddToList(c.Param("name"), body.Domain, requestUser(c), c.ClientIP())
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, &gin.H{
+		"changed": changed,
+	})
+}
+
+func (web *web) RemoveListDomain(c *gin.Context) {
+	changed, err := web.engine.RemoveFromList(c.Param("name"), c.Param("domain"), requestUser(c), c.ClientIP())
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, &gin.H{
+		"changed": changed,
+	})
+}
+
+func (web *web) GetListChanges(c *gin.Context) {
+	limit := 100
+	if limitParam := c.Query("limit"); len(limitParam) > 0 {
+		if parsed, err := strconv.Atoi(limitParam); err == nil {
+			limit = parsed
+		}
+	}
+	c.JSON(http.StatusOK, web.engine.ListChanges(limit))
+}
+
+func (web *web) GetPauses(c *gin.Context) {
+	c.JSON(http.StatusOK, web.engine.Pauses())
+}
+
+func (web *web) AddPause(c *gin.Context) {
+	body := struct {
+		Scope    string `json:"scope"`
+		Name     string `json:"name"`
+		Duration string `json:"duration"`
+	}{}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.String(http.StatusBadRequest, "Could not parse request: %s", err)
+			return
+		}
+	}
+	if "" == body.Scope {
+		body.Scope = c.Query("scope")
+	}
+	if "" == body.Name {
+		body.Name = c.Query("name")
+	}
+	if "" == body.Duration {
+		body.Duration = c.Query("duration")
+	}
+
+	duration, err := time.ParseDuration(body.Duration)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Could not parse duration '%s': %s", body.Duration, err)
+		return
+	}
+
+	pause, err := web.engine.Pause(body.Scope, body.Name, duration)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	log.Infof("Pause requested by '%s' from %s", requestUser(c), c.ClientIP())
+
+	c.JSON(http.StatusOK, pause)
+}
+
+func (web *web) RemovePause(c *gin.Context) {
+	c.JSON(http.StatusOK, &gin.H{
+		"resumed": web.engine.Resume(c.Query("scope"), c.Query("name")),
+	})
+}
+
 func (web *web) Serve(conf *config.GudgeonConfig, engine engine.Engine) error {
 	// set metrics endpoint
 	web.engine = engine
@@ -400,8 +569,18 @@ func (web *web) Serve(conf *config.GudgeonConfig, engine engine.Engine) error {
 		// testing/troubleshooting/diagnostics
 		api.GET("/test/components", web.GetTestComponents)
 		api.GET("/test/query", web.GetTestResult)
+		api.GET("/test/explain", web.GetExplain)
 		// attach query log
 		api.GET("/query/list", web.GetQueryLogInfo)
+		// list editing
+		api.GET("/lists", web.GetLists)
+		api.POST("/lists/:name/domains", web.AddListDomain)
+		api.DELETE("/lists/:name/domains/:domain", web.RemoveListDomain)
+		api.GET("/list-changes", web.GetListChanges)
+		// pausing blocking
+		api.GET("/pause", web.GetPauses)
+		api.POST("/pause", web.AddPause)
+		api.DELETE("/pause", web.RemovePause)
 	}
 
 	// go serve